@@ -0,0 +1,139 @@
+package grpcurl
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"crypto/tls"
+	"fmt"
+	"net"
+	"os"
+	"path"
+	"path/filepath"
+	"strings"
+
+	"google.golang.org/grpc/credentials"
+)
+
+// ClientCertMap selects a client certificate based on the name of the server
+// being connected to. This allows a single configuration to be used with
+// several servers that each require a different client certificate.
+type ClientCertMap struct {
+	entries []certMapEntry
+}
+
+type certMapEntry struct {
+	pattern string
+	cert    tls.Certificate
+}
+
+// LoadClientCertMap reads a client certificate map from the given file. Each
+// line of the file has three fields, separated by whitespace: a server name
+// pattern, the path to a certificate file, and the path to the corresponding
+// private key file. Relative paths are relative to the directory that contains
+// the map file. Blank lines and lines that start with '#' are ignored.
+//
+// Patterns are matched against the server name using path.Match, so "*" can
+// be used as a wildcard, such as "*.example.com". Matching is case-insensitive.
+// When more than one pattern matches, the first one in the file is used.
+func LoadClientCertMap(fileName string) (*ClientCertMap, error) {
+	b, err := os.ReadFile(fileName)
+	if err != nil {
+		return nil, fmt.Errorf("could not read client certificate map: %v", err)
+	}
+	dir := filepath.Dir(fileName)
+	var m ClientCertMap
+	scanner := bufio.NewScanner(bytes.NewReader(b))
+	lineNum := 0
+	for scanner.Scan() {
+		lineNum++
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+		fields := strings.Fields(line)
+		if len(fields) != 3 {
+			return nil, fmt.Errorf("%s:%d: expecting 'pattern cert-file key-file', got %d fields", fileName, lineNum, len(fields))
+		}
+		pattern := strings.ToLower(fields[0])
+		if _, err := path.Match(pattern, ""); err != nil {
+			return nil, fmt.Errorf("%s:%d: invalid pattern %q: %v", fileName, lineNum, fields[0], err)
+		}
+		certFile, keyFile := fields[1], fields[2]
+		if !filepath.IsAbs(certFile) {
+			certFile = filepath.Join(dir, certFile)
+		}
+		if !filepath.IsAbs(keyFile) {
+			keyFile = filepath.Join(dir, keyFile)
+		}
+		cert, err := tls.LoadX509KeyPair(certFile, keyFile)
+		if err != nil {
+			return nil, fmt.Errorf("%s:%d: could not load client key pair: %v", fileName, lineNum, err)
+		}
+		m.entries = append(m.entries, certMapEntry{pattern: pattern, cert: cert})
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, fmt.Errorf("could not read client certificate map: %v", err)
+	}
+	return &m, nil
+}
+
+// CertificateFor returns the client certificate to use when connecting to the
+// given server name. It returns nil if no pattern in the map matches.
+func (m *ClientCertMap) CertificateFor(serverName string) *tls.Certificate {
+	serverName = strings.ToLower(serverName)
+	for i := range m.entries {
+		if ok, _ := path.Match(m.entries[i].pattern, serverName); ok {
+			return &m.entries[i].cert
+		}
+	}
+	return nil
+}
+
+// ClientCertMapCredentials returns TLS transport credentials, using the given
+// config, that present the client certificate selected from the given map for
+// each connection. The server name used for selection is the config's
+// ServerName, if set, or else the host portion of the authority of the
+// connection. If no certificate in the map matches, the config's own
+// certificates, if any, are used.
+func ClientCertMapCredentials(tlsConf *tls.Config, certMap *ClientCertMap) credentials.TransportCredentials {
+	return &certMapCreds{
+		TransportCredentials: credentials.NewTLS(tlsConf),
+		tlsConf:              tlsConf,
+		certMap:              certMap,
+	}
+}
+
+type certMapCreds struct {
+	credentials.TransportCredentials
+	tlsConf *tls.Config
+	certMap *ClientCertMap
+}
+
+func (c *certMapCreds) ClientHandshake(ctx context.Context, authority string, rawConn net.Conn) (net.Conn, credentials.AuthInfo, error) {
+	serverName := c.tlsConf.ServerName
+	if serverName == "" {
+		serverName = authority
+		if host, _, err := net.SplitHostPort(authority); err == nil {
+			serverName = host
+		}
+	}
+	cert := c.certMap.CertificateFor(serverName)
+	if cert == nil {
+		return c.TransportCredentials.ClientHandshake(ctx, authority, rawConn)
+	}
+	conf := c.tlsConf.Clone()
+	conf.Certificates = nil
+	conf.GetClientCertificate = func(*tls.CertificateRequestInfo) (*tls.Certificate, error) {
+		return cert, nil
+	}
+	return credentials.NewTLS(conf).ClientHandshake(ctx, authority, rawConn)
+}
+
+func (c *certMapCreds) Clone() credentials.TransportCredentials {
+	return &certMapCreds{
+		TransportCredentials: c.TransportCredentials.Clone(),
+		tlsConf:              c.tlsConf.Clone(),
+		certMap:              c.certMap,
+	}
+}
@@ -0,0 +1,88 @@
+package grpcurl
+
+import (
+	"context"
+
+	"github.com/jhump/protoreflect/desc"
+	"github.com/jhump/protoreflect/grpcreflect"
+	"google.golang.org/grpc"
+)
+
+// Client combines a connection to a server with a source of descriptors, so
+// that a program can list and describe services and then invoke methods, all
+// with the same connection, like the grpcurl command-line tool does. Use
+// NewClient or NewReflectionClient to create one. A Client must be closed
+// when no longer needed.
+type Client struct {
+	cc        *grpc.ClientConn
+	source    DescriptorSource
+	refClient *grpcreflect.Client
+}
+
+// NewClient returns a client that invokes methods using the given connection
+// and resolves symbols using the given descriptor source, such as one created
+// from protoset or proto source files. The client takes ownership of the
+// connection: it is closed when the client is closed.
+func NewClient(cc *grpc.ClientConn, source DescriptorSource) *Client {
+	return &Client{cc: cc, source: source}
+}
+
+// NewReflectionClient returns a client that resolves symbols using server
+// reflection, over the same connection used to invoke methods. The given
+// context is used for reflection requests, so it may carry metadata (such as
+// credentials) that the reflection service requires; it should not be
+// cancelled until the client is closed. The client takes ownership of the
+// connection: it is closed when the client is closed.
+func NewReflectionClient(ctx context.Context, cc *grpc.ClientConn) *Client {
+	refClient := grpcreflect.NewClientAuto(ctx, cc)
+	refClient.AllowMissingFileDescriptors()
+	return &Client{
+		cc:        cc,
+		source:    DescriptorSourceFromServer(ctx, refClient),
+		refClient: refClient,
+	}
+}
+
+// Conn returns the client's connection.
+func (c *Client) Conn() *grpc.ClientConn {
+	return c.cc
+}
+
+// DescriptorSource returns the source the client uses to resolve symbols.
+func (c *Client) DescriptorSource() DescriptorSource {
+	return c.source
+}
+
+// List returns the fully-qualified names of the services exposed by the
+// server if serviceName is empty. Otherwise, it returns the fully-qualified
+// names of the methods of the named service. See ListServices and
+// ListMethods.
+func (c *Client) List(serviceName string) ([]string, error) {
+	if serviceName == "" {
+		return ListServices(c.source)
+	}
+	return ListMethods(c.source, serviceName)
+}
+
+// Describe returns the descriptor for the given fully-qualified symbol. Use
+// GetDescriptorText to render it as proto source.
+func (c *Client) Describe(symbol string) (desc.Descriptor, error) {
+	return c.source.FindSymbol(symbol)
+}
+
+// Invoke invokes the given method, which is in 'service/method' or
+// 'service.method' form, using the client's connection. See InvokeRPC for
+// the other arguments.
+func (c *Client) Invoke(ctx context.Context, methodName string, headers []string, handler InvocationEventHandler, requestData RequestSupplier) error {
+	return InvokeRPC(ctx, c.source, c.cc, methodName, headers, handler, requestData)
+}
+
+// Close shuts down the client's reflection stream, if any, and closes its
+// connection.
+func (c *Client) Close() error {
+	if c.refClient != nil {
+		c.refClient.Reset()
+		c.refClient = nil
+	}
+	return c.cc.Close()
+}
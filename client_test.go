@@ -0,0 +1,87 @@
+package grpcurl_test
+
+import (
+	"context"
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/jhump/protoreflect/desc"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/credentials/insecure"
+
+	. "github.com/fullstorydev/grpcurl"
+)
+
+func TestClient(t *testing.T) {
+	testCases := []struct {
+		name      string
+		newClient func(cc *grpc.ClientConn) *Client
+		services  []string
+	}{
+		{
+			name: "reflection",
+			newClient: func(cc *grpc.ClientConn) *Client {
+				return NewReflectionClient(context.Background(), cc)
+			},
+			services: []string{"grpc.reflection.v1.ServerReflection", "grpc.reflection.v1alpha.ServerReflection", "testing.TestService"},
+		},
+		{
+			name: "protoset",
+			newClient: func(cc *grpc.ClientConn) *Client {
+				return NewClient(cc, sourceProtoset)
+			},
+			services: []string{"testing.TestService", "testing.UnimplementedService"},
+		},
+	}
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			// the client closes its connection, so it can't share the one used by other tests
+			cc, err := grpc.Dial(ccReflect.Target(), grpc.WithTransportCredentials(insecure.NewCredentials()))
+			if err != nil {
+				t.Fatalf("failed to dial: %v", err)
+			}
+			client := tc.newClient(cc)
+			defer client.Close()
+
+			svcs, err := client.List("")
+			if err != nil {
+				t.Fatalf("failed to list services: %v", err)
+			}
+			if !reflect.DeepEqual(svcs, tc.services) {
+				t.Errorf("wrong services: wanted %v, got %v", tc.services, svcs)
+			}
+			methods, err := client.List("testing.TestService")
+			if err != nil {
+				t.Fatalf("failed to list methods: %v", err)
+			}
+			if len(methods) == 0 {
+				t.Error("expecting methods of testing.TestService")
+			}
+
+			d, err := client.Describe("testing.TestService.UnaryCall")
+			if err != nil {
+				t.Fatalf("failed to describe method: %v", err)
+			}
+			if _, ok := d.(*desc.MethodDescriptor); !ok {
+				t.Errorf("expecting method descriptor, got %T", d)
+			}
+
+			var out strings.Builder
+			h := &DefaultEventHandler{Out: &out, Formatter: NewJSONFormatter(false, nil)}
+			rf := NewJSONRequestParser(strings.NewReader(payload1), nil)
+			err = client.Invoke(context.Background(), "testing.TestService/UnaryCall", makeHeaders(codes.OK), h, rf.Next)
+			if err != nil {
+				t.Fatalf("unexpected error during RPC: %v", err)
+			}
+			if h.Status.Code() != codes.OK || h.NumResponses != 1 {
+				t.Errorf("expecting one response and OK status, got %d and %v", h.NumResponses, h.Status)
+			}
+
+			if err := client.Close(); err != nil {
+				t.Errorf("failed to close client: %v", err)
+			}
+		})
+	}
+}
@@ -0,0 +1,57 @@
+package main
+
+import (
+	"fmt"
+	"io"
+	"strconv"
+	"strings"
+	"sync"
+
+	"github.com/golang/protobuf/jsonpb" //lint:ignore SA1019 we have to import this because it appears in exported API
+	"github.com/golang/protobuf/proto"  //lint:ignore SA1019 we have to import this because it appears in exported API
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+// briefRecorder records responses as compact JSON so that the outcome of an
+// RPC can be printed as a single line, via -brief.
+type briefRecorder struct {
+	marshaler jsonpb.Marshaler
+
+	mu        sync.Mutex
+	responses []string
+}
+
+func newBriefRecorder(emitDefaults bool, resolver jsonpb.AnyResolver) *briefRecorder {
+	return &briefRecorder{marshaler: jsonpb.Marshaler{EmitDefaults: emitDefaults, AnyResolver: resolver}}
+}
+
+// format is a grpcurl.Formatter that records the given response.
+func (b *briefRecorder) format(m proto.Message) (string, error) {
+	str, err := b.marshaler.MarshalToString(m)
+	if err != nil {
+		return "", err
+	}
+	b.mu.Lock()
+	b.responses = append(b.responses, str)
+	b.mu.Unlock()
+	return str, nil
+}
+
+// print writes a line with the given method, the status code, and either
+// the response or, if the RPC failed, the status message. If there was more
+// than one response, they are shown as a JSON array.
+func (b *briefRecorder) print(out io.Writer, method string, stat *status.Status) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	var result string
+	switch {
+	case stat.Code() != codes.OK:
+		result = strconv.Quote(stat.Message())
+	case len(b.responses) == 1:
+		result = b.responses[0]
+	default:
+		result = "[" + strings.Join(b.responses, ",") + "]"
+	}
+	fmt.Fprintf(out, "%s %s %s\n", method, stat.Code(), result)
+}
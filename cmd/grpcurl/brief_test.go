@@ -0,0 +1,63 @@
+package main
+
+import (
+	"bytes"
+	"testing"
+
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+	"google.golang.org/protobuf/types/known/wrapperspb"
+)
+
+func TestBriefRecorder(t *testing.T) {
+	testCases := []struct {
+		name      string
+		responses []string
+		stat      *status.Status
+		expected  string
+	}{
+		{
+			name:      "one response",
+			responses: []string{"abc"},
+			stat:      status.New(codes.OK, ""),
+			expected:  `svc.Svc/Get OK "abc"` + "\n",
+		},
+		{
+			name:      "stream",
+			responses: []string{"abc", "def"},
+			stat:      status.New(codes.OK, ""),
+			expected:  `svc.Svc/Get OK ["abc","def"]` + "\n",
+		},
+		{
+			name:     "empty stream",
+			stat:     status.New(codes.OK, ""),
+			expected: "svc.Svc/Get OK []\n",
+		},
+		{
+			// responses are not shown when the RPC fails
+			name:      "failure",
+			responses: []string{"abc"},
+			stat:      status.New(codes.NotFound, `no "thing"`),
+			expected:  `svc.Svc/Get NotFound "no \"thing\""` + "\n",
+		},
+	}
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			b := newBriefRecorder(false, nil)
+			for _, resp := range tc.responses {
+				str, err := b.format(wrapperspb.String(resp))
+				if err != nil {
+					t.Fatalf("failed to format response: %v", err)
+				}
+				if str != `"`+resp+`"` {
+					t.Errorf("expecting formatter to return compact JSON, got %q", str)
+				}
+			}
+			var out bytes.Buffer
+			b.print(&out, "svc.Svc/Get", tc.stat)
+			if out.String() != tc.expected {
+				t.Errorf("expecting %q, got %q", tc.expected, out.String())
+			}
+		})
+	}
+}
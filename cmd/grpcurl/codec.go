@@ -0,0 +1,68 @@
+package main
+
+import (
+	"fmt"
+	"io"
+
+	"github.com/golang/protobuf/proto" //lint:ignore SA1019 we have to import this because it appears in exported API
+	"github.com/jhump/protoreflect/desc"
+	"github.com/jhump/protoreflect/dynamic"
+
+	"github.com/fullstorydev/grpcurl"
+)
+
+// findMessageType resolves the given fully-qualified name, which must be a
+// message type, using the given descriptor source.
+func findMessageType(descSource grpcurl.DescriptorSource, typeName string) (*desc.MessageDescriptor, error) {
+	d, err := descSource.FindSymbol(typeName)
+	if err != nil {
+		return nil, err
+	}
+	md, ok := d.(*desc.MessageDescriptor)
+	if !ok {
+		return nil, fmt.Errorf("%s is not a message type", typeName)
+	}
+	return md, nil
+}
+
+// decodeMessage reads a serialized message of the given type from in and
+// returns it.
+func decodeMessage(descSource grpcurl.DescriptorSource, typeName string, in io.Reader) (proto.Message, error) {
+	md, err := findMessageType(descSource, typeName)
+	if err != nil {
+		return nil, err
+	}
+	data, err := io.ReadAll(in)
+	if err != nil {
+		return nil, err
+	}
+	msg := dynamic.NewMessage(md)
+	if err := msg.Unmarshal(data); err != nil {
+		return nil, fmt.Errorf("failed to unmarshal %s: %v", typeName, err)
+	}
+	return msg, nil
+}
+
+// encodeMessage uses the given parser to read a single message of the given
+// type and returns its serialized form. It is an error if the parser provides
+// no message or more than one.
+func encodeMessage(descSource grpcurl.DescriptorSource, typeName string, rf grpcurl.RequestParser) ([]byte, error) {
+	md, err := findMessageType(descSource, typeName)
+	if err != nil {
+		return nil, err
+	}
+	msg := dynamic.NewMessage(md)
+	if err := rf.Next(msg); err != nil {
+		if err == io.EOF {
+			return nil, fmt.Errorf("no input data for %s", typeName)
+		}
+		return nil, err
+	}
+	if err := rf.Next(dynamic.NewMessage(md)); err != io.EOF {
+		if err == nil {
+			return nil, fmt.Errorf("input data contained more than one message")
+		}
+		return nil, err
+	}
+	return msg.Marshal()
+}
@@ -0,0 +1,120 @@
+package main
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+
+	"github.com/golang/protobuf/proto" //lint:ignore SA1019 we have to import this because it appears in exported API
+	"github.com/jhump/protoreflect/desc/protoparse"
+	"github.com/jhump/protoreflect/dynamic"
+
+	"github.com/fullstorydev/grpcurl"
+)
+
+func codecTestSource(t *testing.T) grpcurl.DescriptorSource {
+	t.Helper()
+	fds, err := (&protoparse.Parser{
+		Accessor: protoparse.FileContentsFromMap(map[string]string{
+			"codec.proto": `
+				syntax = "proto3";
+				package codec;
+				message Thing { string name = 1; int32 count = 2; }
+				service Svc { rpc Get (Thing) returns (Thing); }`,
+		}),
+	}).ParseFiles("codec.proto")
+	if err != nil {
+		t.Fatalf("failed to parse protos: %v", err)
+	}
+	source, err := grpcurl.DescriptorSourceFromFileDescriptors(fds...)
+	if err != nil {
+		t.Fatalf("failed to create descriptor source: %v", err)
+	}
+	return source
+}
+
+func TestDecodeMessage(t *testing.T) {
+	source := codecTestSource(t)
+	md, err := findMessageType(source, "codec.Thing")
+	if err != nil {
+		t.Fatalf("failed to find message type: %v", err)
+	}
+	thing := dynamic.NewMessage(md)
+	thing.SetFieldByName("name", "widget")
+	thing.SetFieldByName("count", int32(3))
+	data, err := thing.Marshal()
+	if err != nil {
+		t.Fatalf("failed to marshal message: %v", err)
+	}
+
+	msg, err := decodeMessage(source, "codec.Thing", bytes.NewReader(data))
+	if err != nil {
+		t.Fatalf("failed to decode message: %v", err)
+	}
+	if !proto.Equal(msg, thing) {
+		t.Errorf("expecting %v, got %v", thing, msg)
+	}
+
+	testCases := []struct {
+		typeName string
+		data     []byte
+		errMsg   string
+	}{
+		{typeName: "codec.Nope", data: data, errMsg: "Symbol not found: codec.Nope"},
+		{typeName: "codec.Svc", data: data, errMsg: "codec.Svc is not a message type"},
+		// field 1 with a length that runs past the end of the input
+		{typeName: "codec.Thing", data: []byte{0x0a, 0x10, 'a'}, errMsg: "failed to unmarshal codec.Thing"},
+	}
+	for _, tc := range testCases {
+		_, err := decodeMessage(source, tc.typeName, bytes.NewReader(tc.data))
+		if err == nil || !strings.Contains(err.Error(), tc.errMsg) {
+			t.Errorf("%s: expecting error containing %q, got %v", tc.typeName, tc.errMsg, err)
+		}
+	}
+}
+
+func TestEncodeMessage(t *testing.T) {
+	source := codecTestSource(t)
+	testCases := []struct {
+		name     string
+		typeName string
+		input    string
+		expected map[string]interface{}
+		errMsg   string
+	}{
+		{
+			name:     "one message",
+			typeName: "codec.Thing",
+			input:    `{"name": "widget", "count": 3}`,
+			expected: map[string]interface{}{"name": "widget", "count": int32(3)},
+		},
+		{name: "no messages", typeName: "codec.Thing", input: ``, errMsg: "no input data for codec.Thing"},
+		{name: "two messages", typeName: "codec.Thing", input: `{"name": "a"} {"name": "b"}`, errMsg: "input data contained more than one message"},
+		{name: "bad data", typeName: "codec.Thing", input: `{"nope": 1}`, errMsg: "nope"},
+		{name: "bad trailing data", typeName: "codec.Thing", input: `{"name": "a"} {"nope": 1}`, errMsg: "nope"},
+		{name: "not a message", typeName: "codec.Svc", input: `{}`, errMsg: "codec.Svc is not a message type"},
+	}
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			data, err := encodeMessage(source, tc.typeName, grpcurl.NewJSONRequestParser(strings.NewReader(tc.input), nil))
+			if tc.errMsg != "" {
+				if err == nil || !strings.Contains(err.Error(), tc.errMsg) {
+					t.Errorf("expecting error containing %q, got %v", tc.errMsg, err)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+			msg, err := decodeMessage(source, tc.typeName, bytes.NewReader(data))
+			if err != nil {
+				t.Fatalf("failed to decode encoded message: %v", err)
+			}
+			for name, val := range tc.expected {
+				if got := msg.(*dynamic.Message).GetFieldByName(name); got != val {
+					t.Errorf("field %s: expecting %v, got %v", name, val, got)
+				}
+			}
+		})
+	}
+}
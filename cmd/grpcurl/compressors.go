@@ -0,0 +1,148 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"strings"
+	"sync"
+
+	"github.com/golang/protobuf/proto" //lint:ignore SA1019 we have to import this because it appears in exported API
+	"github.com/jhump/protoreflect/dynamic/grpcdynamic"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/encoding"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/status"
+
+	"github.com/fullstorydev/grpcurl"
+)
+
+// knownCompressors are the names of compressors that may be registered with
+// the gRPC library. The library does not provide a way to enumerate the
+// registered ones, so these are probed instead.
+var knownCompressors = []string{"gzip", "deflate", "snappy", "zstd", "br", "lz4"}
+
+// registeredCompressors returns the names of the compressors that are
+// registered with the gRPC library, not including "identity" (no
+// compression), which is always supported.
+func registeredCompressors() []string {
+	var names []string
+	for _, name := range knownCompressors {
+		if encoding.GetCompressor(name) != nil {
+			names = append(names, name)
+		}
+	}
+	return names
+}
+
+// printCompressors writes the names of the registered compressors.
+func printCompressors(w io.Writer) {
+	names := append(registeredCompressors(), "identity")
+	fmt.Fprintf(w, "Client compressors: %s\n", strings.Join(names, ", "))
+}
+
+// compressorCallOptions returns the call options for sending request messages
+// compressed with the named compressor. No options are needed for "identity"
+// (no compression). It is an error if the compressor is not registered.
+func compressorCallOptions(name string) ([]grpc.CallOption, error) {
+	if name == "identity" {
+		return nil, nil
+	}
+	if encoding.GetCompressor(name) == nil {
+		names := append(registeredCompressors(), "identity")
+		return nil, fmt.Errorf("unknown compressor %q; must be one of: %s", name, strings.Join(names, ", "))
+	}
+	return []grpc.CallOption{grpc.UseCompressor(name)}, nil
+}
+
+// compressThresholdChannel is a channel that only compresses request messages
+// whose serialized size is at least minSize bytes, since compressing small
+// messages rarely makes them smaller. The compressor used by grpc-go is chosen
+// per call, not per message, so this is exact only for unary RPCs: all
+// request messages of a stream are compressed, and warnf is called the first
+// time a stream sends one that is smaller than minSize.
+type compressThresholdChannel struct {
+	grpcdynamic.Channel
+	compressor string
+	minSize    int
+	warnf      func(msg string, args ...interface{})
+}
+
+func (c *compressThresholdChannel) Invoke(ctx context.Context, method string, args, reply interface{}, opts ...grpc.CallOption) error {
+	if msg, ok := args.(proto.Message); !ok || proto.Size(msg) >= c.minSize {
+		opts = append(opts, grpc.UseCompressor(c.compressor))
+	}
+	return c.Channel.Invoke(ctx, method, args, reply, opts...)
+}
+
+func (c *compressThresholdChannel) NewStream(ctx context.Context, desc *grpc.StreamDesc, method string, opts ...grpc.CallOption) (grpc.ClientStream, error) {
+	str, err := c.Channel.NewStream(ctx, desc, method, append(opts, grpc.UseCompressor(c.compressor))...)
+	if err != nil {
+		return nil, err
+	}
+	return &compressThresholdStream{ClientStream: str, ch: c}, nil
+}
+
+type compressThresholdStream struct {
+	grpc.ClientStream
+	ch     *compressThresholdChannel
+	warned bool
+}
+
+func (s *compressThresholdStream) SendMsg(m interface{}) error {
+	if msg, ok := m.(proto.Message); ok && !s.warned {
+		if size := proto.Size(msg); size < s.ch.minSize {
+			s.warned = true
+			s.ch.warnf("Compressing a request message of %d bytes, below -compress-min-size, since all messages of a stream use the same compressor.", size)
+		}
+	}
+	return s.ClientStream.SendMsg(m)
+}
+
+// acceptEncodingHandler wraps an event handler and records the compressors
+// that the server advertises in the "grpc-accept-encoding" response header
+// or trailer. Servers are not required to send it, so it may be empty.
+type acceptEncodingHandler struct {
+	grpcurl.InvocationEventHandler
+
+	mu       sync.Mutex
+	accepted []string
+}
+
+func (h *acceptEncodingHandler) OnReceiveHeaders(md metadata.MD) {
+	h.record(md)
+	h.InvocationEventHandler.OnReceiveHeaders(md)
+}
+
+func (h *acceptEncodingHandler) OnReceiveTrailers(stat *status.Status, md metadata.MD) {
+	h.record(md)
+	h.InvocationEventHandler.OnReceiveTrailers(stat, md)
+}
+
+func (h *acceptEncodingHandler) record(md metadata.MD) {
+	vals := md.Get("grpc-accept-encoding")
+	if len(vals) == 0 {
+		return
+	}
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	h.accepted = nil
+	for _, val := range vals {
+		for _, name := range strings.Split(val, ",") {
+			if name = strings.TrimSpace(name); name != "" {
+				h.accepted = append(h.accepted, name)
+			}
+		}
+	}
+}
+
+// print writes the compressors advertised by the server.
+func (h *acceptEncodingHandler) print(w io.Writer) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	if len(h.accepted) == 0 {
+		fmt.Fprintln(w, "Server compressors: not advertised")
+		return
+	}
+	fmt.Fprintf(w, "Server compressors: %s\n", strings.Join(h.accepted, ", "))
+}
@@ -0,0 +1,122 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"testing"
+
+	"github.com/jhump/protoreflect/dynamic/grpcdynamic"
+	"google.golang.org/grpc"
+	"google.golang.org/protobuf/types/known/wrapperspb"
+)
+
+// compressorRecordingChannel records the compressor used by each call.
+type compressorRecordingChannel struct {
+	grpcdynamic.Channel
+	compressors []string
+}
+
+func compressorOf(opts []grpc.CallOption) string {
+	name := "identity"
+	for _, opt := range opts {
+		if opt, ok := opt.(grpc.CompressorCallOption); ok {
+			name = opt.CompressorType
+		}
+	}
+	return name
+}
+
+func (c *compressorRecordingChannel) Invoke(_ context.Context, _ string, _, _ interface{}, opts ...grpc.CallOption) error {
+	c.compressors = append(c.compressors, compressorOf(opts))
+	return nil
+}
+
+func (c *compressorRecordingChannel) NewStream(_ context.Context, _ *grpc.StreamDesc, _ string, opts ...grpc.CallOption) (grpc.ClientStream, error) {
+	c.compressors = append(c.compressors, compressorOf(opts))
+	return nopClientStream{}, nil
+}
+
+type nopClientStream struct {
+	grpc.ClientStream
+}
+
+func (nopClientStream) SendMsg(interface{}) error {
+	return nil
+}
+
+func TestCompressorCallOptions(t *testing.T) {
+	testCases := []struct {
+		name       string
+		compressor string
+		errMsg     string
+	}{
+		{name: "identity", compressor: "identity"},
+		{name: "gzip", compressor: "gzip"},
+		{name: "nope", errMsg: `unknown compressor "nope"`},
+	}
+	for _, tc := range testCases {
+		opts, err := compressorCallOptions(tc.name)
+		if tc.errMsg != "" {
+			if err == nil || !strings.Contains(err.Error(), tc.errMsg) {
+				t.Errorf("%s: expecting error containing %q, got %v", tc.name, tc.errMsg, err)
+			}
+			continue
+		}
+		if err != nil {
+			t.Errorf("%s: unexpected error: %v", tc.name, err)
+		} else if got := compressorOf(opts); got != tc.compressor {
+			t.Errorf("%s: expecting compressor %q, got %q", tc.name, tc.compressor, got)
+		}
+	}
+}
+
+func TestCompressThresholdChannelUnary(t *testing.T) {
+	testCases := []struct {
+		value      string
+		compressor string
+	}{
+		// a string field of n bytes is encoded in n+2 bytes
+		{value: "", compressor: "identity"},
+		{value: "1234567", compressor: "identity"},
+		{value: "12345678", compressor: "gzip"},
+		{value: strings.Repeat("x", 1000), compressor: "gzip"},
+	}
+	for _, tc := range testCases {
+		rec := &compressorRecordingChannel{}
+		ch := &compressThresholdChannel{Channel: rec, compressor: "gzip", minSize: 10, warnf: func(string, ...interface{}) {
+			t.Errorf("unexpected warning for unary call")
+		}}
+		err := ch.Invoke(context.Background(), "/svc/Method", wrapperspb.String(tc.value), &wrapperspb.StringValue{})
+		if err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+		if len(rec.compressors) != 1 || rec.compressors[0] != tc.compressor {
+			t.Errorf("request of %d bytes: expecting compressor %q, got %v", len(tc.value)+2, tc.compressor, rec.compressors)
+		}
+	}
+}
+
+func TestCompressThresholdChannelStream(t *testing.T) {
+	rec := &compressorRecordingChannel{}
+	var warnings []string
+	ch := &compressThresholdChannel{Channel: rec, compressor: "gzip", minSize: 10, warnf: func(msg string, args ...interface{}) {
+		warnings = append(warnings, fmt.Sprintf(msg, args...))
+	}}
+	str, err := ch.NewStream(context.Background(), &grpc.StreamDesc{ClientStreams: true}, "/svc/Method")
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	for _, val := range []string{strings.Repeat("x", 100), "abc", "def"} {
+		if err := str.SendMsg(wrapperspb.String(val)); err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+	}
+	if len(rec.compressors) != 1 || rec.compressors[0] != "gzip" {
+		t.Errorf("expecting stream to be compressed with gzip, got %v", rec.compressors)
+	}
+	// only the first small message is reported
+	if len(warnings) != 1 || !strings.Contains(warnings[0], "request message of 5 bytes") {
+		t.Errorf("expecting one warning about a 5 byte message, got %q", warnings)
+	}
+}
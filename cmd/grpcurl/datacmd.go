@@ -0,0 +1,79 @@
+package main
+
+import (
+	"fmt"
+	"io"
+	"os"
+	"os/exec"
+	"sync"
+)
+
+// dataCommand is an external command whose stdout is the request data. The
+// command runs concurrently with the RPC, so a generator can feed a stream of
+// requests without writing them all to a file first. Its stderr is relayed to
+// this process's.
+type dataCommand struct {
+	command string
+	cmd     *exec.Cmd
+	stdout  io.ReadCloser
+
+	mu   sync.Mutex
+	done bool
+	err  error
+}
+
+// startDataCommand starts the given shell command.
+func startDataCommand(command string) (*dataCommand, error) {
+	cmd := shellCommand(command)
+	cmd.Stderr = os.Stderr
+	stdout, err := cmd.StdoutPipe()
+	if err != nil {
+		return nil, err
+	}
+	if err := cmd.Start(); err != nil {
+		return nil, err
+	}
+	return &dataCommand{command: command, cmd: cmd, stdout: stdout}, nil
+}
+
+// Read reads the command's output. When the output ends, it waits for the
+// command to exit. If the command fails, Read returns an error instead of
+// io.EOF, so that a partial stream of requests is not sent as if it were
+// complete.
+func (c *dataCommand) Read(p []byte) (int, error) {
+	n, err := c.stdout.Read(p)
+	if err == io.EOF {
+		if waitErr := c.wait(); waitErr != nil {
+			return n, waitErr
+		}
+	}
+	return n, err
+}
+
+func (c *dataCommand) wait() error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if !c.done {
+		c.done = true
+		if err := c.cmd.Wait(); err != nil {
+			if exitErr, ok := err.(*exec.ExitError); ok {
+				c.err = fmt.Errorf("request data command %q exited with status %d", c.command, exitErr.ExitCode())
+			} else {
+				c.err = fmt.Errorf("request data command %q failed: %v", c.command, err)
+			}
+		}
+	}
+	return c.err
+}
+
+// stop kills the command if it is still running, such as when the RPC ends
+// before all of its output has been read.
+func (c *dataCommand) stop() {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if !c.done {
+		c.done = true
+		_ = c.cmd.Process.Kill()
+		_ = c.cmd.Wait()
+	}
+}
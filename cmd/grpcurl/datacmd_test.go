@@ -0,0 +1,50 @@
+package main
+
+import (
+	"io"
+	"runtime"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestDataCommand(t *testing.T) {
+	if runtime.GOOS == "windows" {
+		t.Skip("test commands use a POSIX shell")
+	}
+
+	dc, err := startDataCommand(`printf '{"a": 1}\n{"a": 2}\n'`)
+	if err != nil {
+		t.Fatalf("failed to start command: %v", err)
+	}
+	out, err := io.ReadAll(dc)
+	if err != nil {
+		t.Fatalf("failed to read output: %v", err)
+	}
+	if string(out) != "{\"a\": 1}\n{\"a\": 2}\n" {
+		t.Errorf("wrong output: %q", out)
+	}
+	dc.stop() // no-op, since the command already exited
+
+	dc, err = startDataCommand(`echo '{}'; exit 3`)
+	if err != nil {
+		t.Fatalf("failed to start command: %v", err)
+	}
+	out, err = io.ReadAll(dc)
+	if err == nil || !strings.Contains(err.Error(), "exited with status 3") {
+		t.Errorf("expecting error for non-zero status, got %v", err)
+	}
+	if string(out) != "{}\n" {
+		t.Errorf("wrong output: %q", out)
+	}
+
+	dc, err = startDataCommand(`sleep 30`)
+	if err != nil {
+		t.Fatalf("failed to start command: %v", err)
+	}
+	start := time.Now()
+	dc.stop()
+	if elapsed := time.Since(start); elapsed > 10*time.Second {
+		t.Errorf("stop should kill the command, but took %v", elapsed)
+	}
+}
@@ -0,0 +1,120 @@
+package main
+
+import (
+	"fmt"
+	"io"
+	"sort"
+	"strings"
+
+	"github.com/golang/protobuf/proto" //lint:ignore SA1019 we have to import this because it appears in exported API
+	"github.com/jhump/protoreflect/desc"
+	"github.com/jhump/protoreflect/dynamic"
+
+	"github.com/fullstorydev/grpcurl"
+)
+
+// deprecatedMethodUsage describes the use of the given method if it, or the
+// service that defines it, is marked deprecated. It returns nil otherwise.
+func deprecatedMethodUsage(mtd *desc.MethodDescriptor) []string {
+	var usage []string
+	if mtd.GetService().GetServiceOptions().GetDeprecated() {
+		usage = append(usage, fmt.Sprintf("service %s is deprecated", mtd.GetService().GetFullyQualifiedName()))
+	}
+	if mtd.GetMethodOptions().GetDeprecated() {
+		usage = append(usage, fmt.Sprintf("method %s is deprecated", mtd.GetFullyQualifiedName()))
+	}
+	return usage
+}
+
+// deprecatedFieldUsage describes each field that is set in the given message,
+// including in nested messages, that is marked deprecated. It also reports
+// the use of deprecated enum values. Fields are identified by their path in
+// the message, such as "items[0].name".
+func deprecatedFieldUsage(msg proto.Message) []string {
+	dm, ok := msg.(*dynamic.Message)
+	if !ok {
+		// well-known types, which may not be dynamic, have no deprecated fields
+		return nil
+	}
+	var usage []string
+	addDeprecatedFieldUsage(dm, "", &usage)
+	return usage
+}
+
+func addDeprecatedFieldUsage(dm *dynamic.Message, prefix string, usage *[]string) {
+	for _, fld := range dm.GetKnownFields() {
+		if !dm.HasField(fld) {
+			continue
+		}
+		path := prefix + fld.GetName()
+		if fld.GetFieldOptions().GetDeprecated() {
+			*usage = append(*usage, fmt.Sprintf("field %s (%s) is deprecated", path, fld.GetFullyQualifiedName()))
+		}
+		val := dm.GetField(fld)
+		switch {
+		case fld.IsMap():
+			entries := val.(map[interface{}]interface{})
+			keys := make([]string, 0, len(entries))
+			byKey := make(map[string]interface{}, len(entries))
+			for k, v := range entries {
+				key := fmt.Sprint(k)
+				keys = append(keys, key)
+				byKey[key] = v
+			}
+			// sorted, so the report is stable
+			sort.Strings(keys)
+			for _, k := range keys {
+				addDeprecatedValueUsage(fld.GetMapValueType(), byKey[k], fmt.Sprintf("%s[%s]", path, k), usage)
+			}
+		case fld.IsRepeated():
+			for i, v := range val.([]interface{}) {
+				addDeprecatedValueUsage(fld, v, fmt.Sprintf("%s[%d]", path, i), usage)
+			}
+		default:
+			addDeprecatedValueUsage(fld, val, path, usage)
+		}
+	}
+}
+
+func addDeprecatedValueUsage(fld *desc.FieldDescriptor, val interface{}, path string, usage *[]string) {
+	if et := fld.GetEnumType(); et != nil {
+		num, _ := val.(int32)
+		if ev := et.FindValueByNumber(num); ev != nil && ev.GetEnumValueOptions().GetDeprecated() {
+			*usage = append(*usage, fmt.Sprintf("enum value %s of field %s is deprecated", ev.GetFullyQualifiedName(), path))
+		}
+	} else if dm, ok := val.(*dynamic.Message); ok {
+		addDeprecatedFieldUsage(dm, path+".", usage)
+	}
+}
+
+// deprecationCheckingParser wraps a request parser so that the use of
+// deprecated fields in each request message is reported. If fail is true, the
+// first message that uses deprecated fields causes an error, so it is not
+// sent. Each use is only reported once, even if several messages in a stream
+// have it.
+type deprecationCheckingParser struct {
+	grpcurl.RequestParser
+	errOut   io.Writer
+	fail     bool
+	reported map[string]bool
+}
+
+func (p *deprecationCheckingParser) Next(m proto.Message) error {
+	if err := p.RequestParser.Next(m); err != nil {
+		return err
+	}
+	usage := deprecatedFieldUsage(m)
+	if len(usage) == 0 {
+		return nil
+	}
+	if p.fail {
+		return fmt.Errorf("request message %d uses deprecated schema elements (-fail-deprecated): %s", p.RequestParser.NumRequests(), strings.Join(usage, "; "))
+	}
+	for _, u := range usage {
+		if !p.reported[u] {
+			p.reported[u] = true
+			fmt.Fprintf(p.errOut, "Warning: request message %d: %s\n", p.RequestParser.NumRequests(), u)
+		}
+	}
+	return nil
+}
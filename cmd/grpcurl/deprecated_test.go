@@ -0,0 +1,90 @@
+package main
+
+import (
+	"bytes"
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/jhump/protoreflect/desc/protoparse"
+	"github.com/jhump/protoreflect/dynamic"
+
+	"github.com/fullstorydev/grpcurl"
+)
+
+const deprecatedProto = `
+syntax = "proto3";
+package dep;
+enum Color {
+  RED = 0;
+  GREEN = 1 [deprecated = true];
+}
+message Item {
+  string name = 1;
+  string label = 2 [deprecated = true];
+  Color color = 3;
+}
+message Request {
+  string id = 1;
+  int32 old_id = 2 [deprecated = true];
+  repeated Item items = 3;
+  map<string, Item> by_name = 4;
+}
+service Svc {
+  rpc Current(Request) returns (Request);
+  rpc Old(Request) returns (Request) { option deprecated = true; }
+}
+`
+
+func TestDeprecatedUsage(t *testing.T) {
+	fds, err := (&protoparse.Parser{
+		Accessor: protoparse.FileContentsFromMap(map[string]string{"dep.proto": deprecatedProto}),
+	}).ParseFiles("dep.proto")
+	if err != nil {
+		t.Fatalf("failed to parse proto: %v", err)
+	}
+	svc := fds[0].FindService("dep.Svc")
+	if usage := deprecatedMethodUsage(svc.FindMethodByName("Current")); len(usage) != 0 {
+		t.Errorf("unexpected usage for current method: %v", usage)
+	}
+	if usage := deprecatedMethodUsage(svc.FindMethodByName("Old")); len(usage) != 1 || usage[0] != "method dep.Svc.Old is deprecated" {
+		t.Errorf("wrong usage for deprecated method: %v", usage)
+	}
+
+	md := fds[0].FindMessage("dep.Request")
+	input := `{"id": "a", "items": [{"name": "x"}]}
+		{"oldId": 1, "items": [{"name": "x"}, {"label": "y", "color": "GREEN"}], "byName": {"k": {"label": "z"}}}`
+	var errOut bytes.Buffer
+	rp := &deprecationCheckingParser{
+		RequestParser: grpcurl.NewJSONRequestParser(strings.NewReader(input), nil),
+		errOut:        &errOut,
+		reported:      map[string]bool{},
+	}
+	for i := 0; i < 2; i++ {
+		if err := rp.Next(dynamic.NewMessage(md)); err != nil {
+			t.Fatalf("msg %d: unexpected error: %v", i, err)
+		}
+	}
+	expected := []string{
+		"Warning: request message 2: field old_id (dep.Request.old_id) is deprecated",
+		"Warning: request message 2: field items[1].label (dep.Item.label) is deprecated",
+		"Warning: request message 2: enum value dep.Color.GREEN of field items[1].color is deprecated",
+		"Warning: request message 2: field by_name[k].label (dep.Item.label) is deprecated",
+	}
+	if lines := strings.Split(strings.TrimSpace(errOut.String()), "\n"); !reflect.DeepEqual(lines, expected) {
+		t.Errorf("wrong warnings:\nexpected: %q\ngot:      %q", expected, lines)
+	}
+
+	rp = &deprecationCheckingParser{
+		RequestParser: grpcurl.NewJSONRequestParser(strings.NewReader(input), nil),
+		errOut:        &errOut,
+		fail:          true,
+		reported:      map[string]bool{},
+	}
+	if err := rp.Next(dynamic.NewMessage(md)); err != nil {
+		t.Fatalf("unexpected error for message without deprecated fields: %v", err)
+	}
+	if err := rp.Next(dynamic.NewMessage(md)); err == nil || !strings.Contains(err.Error(), "field old_id") {
+		t.Errorf("expecting error for deprecated fields, got %v", err)
+	}
+}
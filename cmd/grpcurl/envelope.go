@@ -0,0 +1,152 @@
+package main
+
+import (
+	"encoding/json"
+	"io"
+	"sync"
+	"time"
+
+	"github.com/golang/protobuf/jsonpb" //lint:ignore SA1019 we have to import this because it appears in exported API
+	"github.com/golang/protobuf/proto"  //lint:ignore SA1019 we have to import this because it appears in exported API
+	"github.com/jhump/protoreflect/desc"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/status"
+
+	"github.com/fullstorydev/grpcurl"
+)
+
+// envelope is the JSON document written by -envelope. It captures everything
+// about a call: the metadata sent and received, the responses, the final
+// status, and when things happened. Times are in milliseconds since the
+// request headers were sent.
+type envelope struct {
+	Method          string            `json:"method"`
+	RequestHeaders  json.RawMessage   `json:"requestHeaders"`
+	RequestCount    int               `json:"requestCount"`
+	ResponseHeaders json.RawMessage   `json:"responseHeaders"`
+	Responses       []json.RawMessage `json:"responses"`
+	Trailers        json.RawMessage   `json:"trailers"`
+	Status          envelopeStatus    `json:"status"`
+	Timing          envelopeTiming    `json:"timing"`
+}
+
+type envelopeStatus struct {
+	Code    string            `json:"code"`
+	Message string            `json:"message,omitempty"`
+	Details []json.RawMessage `json:"details,omitempty"`
+}
+
+type envelopeTiming struct {
+	StartTime       string    `json:"startTime"`
+	HeadersMs       *float64  `json:"headersMs,omitempty"`
+	FirstResponseMs *float64  `json:"firstResponseMs,omitempty"`
+	ResponsesMs     []float64 `json:"responsesMs"`
+	TotalMs         float64   `json:"totalMs"`
+}
+
+// envelopeHandler is an event handler that records all events of a call, so
+// they can be printed as a single envelope once the call completes. All
+// events are also passed to the wrapped handler.
+type envelopeHandler struct {
+	grpcurl.InvocationEventHandler
+	marshaler jsonpb.Marshaler
+
+	mu    sync.Mutex
+	start time.Time
+	env   envelope
+}
+
+func newEnvelopeHandler(handler grpcurl.InvocationEventHandler, emitDefaults, origName bool, resolver jsonpb.AnyResolver) *envelopeHandler {
+	return &envelopeHandler{
+		InvocationEventHandler: handler,
+		marshaler:              jsonpb.Marshaler{EmitDefaults: emitDefaults, OrigName: origName, AnyResolver: resolver},
+		start:                  time.Now(),
+		env: envelope{
+			RequestHeaders:  json.RawMessage("{}"),
+			ResponseHeaders: json.RawMessage("{}"),
+			Responses:       []json.RawMessage{},
+			Trailers:        json.RawMessage("{}"),
+		},
+	}
+}
+
+func (h *envelopeHandler) OnResolveMethod(md *desc.MethodDescriptor) {
+	h.mu.Lock()
+	h.env.Method = md.GetFullyQualifiedName()
+	h.mu.Unlock()
+	h.InvocationEventHandler.OnResolveMethod(md)
+}
+
+func (h *envelopeHandler) OnSendHeaders(md metadata.MD) {
+	h.mu.Lock()
+	h.start = time.Now()
+	h.env.RequestHeaders = json.RawMessage(grpcurl.MetadataToJSON(md))
+	h.mu.Unlock()
+	h.InvocationEventHandler.OnSendHeaders(md)
+}
+
+func (h *envelopeHandler) OnReceiveHeaders(md metadata.MD) {
+	h.mu.Lock()
+	elapsed := h.elapsedMs()
+	h.env.Timing.HeadersMs = &elapsed
+	h.env.ResponseHeaders = json.RawMessage(grpcurl.MetadataToJSON(md))
+	h.mu.Unlock()
+	h.InvocationEventHandler.OnReceiveHeaders(md)
+}
+
+func (h *envelopeHandler) OnReceiveResponse(resp proto.Message) {
+	h.mu.Lock()
+	elapsed := h.elapsedMs()
+	if h.env.Timing.FirstResponseMs == nil {
+		h.env.Timing.FirstResponseMs = &elapsed
+	}
+	h.env.Timing.ResponsesMs = append(h.env.Timing.ResponsesMs, elapsed)
+	h.env.Responses = append(h.env.Responses, h.marshal(resp))
+	h.mu.Unlock()
+	h.InvocationEventHandler.OnReceiveResponse(resp)
+}
+
+func (h *envelopeHandler) OnReceiveTrailers(stat *status.Status, md metadata.MD) {
+	h.mu.Lock()
+	h.env.Timing.TotalMs = h.elapsedMs()
+	h.env.Trailers = json.RawMessage(grpcurl.MetadataToJSON(md))
+	h.env.Status = envelopeStatus{Code: stat.Code().String(), Message: stat.Message()}
+	for _, d := range stat.Proto().GetDetails() {
+		h.env.Status.Details = append(h.env.Status.Details, h.marshal(d))
+	}
+	h.mu.Unlock()
+	h.InvocationEventHandler.OnReceiveTrailers(stat, md)
+}
+
+// marshal returns the given message as JSON. If it cannot be marshaled, such
+// as an Any whose type is unknown, the result is an object with an "error"
+// property.
+func (h *envelopeHandler) marshal(m proto.Message) json.RawMessage {
+	str, err := h.marshaler.MarshalToString(m)
+	if err != nil {
+		b, _ := json.Marshal(map[string]string{"error": err.Error()})
+		return b
+	}
+	return json.RawMessage(str)
+}
+
+func (h *envelopeHandler) elapsedMs() float64 {
+	return float64(time.Since(h.start)) / float64(time.Millisecond)
+}
+
+// print writes the envelope as a single JSON document, on one line if
+// compact is true.
+func (h *envelopeHandler) print(out io.Writer, requestCount int, compact bool) error {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	h.env.RequestCount = requestCount
+	h.env.Timing.StartTime = h.start.Format(time.RFC3339Nano)
+	if h.env.Timing.ResponsesMs == nil {
+		h.env.Timing.ResponsesMs = []float64{}
+	}
+	enc := json.NewEncoder(out)
+	if !compact {
+		enc.SetIndent("", "  ")
+	}
+	return enc.Encode(h.env)
+}
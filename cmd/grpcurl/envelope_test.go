@@ -0,0 +1,82 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"io"
+	"reflect"
+	"strings"
+	"testing"
+
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/status"
+	"google.golang.org/protobuf/types/known/wrapperspb"
+
+	"github.com/fullstorydev/grpcurl"
+)
+
+func TestEnvelopeHandler(t *testing.T) {
+	h := &grpcurl.DefaultEventHandler{Out: io.Discard, Formatter: grpcurl.NewJSONFormatter(false, nil)}
+	env := newEnvelopeHandler(h, false, false, nil)
+
+	env.OnSendHeaders(metadata.Pairs("authorization", "Bearer x", "trace-bin", "\x01\x02"))
+	env.OnReceiveHeaders(metadata.Pairs("server", "test"))
+	env.OnReceiveResponse(wrapperspb.String("one"))
+	env.OnReceiveResponse(wrapperspb.String("two"))
+	stat, err := status.New(codes.NotFound, "missing").WithDetails(wrapperspb.Int32(42))
+	if err != nil {
+		t.Fatalf("failed to add status details: %v", err)
+	}
+	env.OnReceiveTrailers(stat, metadata.Pairs("t", "v"))
+
+	var buf bytes.Buffer
+	if err := env.print(&buf, 3, true); err != nil {
+		t.Fatalf("failed to print envelope: %v", err)
+	}
+	if strings.Count(buf.String(), "\n") != 1 {
+		t.Errorf("compact envelope should be a single line, got:\n%s", buf.String())
+	}
+	var doc struct {
+		envelope
+		// decoded as values, instead of raw JSON, for comparison
+		RequestHeaders map[string][]string `json:"requestHeaders"`
+		Responses      []string            `json:"responses"`
+		Status         struct {
+			Code    string                   `json:"code"`
+			Message string                   `json:"message"`
+			Details []map[string]interface{} `json:"details"`
+		} `json:"status"`
+	}
+	if err := json.Unmarshal(buf.Bytes(), &doc); err != nil {
+		t.Fatalf("envelope is not valid JSON: %v", err)
+	}
+
+	expectedHeaders := map[string][]string{"authorization": {"Bearer x"}, "trace-bin": {"AQI="}}
+	if !reflect.DeepEqual(doc.RequestHeaders, expectedHeaders) {
+		t.Errorf("wrong request headers: %v", doc.RequestHeaders)
+	}
+	if doc.RequestCount != 3 {
+		t.Errorf("wrong request count: %d", doc.RequestCount)
+	}
+	if !reflect.DeepEqual(doc.Responses, []string{"one", "two"}) {
+		t.Errorf("wrong responses: %v", doc.Responses)
+	}
+	if doc.Status.Code != "NotFound" || doc.Status.Message != "missing" {
+		t.Errorf("wrong status: %+v", doc.Status)
+	}
+	if len(doc.Status.Details) != 1 || doc.Status.Details[0]["@type"] != "type.googleapis.com/google.protobuf.Int32Value" {
+		t.Errorf("wrong status details: %v", doc.Status.Details)
+	}
+	timing := doc.Timing
+	if timing.StartTime == "" || timing.HeadersMs == nil || timing.FirstResponseMs == nil || len(timing.ResponsesMs) != 2 {
+		t.Errorf("missing timing fields: %+v", timing)
+	} else if *timing.FirstResponseMs != timing.ResponsesMs[0] || timing.TotalMs < timing.ResponsesMs[1] {
+		t.Errorf("inconsistent timing fields: %+v", timing)
+	}
+
+	// events are also passed to the wrapped handler
+	if h.NumResponses != 2 || h.Status.Code() != codes.NotFound {
+		t.Errorf("wrapped handler did not see events: %d responses, status %v", h.NumResponses, h.Status)
+	}
+}
@@ -0,0 +1,41 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"sort"
+
+	"github.com/jhump/protoreflect/desc"
+
+	"github.com/fullstorydev/grpcurl"
+)
+
+// describeExtensions writes the extensions of the given message type, as
+// reported by the source, to out. They are written as an extend block, with
+// the type and number of each extension, sorted by number.
+func describeExtensions(out io.Writer, descSource grpcurl.DescriptorSource, md *desc.MessageDescriptor) error {
+	exts, err := descSource.AllExtensionsForType(md.GetFullyQualifiedName())
+	if err != nil {
+		if errors.Is(err, grpcurl.ErrReflectionNotSupported) {
+			// the type was already resolved, so reflection is supported, but
+			// not the request for the extension numbers of a type
+			return errors.New("server reflection does not support listing the extensions of a message type; use -proto or -protoset files instead")
+		}
+		return err
+	}
+	if len(exts) == 0 {
+		fmt.Fprintln(out, "(No extensions)")
+		return nil
+	}
+	exts = append([]*desc.FieldDescriptor(nil), exts...)
+	sort.Slice(exts, func(i, j int) bool {
+		return exts[i].GetNumber() < exts[j].GetNumber()
+	})
+	fmt.Fprintf(out, "extend %s {\n", md.GetFullyQualifiedName())
+	for _, ext := range exts {
+		fmt.Fprintf(out, "  %s %s = %d;\n", fieldTypeName(ext), ext.GetFullyQualifiedName(), ext.GetNumber())
+	}
+	fmt.Fprintln(out, "}")
+	return nil
+}
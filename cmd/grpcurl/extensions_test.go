@@ -0,0 +1,72 @@
+package main
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+
+	"github.com/jhump/protoreflect/desc"
+	"github.com/jhump/protoreflect/desc/protoparse"
+
+	"github.com/fullstorydev/grpcurl"
+)
+
+// noExtensionNumbersSource is a descriptor source like a server whose
+// reflection service does not support requests for extension numbers.
+type noExtensionNumbersSource struct {
+	grpcurl.DescriptorSource
+}
+
+func (noExtensionNumbersSource) AllExtensionsForType(string) ([]*desc.FieldDescriptor, error) {
+	return nil, grpcurl.ErrReflectionNotSupported
+}
+
+func TestDescribeExtensions(t *testing.T) {
+	fds, err := (&protoparse.Parser{
+		Accessor: protoparse.FileContentsFromMap(map[string]string{"options.proto": optionsProto}),
+	}).ParseFiles("options.proto")
+	if err != nil {
+		t.Fatalf("failed to parse proto: %v", err)
+	}
+	source, err := grpcurl.DescriptorSourceFromFileDescriptors(fds...)
+	if err != nil {
+		t.Fatalf("failed to create descriptor source: %v", err)
+	}
+	md := fds[0].GetDependencies()[0].FindMessage("google.protobuf.MethodOptions")
+
+	var buf bytes.Buffer
+	if err := describeExtensions(&buf, source, md); err != nil {
+		t.Fatalf("failed to describe extensions: %v", err)
+	}
+	expected := `extend google.protobuf.MethodOptions {
+  string opts.auth_scope = 50001;
+  opts.RateLimit opts.rate_limit = 50002;
+}
+`
+	if buf.String() != expected {
+		t.Errorf("wrong extensions:\nexpected:\n%s\ngot:\n%s", expected, buf.String())
+	}
+
+	err = describeExtensions(&buf, noExtensionNumbersSource{source}, md)
+	if err == nil || !strings.Contains(err.Error(), "does not support listing the extensions") {
+		t.Errorf("expecting error about unsupported extension numbers, got %v", err)
+	}
+}
+
+func TestDescribeExtensionsProtoset(t *testing.T) {
+	source, err := grpcurl.DescriptorSourceFromProtoSets("../../internal/testing/example.protoset")
+	if err != nil {
+		t.Fatalf("failed to load protoset: %v", err)
+	}
+	d, err := source.FindSymbol("TestRequest")
+	if err != nil {
+		t.Fatalf("failed to find message: %v", err)
+	}
+	var buf bytes.Buffer
+	if err := describeExtensions(&buf, source, d.(*desc.MessageDescriptor)); err != nil {
+		t.Fatalf("failed to describe extensions: %v", err)
+	}
+	if buf.String() != "(No extensions)\n" {
+		t.Errorf("wrong extensions for message with none: %q", buf.String())
+	}
+}
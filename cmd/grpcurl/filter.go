@@ -0,0 +1,85 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"os"
+	"os/exec"
+	"runtime"
+	"sync"
+)
+
+// responseFilter is an external command through which formatted response
+// messages are piped. The command is started once and each response is
+// written to its stdin. Its stderr is relayed to this process's.
+type responseFilter struct {
+	command string
+	cmd     *exec.Cmd
+	stdin   io.WriteCloser
+	cancel  context.CancelFunc
+
+	mu       sync.Mutex
+	writeErr error
+}
+
+// startResponseFilter starts the given shell command, whose stdout is written
+// to out. If the command exits before all responses are written, the given
+// cancel function is called so that the RPC is abandoned.
+func startResponseFilter(command string, out io.Writer, cancel context.CancelFunc) (*responseFilter, error) {
+	cmd := shellCommand(command)
+	cmd.Stdout = out
+	cmd.Stderr = os.Stderr
+	stdin, err := cmd.StdinPipe()
+	if err != nil {
+		return nil, err
+	}
+	if err := cmd.Start(); err != nil {
+		return nil, err
+	}
+	return &responseFilter{command: command, cmd: cmd, stdin: stdin, cancel: cancel}, nil
+}
+
+// Write sends the given data to the command's stdin. Once a write fails, which
+// usually means the command has exited, the RPC is cancelled and subsequent
+// data is discarded.
+func (f *responseFilter) Write(p []byte) (int, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	if f.writeErr != nil {
+		return len(p), nil
+	}
+	if _, err := f.stdin.Write(p); err != nil {
+		f.writeErr = err
+		f.cancel()
+	}
+	return len(p), nil
+}
+
+// Close closes the command's stdin and waits for it to exit. It returns an
+// error if the command exited early or with a non-zero status.
+func (f *responseFilter) Close() error {
+	_ = f.stdin.Close()
+	err := f.cmd.Wait()
+	if err != nil {
+		if exitErr, ok := err.(*exec.ExitError); ok {
+			return fmt.Errorf("command exited with status %d", exitErr.ExitCode())
+		}
+		return err
+	}
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	if f.writeErr != nil {
+		return fmt.Errorf("command exited before all responses were written: %v", f.writeErr)
+	}
+	return nil
+}
+
+// shellCommand returns a command that runs the given command line using the
+// platform's shell.
+func shellCommand(command string) *exec.Cmd {
+	if runtime.GOOS == "windows" {
+		return exec.Command("cmd", "/C", command)
+	}
+	return exec.Command("sh", "-c", command)
+}
@@ -0,0 +1,93 @@
+package main
+
+import (
+	"bytes"
+	"io"
+	"runtime"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/jhump/protoreflect/desc"
+
+	"github.com/fullstorydev/grpcurl"
+	grpcurl_testing "github.com/fullstorydev/grpcurl/internal/testing"
+)
+
+func TestResponseFilter(t *testing.T) {
+	if runtime.GOOS == "windows" {
+		t.Skip("test commands use a POSIX shell")
+	}
+
+	var out bytes.Buffer
+	filter, err := startResponseFilter("tr a-z A-Z", &out, func() {
+		t.Error("RPC should not be cancelled")
+	})
+	if err != nil {
+		t.Fatalf("failed to start filter: %v", err)
+	}
+	md, err := desc.LoadMessageDescriptorForMessage((*grpcurl_testing.SimpleResponse)(nil))
+	if err != nil {
+		t.Fatalf("failed to load message descriptor: %v", err)
+	}
+	mask, err := grpcurl.NewFieldMask(md, "username")
+	if err != nil {
+		t.Fatalf("failed to create field mask: %v", err)
+	}
+	var handlerOut bytes.Buffer
+	h := &grpcurl.DefaultEventHandler{
+		Out:               &handlerOut,
+		Formatter:         grpcurl.NewJSONFormatter(false, nil),
+		VerbosityLevel:    2,
+		ResponseFieldMask: mask,
+		ResponseOut:       filter,
+	}
+	h.OnReceiveResponse(&grpcurl_testing.SimpleResponse{Username: "abc", OauthScope: "x"})
+	h.OnReceiveResponse(&grpcurl_testing.SimpleResponse{Username: "def", OauthScope: "y"})
+	if err := filter.Close(); err != nil {
+		t.Fatalf("unexpected error from filter: %v", err)
+	}
+	// responses are masked before they are written to the filter
+	if out.String() != "{\n  \"USERNAME\": \"ABC\"\n}\n{\n  \"USERNAME\": \"DEF\"\n}\n" {
+		t.Errorf("wrong filter output: %q", out.String())
+	}
+	// and other output is written to the handler's output
+	if h.NumResponses != 2 || strings.Count(handlerOut.String(), "Estimated response size") != 2 || strings.Contains(handlerOut.String(), "USERNAME") {
+		t.Errorf("responses should be counted but only written to the filter: %d, %q", h.NumResponses, handlerOut.String())
+	}
+}
+
+func TestResponseFilterFailures(t *testing.T) {
+	if runtime.GOOS == "windows" {
+		t.Skip("test commands use a POSIX shell")
+	}
+
+	filter, err := startResponseFilter("cat >/dev/null; exit 3", io.Discard, func() {})
+	if err != nil {
+		t.Fatalf("failed to start filter: %v", err)
+	}
+	_, _ = filter.Write([]byte("{}\n"))
+	if err := filter.Close(); err == nil || err.Error() != "command exited with status 3" {
+		t.Errorf("expecting error for non-zero status, got %v", err)
+	}
+
+	// a filter that exits without reading cancels the RPC once a write fails
+	var cancelled atomic.Bool
+	filter, err = startResponseFilter("exit 0", io.Discard, func() { cancelled.Store(true) })
+	if err != nil {
+		t.Fatalf("failed to start filter: %v", err)
+	}
+	chunk := []byte(strings.Repeat("x", 64*1024))
+	for deadline := time.Now().Add(5 * time.Second); !cancelled.Load() && time.Now().Before(deadline); {
+		if n, err := filter.Write(chunk); n != len(chunk) || err != nil {
+			t.Fatalf("writes should always appear to succeed, got %d, %v", n, err)
+		}
+	}
+	if !cancelled.Load() {
+		t.Fatal("expecting RPC to be cancelled after filter exited")
+	}
+	if err := filter.Close(); err == nil || !strings.Contains(err.Error(), "exited before all responses were written") {
+		t.Errorf("expecting error for early exit, got %v", err)
+	}
+}
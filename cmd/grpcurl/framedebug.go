@@ -0,0 +1,135 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"net"
+	"sync"
+
+	"golang.org/x/net/http2"
+	"golang.org/x/net/http2/hpack"
+	"google.golang.org/grpc/credentials"
+)
+
+// frameDebugCreds wraps transport credentials so that, after the handshake,
+// all HTTP/2 frames sent and received on the connection are printed. This is
+// strictly a debugging aid: frames are decoded from a copy of the bytes on the
+// wire and have no effect on the connection itself.
+type frameDebugCreds struct {
+	credentials.TransportCredentials
+	out io.Writer
+}
+
+func (c *frameDebugCreds) ClientHandshake(ctx context.Context, addr string, rawConn net.Conn) (net.Conn, credentials.AuthInfo, error) {
+	conn, auth, err := c.TransportCredentials.ClientHandshake(ctx, addr, rawConn)
+	if err != nil {
+		return nil, nil, err
+	}
+	return newFrameDebugConn(conn, c.out), auth, nil
+}
+
+func (c *frameDebugCreds) Clone() credentials.TransportCredentials {
+	return &frameDebugCreds{TransportCredentials: c.TransportCredentials.Clone(), out: c.out}
+}
+
+// frameDebugConn copies all data read from and written to the connection into
+// pipes, from which goroutines decode and print HTTP/2 frames.
+type frameDebugConn struct {
+	net.Conn
+	recv, sent *io.PipeWriter
+	closeOnce  sync.Once
+}
+
+func newFrameDebugConn(conn net.Conn, out io.Writer) net.Conn {
+	var mu sync.Mutex
+	recvR, recvW := io.Pipe()
+	sentR, sentW := io.Pipe()
+	go logFrames("recv", recvR, false, out, &mu)
+	go logFrames("send", sentR, true, out, &mu)
+	return &frameDebugConn{Conn: conn, recv: recvW, sent: sentW}
+}
+
+func (c *frameDebugConn) Read(b []byte) (int, error) {
+	n, err := c.Conn.Read(b)
+	if n > 0 {
+		_, _ = c.recv.Write(b[:n])
+	}
+	return n, err
+}
+
+func (c *frameDebugConn) Write(b []byte) (int, error) {
+	n, err := c.Conn.Write(b)
+	if n > 0 {
+		_, _ = c.sent.Write(b[:n])
+	}
+	return n, err
+}
+
+func (c *frameDebugConn) Close() error {
+	c.closeOnce.Do(func() {
+		_ = c.recv.Close()
+		_ = c.sent.Close()
+	})
+	return c.Conn.Close()
+}
+
+func logFrames(direction string, r io.Reader, hasPreface bool, out io.Writer, mu *sync.Mutex) {
+	// we must always drain the pipe, even if we can't decode it, or else
+	// the connection will block
+	defer func() {
+		_, _ = io.Copy(io.Discard, r)
+	}()
+
+	if hasPreface {
+		preface := make([]byte, len(http2.ClientPreface))
+		if _, err := io.ReadFull(r, preface); err != nil {
+			return
+		}
+	}
+	fr := http2.NewFramer(nil, r)
+	fr.SetMaxReadFrameSize(1<<24 - 1)
+	fr.ReadMetaHeaders = hpack.NewDecoder(4096, nil)
+	fr.MaxHeaderListSize = 1<<32 - 1
+	for {
+		f, err := fr.ReadFrame()
+		if err != nil {
+			if err != io.EOF && err != io.ErrClosedPipe {
+				mu.Lock()
+				fmt.Fprintf(out, "[%s] failed to decode frame: %v\n", direction, err)
+				mu.Unlock()
+			}
+			return
+		}
+		mu.Lock()
+		fmt.Fprintf(out, "[%s] %s\n", direction, describeFrame(f))
+		mu.Unlock()
+	}
+}
+
+func describeFrame(f http2.Frame) string {
+	str := f.Header().String()
+	switch f := f.(type) {
+	case *http2.MetaHeadersFrame:
+		for _, hf := range f.Fields {
+			str += fmt.Sprintf("\n    %s: %s", hf.Name, hf.Value)
+		}
+	case *http2.SettingsFrame:
+		_ = f.ForeachSetting(func(s http2.Setting) error {
+			str += fmt.Sprintf("\n    %s", s)
+			return nil
+		})
+	case *http2.WindowUpdateFrame:
+		str += fmt.Sprintf(" increment=%d", f.Increment)
+	case *http2.RSTStreamFrame:
+		str += fmt.Sprintf(" code=%s", f.ErrCode)
+	case *http2.GoAwayFrame:
+		str += fmt.Sprintf(" code=%s last_stream=%d", f.ErrCode, f.LastStreamID)
+		if debug := f.DebugData(); len(debug) > 0 {
+			str += fmt.Sprintf(" debug=%q", debug)
+		}
+	case *http2.PingFrame:
+		str += fmt.Sprintf(" data=%x", f.Data)
+	}
+	return str
+}
@@ -0,0 +1,86 @@
+package main
+
+import (
+	"bytes"
+	"strings"
+	"sync"
+	"testing"
+
+	"golang.org/x/net/http2"
+	"golang.org/x/net/http2/hpack"
+)
+
+func TestLogFrames(t *testing.T) {
+	var headers bytes.Buffer
+	enc := hpack.NewEncoder(&headers)
+	_ = enc.WriteField(hpack.HeaderField{Name: ":path", Value: "/testing.TestService/UnaryCall"})
+	_ = enc.WriteField(hpack.HeaderField{Name: "content-type", Value: "application/grpc"})
+
+	testCases := []struct {
+		name     string
+		write    func(fr *http2.Framer) error
+		expected string
+	}{
+		{
+			name: "settings",
+			write: func(fr *http2.Framer) error {
+				return fr.WriteSettings(http2.Setting{ID: http2.SettingMaxFrameSize, Val: 16384})
+			},
+			expected: "[send] [FrameHeader SETTINGS len=6]\n    [MAX_FRAME_SIZE = 16384]\n",
+		},
+		{
+			name: "headers",
+			write: func(fr *http2.Framer) error {
+				return fr.WriteHeaders(http2.HeadersFrameParam{StreamID: 1, BlockFragment: headers.Bytes(), EndHeaders: true})
+			},
+			expected: "\n    :path: /testing.TestService/UnaryCall\n    content-type: application/grpc\n",
+		},
+		{
+			name:     "window update",
+			write:    func(fr *http2.Framer) error { return fr.WriteWindowUpdate(0, 1024) },
+			expected: "WINDOW_UPDATE len=4] increment=1024\n",
+		},
+		{
+			name:     "rst stream",
+			write:    func(fr *http2.Framer) error { return fr.WriteRSTStream(3, http2.ErrCodeCancel) },
+			expected: "RST_STREAM stream=3 len=4] code=CANCEL\n",
+		},
+		{
+			name:     "goaway",
+			write:    func(fr *http2.Framer) error { return fr.WriteGoAway(5, http2.ErrCodeNo, []byte("bye")) },
+			expected: `GOAWAY len=11] code=NO_ERROR last_stream=5 debug="bye"` + "\n",
+		},
+		{
+			name:     "ping",
+			write:    func(fr *http2.Framer) error { return fr.WritePing(false, [8]byte{1, 2, 3, 4, 5, 6, 7, 8}) },
+			expected: "PING len=8] data=0102030405060708\n",
+		},
+	}
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			var wire bytes.Buffer
+			wire.WriteString(http2.ClientPreface)
+			if err := tc.write(http2.NewFramer(&wire, nil)); err != nil {
+				t.Fatalf("failed to write frame: %v", err)
+			}
+			var out bytes.Buffer
+			logFrames("send", &wire, true, &out, &sync.Mutex{})
+			if !strings.HasPrefix(out.String(), "[send] ") || !strings.HasSuffix(out.String(), tc.expected) {
+				t.Errorf("wrong output: expecting it to end with %q, got %q", tc.expected, out.String())
+			}
+		})
+	}
+}
+
+func TestLogFramesMalformed(t *testing.T) {
+	// a frame header that claims a 1-byte SETTINGS frame, which is invalid
+	wire := bytes.NewReader([]byte{0, 0, 1, 0x4, 0, 0, 0, 0, 0, 0})
+	var out bytes.Buffer
+	logFrames("recv", wire, false, &out, &sync.Mutex{})
+	if !strings.HasPrefix(out.String(), "[recv] failed to decode frame: ") {
+		t.Errorf("expecting decode failure, got %q", out.String())
+	}
+	if wire.Len() != 0 {
+		t.Errorf("expecting input to be drained, but %d bytes remain", wire.Len())
+	}
+}
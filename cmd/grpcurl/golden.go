@@ -0,0 +1,99 @@
+package main
+
+import (
+	"bytes"
+	"fmt"
+	"os"
+	"strings"
+	"sync"
+
+	"github.com/golang/protobuf/proto" //lint:ignore SA1019 we have to import this because it appears in exported API
+
+	"github.com/fullstorydev/grpcurl"
+)
+
+// goldenRecorder wraps a formatter and records every formatted response, so
+// they can be written to or compared with a golden file. Each response is
+// followed by a newline, so a stream of responses is recorded as their
+// concatenation, just like it is printed.
+type goldenRecorder struct {
+	mu  sync.Mutex
+	buf bytes.Buffer
+}
+
+func (g *goldenRecorder) wrap(formatter grpcurl.Formatter) grpcurl.Formatter {
+	return func(m proto.Message) (string, error) {
+		str, err := formatter(m)
+		if err == nil {
+			g.mu.Lock()
+			g.buf.WriteString(str)
+			g.buf.WriteString("\n")
+			g.mu.Unlock()
+		}
+		return str, err
+	}
+}
+
+// write stores the recorded responses in the named file.
+func (g *goldenRecorder) write(fileName string) error {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+	return os.WriteFile(fileName, g.buf.Bytes(), 0666)
+}
+
+// check compares the recorded responses with the contents of the named file.
+// It returns a description of the differences, or the empty string if they
+// are the same.
+func (g *goldenRecorder) check(fileName string) (string, error) {
+	expected, err := os.ReadFile(fileName)
+	if err != nil {
+		return "", err
+	}
+	g.mu.Lock()
+	defer g.mu.Unlock()
+	if bytes.Equal(expected, g.buf.Bytes()) {
+		return "", nil
+	}
+	return lineDiff(string(expected), g.buf.String()), nil
+}
+
+// lineDiff returns a line-oriented diff that turns a into b. Lines only in a
+// are prefixed with "-", lines only in b with "+", and common lines with a
+// space.
+func lineDiff(a, b string) string {
+	x := strings.Split(strings.TrimSuffix(a, "\n"), "\n")
+	y := strings.Split(strings.TrimSuffix(b, "\n"), "\n")
+	// lcs[i][j] is the length of the longest common subsequence of x[i:], y[j:]
+	lcs := make([][]int, len(x)+1)
+	for i := range lcs {
+		lcs[i] = make([]int, len(y)+1)
+	}
+	for i := len(x) - 1; i >= 0; i-- {
+		for j := len(y) - 1; j >= 0; j-- {
+			if x[i] == y[j] {
+				lcs[i][j] = lcs[i+1][j+1] + 1
+			} else if lcs[i+1][j] >= lcs[i][j+1] {
+				lcs[i][j] = lcs[i+1][j]
+			} else {
+				lcs[i][j] = lcs[i][j+1]
+			}
+		}
+	}
+	var sb strings.Builder
+	i, j := 0, 0
+	for i < len(x) || j < len(y) {
+		switch {
+		case i < len(x) && j < len(y) && x[i] == y[j]:
+			fmt.Fprintf(&sb, " %s\n", x[i])
+			i++
+			j++
+		case i < len(x) && (j == len(y) || lcs[i+1][j] >= lcs[i][j+1]):
+			fmt.Fprintf(&sb, "-%s\n", x[i])
+			i++
+		default:
+			fmt.Fprintf(&sb, "+%s\n", y[j])
+			j++
+		}
+	}
+	return sb.String()
+}
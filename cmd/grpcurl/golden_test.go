@@ -0,0 +1,11 @@
+package main
+
+import "testing"
+
+func TestLineDiff(t *testing.T) {
+	diff := lineDiff("a\nb\nc\n", "a\nc\nd\n")
+	expected := " a\n-b\n c\n+d\n"
+	if diff != expected {
+		t.Errorf("wrong diff; expected:\n%s\ngot:\n%s", expected, diff)
+	}
+}
@@ -0,0 +1,313 @@
+package main
+
+import (
+	"flag"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/jhump/protoreflect/desc/protoparse"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/backoff"
+	"google.golang.org/grpc/codes"
+	insecureCreds "google.golang.org/grpc/credentials/insecure"
+	"google.golang.org/grpc/status"
+
+	"github.com/fullstorydev/grpcurl"
+)
+
+func TestFormatStatusLine(t *testing.T) {
+	testCases := []struct {
+		stat     *status.Status
+		expected string
+	}{
+		{stat: status.New(codes.OK, ""), expected: "STATUS: OK"},
+		{stat: status.New(codes.NotFound, "no such widget"), expected: "STATUS: NotFound no such widget"},
+		{stat: status.New(codes.DeadlineExceeded, "context deadline exceeded"), expected: "STATUS: DeadlineExceeded context deadline exceeded"},
+		{stat: status.New(codes.Code(99), ""), expected: "STATUS: Code(99)"},
+	}
+	for _, tc := range testCases {
+		if got := formatStatusLine(tc.stat); got != tc.expected {
+			t.Errorf("expecting %q, got %q", tc.expected, got)
+		}
+	}
+}
+
+func TestParseConnectParams(t *testing.T) {
+	defaults := grpc.ConnectParams{Backoff: backoff.DefaultConfig, MinConnectTimeout: 20 * time.Second}
+	testCases := []struct {
+		spec     string
+		expected func(p *grpc.ConnectParams)
+		errMsg   string
+	}{
+		{spec: "", expected: func(*grpc.ConnectParams) {}},
+		{spec: "base=2s", expected: func(p *grpc.ConnectParams) { p.Backoff.BaseDelay = 2 * time.Second }},
+		{
+			spec: " base=100ms , max=5s,mult=2,jitter=0,min-connect=3s,",
+			expected: func(p *grpc.ConnectParams) {
+				p.Backoff = backoff.Config{BaseDelay: 100 * time.Millisecond, MaxDelay: 5 * time.Second, Multiplier: 2}
+				p.MinConnectTimeout = 3 * time.Second
+			},
+		},
+		{spec: "base", errMsg: `setting "base" should be in 'name=value' form`},
+		{spec: "bogus=1", errMsg: `unknown setting "bogus"`},
+		{spec: "base=soon", errMsg: `invalid value for "base"`},
+		{spec: "base=0s", errMsg: `invalid value for "base": must be positive`},
+		{spec: "mult=0.5", errMsg: `invalid value for "mult": must be at least 1`},
+		{spec: "jitter=1.5", errMsg: `invalid value for "jitter": must be between 0 and 1`},
+		{spec: "base=10s,max=1s", errMsg: "max delay (1s) must not be less than base delay (10s)"},
+	}
+	for _, tc := range testCases {
+		got, err := parseConnectParams(tc.spec)
+		if tc.errMsg != "" {
+			if err == nil || !strings.Contains(err.Error(), tc.errMsg) {
+				t.Errorf("%q: expecting error containing %q, got %v", tc.spec, tc.errMsg, err)
+			}
+			continue
+		}
+		if err != nil {
+			t.Errorf("%q: unexpected error: %v", tc.spec, err)
+			continue
+		}
+		expected := defaults
+		tc.expected(&expected)
+		if *got != expected {
+			t.Errorf("%q: expecting %+v, got %+v", tc.spec, expected, *got)
+		}
+	}
+}
+
+func TestCheckHeaderOn(t *testing.T) {
+	testCases := []struct {
+		val    string
+		errMsg string
+	}{
+		{val: "first"},
+		{val: "all", errMsg: "'all' is not supported, since gRPC sends headers only once per call"},
+		{val: "", errMsg: `"" is not supported; it must be 'first'`},
+		{val: "First", errMsg: `"First" is not supported; it must be 'first'`},
+	}
+	for _, tc := range testCases {
+		err := checkHeaderOn(tc.val)
+		if tc.errMsg == "" {
+			if err != nil {
+				t.Errorf("%q: unexpected error: %v", tc.val, err)
+			}
+		} else if err == nil || !strings.Contains(err.Error(), tc.errMsg) {
+			t.Errorf("%q: expecting error containing %q, got %v", tc.val, tc.errMsg, err)
+		}
+	}
+}
+
+func TestCheckBufferSizes(t *testing.T) {
+	testCases := []struct {
+		args   []string
+		errMsg string
+	}{
+		{},
+		{args: []string{"-write-buffer-size=0", "-read-buffer-size=0"}},
+		{args: []string{"-write-buffer-size=65536", "-read-buffer-size=1024"}},
+		{args: []string{"-write-buffer-size=-1"}, errMsg: "-1 is negative; it must be zero or more"},
+		{args: []string{"-read-buffer-size=-10"}, errMsg: "-10 is negative; it must be zero or more"},
+	}
+	for _, tc := range testCases {
+		fs := flag.NewFlagSet("test", flag.ContinueOnError)
+		var writeSize, readSize optionalIntFlag
+		fs.Var(&writeSize, "write-buffer-size", "")
+		fs.Var(&readSize, "read-buffer-size", "")
+		if err := fs.Parse(tc.args); err != nil {
+			t.Fatalf("%v: failed to parse flags: %v", tc.args, err)
+		}
+		err := checkBufferSize(writeSize)
+		if err == nil {
+			err = checkBufferSize(readSize)
+		}
+		if tc.errMsg == "" {
+			if err != nil {
+				t.Errorf("%v: unexpected error: %v", tc.args, err)
+			}
+		} else if err == nil || err.Error() != tc.errMsg {
+			t.Errorf("%v: expecting error %q, got %v", tc.args, tc.errMsg, err)
+		}
+	}
+}
+
+func TestBalancerServiceConfig(t *testing.T) {
+	testCases := []struct {
+		policy   string
+		expected string
+		errMsg   string
+	}{
+		{policy: ""},
+		{policy: "pick_first", expected: `{"loadBalancingPolicy":"pick_first"}`},
+		{policy: "round_robin", expected: `{"loadBalancingPolicy":"round_robin"}`},
+		{policy: "grpclb", errMsg: `"grpclb" is not supported`},
+	}
+	for _, tc := range testCases {
+		config, err := balancerServiceConfig(tc.policy)
+		if tc.errMsg != "" {
+			if err == nil || !strings.Contains(err.Error(), tc.errMsg) {
+				t.Errorf("%q: expecting error containing %q, got %v", tc.policy, tc.errMsg, err)
+			}
+			continue
+		}
+		if err != nil {
+			t.Errorf("%q: unexpected error: %v", tc.policy, err)
+			continue
+		}
+		if config != tc.expected {
+			t.Errorf("%q: expecting %s, got %s", tc.policy, tc.expected, config)
+		}
+		if config == "" {
+			continue
+		}
+		// dialing fails if the default service config is invalid
+		cc, err := grpc.Dial("passthrough:///127.0.0.1:0", grpc.WithTransportCredentials(insecureCreds.NewCredentials()), grpc.WithDefaultServiceConfig(config))
+		if err != nil {
+			t.Errorf("%q: service config rejected: %v", tc.policy, err)
+		} else {
+			_ = cc.Close()
+		}
+	}
+}
+
+func TestExitCodeForStatus(t *testing.T) {
+	okCodes, err := parseStatusCodes("NotFound, ALREADY_EXISTS,5")
+	if err != nil {
+		t.Fatalf("failed to parse codes: %v", err)
+	}
+	testCases := []struct {
+		code     codes.Code
+		okCodes  map[codes.Code]bool
+		expected int
+	}{
+		{code: codes.OK, expected: 0},
+		{code: codes.NotFound, expected: statusCodeOffset + 5},
+		{code: codes.Unavailable, expected: statusCodeOffset + 14},
+		{code: codes.OK, okCodes: okCodes, expected: 0},
+		{code: codes.NotFound, okCodes: okCodes, expected: 0},
+		{code: codes.AlreadyExists, okCodes: okCodes, expected: 0},
+		{code: codes.PermissionDenied, okCodes: okCodes, expected: statusCodeOffset + 7},
+	}
+	for _, tc := range testCases {
+		if got := exitCodeForStatus(tc.code, tc.okCodes); got != tc.expected {
+			t.Errorf("%v with ok codes %v: expecting exit code %d, got %d", tc.code, tc.okCodes, tc.expected, got)
+		}
+	}
+}
+
+func TestReadSymbolList(t *testing.T) {
+	file := filepath.Join(t.TempDir(), "symbols.txt")
+	contents := "# services to describe\r\ntesting.TestService\r\n\r\n  testing.SimpleRequest  \n#testing.Ignored\ntesting.Payload"
+	if err := os.WriteFile(file, []byte(contents), 0644); err != nil {
+		t.Fatalf("failed to write symbols file: %v", err)
+	}
+	testCases := []struct {
+		val      string
+		expected []string
+	}{
+		{val: "testing.TestService", expected: []string{"testing.TestService"}},
+		{val: " a.B , c.D,,e.F ", expected: []string{"a.B", "c.D", "e.F"}},
+		{val: ",", expected: nil},
+		{val: "@" + file, expected: []string{"testing.TestService", "testing.SimpleRequest", "testing.Payload"}},
+	}
+	for _, tc := range testCases {
+		got, err := readSymbolList(tc.val)
+		if err != nil {
+			t.Errorf("%q: unexpected error: %v", tc.val, err)
+		} else if !reflect.DeepEqual(got, tc.expected) {
+			t.Errorf("%q: expecting %q, got %q", tc.val, tc.expected, got)
+		}
+	}
+
+	if _, err := readSymbolList("@" + filepath.Join(t.TempDir(), "missing.txt")); err == nil {
+		t.Error("expecting error for missing file")
+	}
+}
+
+// parseSource returns a descriptor source for a file with the given contents.
+func parseSource(t *testing.T, contents string) grpcurl.DescriptorSource {
+	t.Helper()
+	fds, err := (&protoparse.Parser{
+		Accessor: protoparse.FileContentsFromMap(map[string]string{"test.proto": contents}),
+	}).ParseFiles("test.proto")
+	if err != nil {
+		t.Fatalf("failed to parse protos: %v", err)
+	}
+	source, err := grpcurl.DescriptorSourceFromFileDescriptors(fds...)
+	if err != nil {
+		t.Fatalf("failed to create descriptor source: %v", err)
+	}
+	return source
+}
+
+func TestCompositeSourceReportsResolver(t *testing.T) {
+	var resolved []string
+	cs := compositeSource{
+		reflection: parseSource(t, `syntax = "proto3"; package cs; message Both {} message Refl {}`),
+		file:       parseSource(t, `syntax = "proto3"; package cs; message Both {} message File {}`),
+		fileKind:   "protoset files",
+		onResolve: func(symbol, source string) {
+			resolved = append(resolved, symbol+" using "+source)
+		},
+	}
+	for _, symbol := range []string{"cs.Both", "cs.Refl", "cs.File"} {
+		d, err := cs.FindSymbol(symbol)
+		if err != nil {
+			t.Fatalf("failed to find %s: %v", symbol, err)
+		}
+		if d.GetFullyQualifiedName() != symbol {
+			t.Errorf("expecting %s, got %s", symbol, d.GetFullyQualifiedName())
+		}
+	}
+	// symbols that cannot be found are not reported
+	if _, err := cs.FindSymbol("cs.Neither"); err == nil {
+		t.Error("expecting error for unknown symbol")
+	}
+	expected := []string{
+		"cs.Both using server reflection",
+		"cs.Refl using server reflection",
+		"cs.File using protoset files",
+	}
+	if !reflect.DeepEqual(resolved, expected) {
+		t.Errorf("expecting %q, got %q", expected, resolved)
+	}
+}
+
+func TestMethodNeedsRequestData(t *testing.T) {
+	source := parseSource(t, `
+		syntax = "proto3";
+		package rd;
+		import "google/protobuf/empty.proto";
+		message Req { string id = 1; }
+		service Svc {
+			rpc Unary (Req) returns (Req);
+			rpc NoFields (google.protobuf.Empty) returns (Req);
+			rpc ServerStream (Req) returns (stream Req);
+			rpc ClientStream (stream Req) returns (Req);
+		}`)
+	testCases := []struct {
+		symbol   string
+		expected bool
+	}{
+		{symbol: "rd.Svc/Unary", expected: true},
+		{symbol: "rd.Svc.Unary", expected: true},
+		{symbol: "rd.Svc/ServerStream", expected: true},
+		// an empty request is valid when it has no fields to populate
+		{symbol: "rd.Svc/NoFields"},
+		// an empty stream of requests is valid
+		{symbol: "rd.Svc/ClientStream"},
+		// errors are left for the invocation to report
+		{symbol: "rd.Svc/Nope"},
+		{symbol: "rd.Nope/Unary"},
+		{symbol: "rd.Req/Unary"},
+	}
+	for _, tc := range testCases {
+		if got := methodNeedsRequestData(findMethod(source, tc.symbol)); got != tc.expected {
+			t.Errorf("%s: expecting %v, got %v", tc.symbol, tc.expected, got)
+		}
+	}
+}
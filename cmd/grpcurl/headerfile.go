@@ -0,0 +1,29 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"strings"
+)
+
+// readHeaderFile returns the headers in the named file, which has one header
+// per line in 'name: value' format. Blank lines and lines starting with '#'
+// are ignored.
+func readHeaderFile(name string) ([]string, error) {
+	data, err := os.ReadFile(name)
+	if err != nil {
+		return nil, err
+	}
+	var hdrs []string
+	for i, line := range strings.Split(string(data), "\n") {
+		line = strings.TrimSpace(line)
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+		if !strings.Contains(line, ":") {
+			return nil, fmt.Errorf("line %d is not in 'name: value' format", i+1)
+		}
+		hdrs = append(hdrs, line)
+	}
+	return hdrs, nil
+}
@@ -0,0 +1,51 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+
+	"google.golang.org/grpc/metadata"
+
+	"github.com/fullstorydev/grpcurl"
+)
+
+func TestReadHeaderFile(t *testing.T) {
+	name := filepath.Join(t.TempDir(), "headers")
+	contents := `# credentials for the staging environment
+authorization: Bearer ${TOKEN}
+
+x-tenant: acme
+  x-request-source: grpcurl
+`
+	if err := os.WriteFile(name, []byte(contents), 0600); err != nil {
+		t.Fatalf("failed to write header file: %v", err)
+	}
+	hdrs, err := readHeaderFile(name)
+	if err != nil {
+		t.Fatalf("failed to read header file: %v", err)
+	}
+	t.Setenv("TOKEN", "abc123")
+	hdrs, err = grpcurl.ExpandHeaders(hdrs)
+	if err != nil {
+		t.Fatalf("failed to expand headers: %v", err)
+	}
+	md := grpcurl.MetadataFromHeaders(hdrs)
+	expected := metadata.Pairs(
+		"authorization", "Bearer abc123",
+		"x-tenant", "acme",
+		"x-request-source", "grpcurl",
+	)
+	if !reflect.DeepEqual(md, expected) {
+		t.Errorf("wrong metadata: expected %v, got %v", expected, md)
+	}
+
+	if err := os.WriteFile(name, []byte("x-tenant: acme\nbogus\n"), 0600); err != nil {
+		t.Fatalf("failed to write header file: %v", err)
+	}
+	if _, err := readHeaderFile(name); err == nil || !strings.Contains(err.Error(), "line 2") {
+		t.Errorf("expecting error for malformed line 2, got %v", err)
+	}
+}
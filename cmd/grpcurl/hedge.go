@@ -0,0 +1,96 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"time"
+
+	"github.com/golang/protobuf/proto" //lint:ignore SA1019 we have to import this because it appears in exported API
+	"github.com/jhump/protoreflect/dynamic/grpcdynamic"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/metadata"
+)
+
+// hedgingChannel is a channel that hedges unary RPCs: the first attempt is
+// sent immediately and, until one completes, another attempt is sent after
+// each delay, up to a maximum number of attempts. The first attempt to
+// complete, whether it succeeds or fails, determines the outcome and the rest
+// are cancelled. Streaming RPCs are not supported.
+//
+// This is implemented in the client instead of with a service config since
+// grpc-go does not support hedging policies.
+type hedgingChannel struct {
+	grpcdynamic.Channel
+	maxAttempts int
+	delay       time.Duration
+}
+
+type hedgeResult struct {
+	reply   proto.Message
+	header  metadata.MD
+	trailer metadata.MD
+	err     error
+}
+
+func (c *hedgingChannel) Invoke(ctx context.Context, method string, args, reply interface{}, opts ...grpc.CallOption) error {
+	replyMsg, ok := reply.(proto.Message)
+	if !ok {
+		return c.Channel.Invoke(ctx, method, args, reply, opts...)
+	}
+	// header and trailer options are handled for each attempt, so that only
+	// the metadata from the winning attempt is reported
+	var headerAddr, trailerAddr *metadata.MD
+	var otherOpts []grpc.CallOption
+	for _, opt := range opts {
+		switch opt := opt.(type) {
+		case grpc.HeaderCallOption:
+			headerAddr = opt.HeaderAddr
+		case grpc.TrailerCallOption:
+			trailerAddr = opt.TrailerAddr
+		default:
+			otherOpts = append(otherOpts, opt)
+		}
+	}
+
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+	results := make(chan hedgeResult, c.maxAttempts)
+	attempt := func() {
+		res := hedgeResult{reply: proto.Clone(replyMsg)}
+		res.reply.Reset()
+		attemptOpts := append(otherOpts[:len(otherOpts):len(otherOpts)], grpc.Header(&res.header), grpc.Trailer(&res.trailer))
+		res.err = c.Channel.Invoke(ctx, method, args, res.reply, attemptOpts...)
+		results <- res
+	}
+
+	go attempt()
+	attempts := 1
+	timer := time.NewTimer(c.delay)
+	defer timer.Stop()
+	for {
+		select {
+		case res := <-results:
+			if headerAddr != nil {
+				*headerAddr = res.header
+			}
+			if trailerAddr != nil {
+				*trailerAddr = res.trailer
+			}
+			if res.err == nil {
+				replyMsg.Reset()
+				proto.Merge(replyMsg, res.reply)
+			}
+			return res.err
+		case <-timer.C:
+			if attempts < c.maxAttempts {
+				go attempt()
+				attempts++
+				timer.Reset(c.delay)
+			}
+		}
+	}
+}
+
+func (c *hedgingChannel) NewStream(context.Context, *grpc.StreamDesc, string, ...grpc.CallOption) (grpc.ClientStream, error) {
+	return nil, errors.New("hedging (-hedge) is only supported for unary methods")
+}
@@ -0,0 +1,161 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"strconv"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/jhump/protoreflect/dynamic/grpcdynamic"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/status"
+	"google.golang.org/protobuf/types/known/wrapperspb"
+)
+
+// hedgeAttempt describes how fakeHedgeChannel answers one attempt.
+type hedgeAttempt struct {
+	// the attempt completes after this delay; if negative, it never
+	// completes on its own and waits to be cancelled
+	delay time.Duration
+	err   error
+}
+
+// fakeHedgeChannel answers unary calls according to its attempts, in order.
+// The reply value and the "attempt" header and trailer of each attempt are
+// its index.
+type fakeHedgeChannel struct {
+	grpcdynamic.Channel
+	attempts []hedgeAttempt
+
+	mu        sync.Mutex
+	started   int
+	cancelled []int
+}
+
+func (c *fakeHedgeChannel) Invoke(ctx context.Context, _ string, _, reply interface{}, opts ...grpc.CallOption) error {
+	c.mu.Lock()
+	i := c.started
+	c.started++
+	c.mu.Unlock()
+
+	for _, opt := range opts {
+		switch opt := opt.(type) {
+		case grpc.HeaderCallOption:
+			*opt.HeaderAddr = metadata.Pairs("attempt", strconv.Itoa(i))
+		case grpc.TrailerCallOption:
+			*opt.TrailerAddr = metadata.Pairs("attempt", strconv.Itoa(i))
+		}
+	}
+	a := c.attempts[i]
+	var done <-chan time.Time
+	if a.delay >= 0 {
+		done = time.After(a.delay)
+	}
+	select {
+	case <-done:
+	case <-ctx.Done():
+		c.mu.Lock()
+		c.cancelled = append(c.cancelled, i)
+		c.mu.Unlock()
+		return ctx.Err()
+	}
+	if a.err != nil {
+		return a.err
+	}
+	reply.(*wrapperspb.StringValue).Value = strconv.Itoa(i)
+	return nil
+}
+
+func (c *fakeHedgeChannel) startedAttempts() int {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.started
+}
+
+func TestHedgingChannel(t *testing.T) {
+	failed := status.Error(codes.Unavailable, "attempt failed")
+	testCases := []struct {
+		name     string
+		attempts []hedgeAttempt
+		// the index of the attempt that determines the outcome
+		winner int
+		err    error
+	}{
+		{
+			name:     "first attempt wins",
+			attempts: []hedgeAttempt{{delay: 0}, {delay: 0}, {delay: 0}},
+			winner:   0,
+		},
+		{
+			name:     "later attempt wins",
+			attempts: []hedgeAttempt{{delay: -1}, {delay: -1}, {delay: 0}},
+			winner:   2,
+		},
+		{
+			name:     "later attempt fails first",
+			attempts: []hedgeAttempt{{delay: -1}, {delay: 0, err: failed}, {delay: -1}},
+			winner:   1,
+			err:      failed,
+		},
+	}
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			fake := &fakeHedgeChannel{attempts: tc.attempts}
+			ch := &hedgingChannel{Channel: fake, maxAttempts: len(tc.attempts), delay: 20 * time.Millisecond}
+			var reply wrapperspb.StringValue
+			var header, trailer metadata.MD
+			err := ch.Invoke(context.Background(), "/svc/Method", &wrapperspb.StringValue{}, &reply, grpc.Header(&header), grpc.Trailer(&trailer))
+			if !errors.Is(err, tc.err) {
+				t.Fatalf("expecting error %v, got %v", tc.err, err)
+			}
+			winner := strconv.Itoa(tc.winner)
+			if tc.err == nil && reply.Value != winner {
+				t.Errorf("expecting reply from attempt %s, got %q", winner, reply.Value)
+			}
+			if got := header.Get("attempt"); len(got) != 1 || got[0] != winner {
+				t.Errorf("expecting header from attempt %s, got %v", winner, got)
+			}
+			if got := trailer.Get("attempt"); len(got) != 1 || got[0] != winner {
+				t.Errorf("expecting trailer from attempt %s, got %v", winner, got)
+			}
+			if started := fake.startedAttempts(); started != tc.winner+1 {
+				t.Errorf("expecting %d attempts to be sent, got %d", tc.winner+1, started)
+			}
+		})
+	}
+}
+
+func TestHedgingChannelCancelsLosers(t *testing.T) {
+	fake := &fakeHedgeChannel{attempts: []hedgeAttempt{{delay: -1}, {delay: -1}, {delay: 0}}}
+	ch := &hedgingChannel{Channel: fake, maxAttempts: 3, delay: 10 * time.Millisecond}
+	var reply wrapperspb.StringValue
+	if err := ch.Invoke(context.Background(), "/svc/Method", &wrapperspb.StringValue{}, &reply); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	// the losing attempts are cancelled when Invoke returns, but they notice
+	// asynchronously
+	deadline := time.Now().Add(5 * time.Second)
+	for {
+		fake.mu.Lock()
+		n := len(fake.cancelled)
+		fake.mu.Unlock()
+		if n == 2 {
+			break
+		}
+		if time.Now().After(deadline) {
+			t.Fatalf("expecting 2 cancelled attempts, got %d", n)
+		}
+		time.Sleep(time.Millisecond)
+	}
+}
+
+func TestHedgingChannelRejectsStreams(t *testing.T) {
+	ch := &hedgingChannel{Channel: &fakeHedgeChannel{}, maxAttempts: 2}
+	if _, err := ch.NewStream(context.Background(), &grpc.StreamDesc{}, "/svc/Method"); err == nil {
+		t.Error("expecting error for streaming call")
+	}
+}
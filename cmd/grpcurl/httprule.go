@@ -0,0 +1,114 @@
+package main
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/golang/protobuf/proto" //lint:ignore SA1019 we have to import this because it appears in exported API
+	"github.com/jhump/protoreflect/desc"
+	"github.com/jhump/protoreflect/dynamic"
+)
+
+// httpRuleExtension is the name of the method option used by grpc-gateway
+// and similar tools to map a method to an HTTP verb and path.
+const httpRuleExtension = "google.api.http"
+
+// httpBinding is a single HTTP verb and path to which a method is mapped.
+type httpBinding struct {
+	verb, path, body string
+}
+
+// httpBindings returns the HTTP bindings declared on the given method via
+// the google.api.http option. It returns nil if the method does not use the
+// option. The option's definition is found in the files imported by the
+// method's file, since it must be imported in order to be used.
+func httpBindings(mtd *desc.MethodDescriptor) ([]httpBinding, error) {
+	ext := findExtension(mtd.GetFile(), httpRuleExtension, map[string]bool{})
+	if ext == nil {
+		return nil, nil
+	}
+	if ext.GetMessageType() == nil {
+		return nil, fmt.Errorf("%s is not a message extension", httpRuleExtension)
+	}
+	opts := mtd.GetMethodOptions()
+	if opts == nil {
+		return nil, nil
+	}
+	data, err := proto.Marshal(opts)
+	if err != nil {
+		return nil, err
+	}
+	var er dynamic.ExtensionRegistry
+	if err := er.AddExtension(ext); err != nil {
+		return nil, err
+	}
+	dm := dynamic.NewMessageFactoryWithExtensionRegistry(&er).NewDynamicMessage(ext.GetOwner())
+	if err := dm.Unmarshal(data); err != nil {
+		return nil, err
+	}
+	if !dm.HasField(ext) {
+		return nil, nil
+	}
+	rule, ok := dm.GetField(ext).(*dynamic.Message)
+	if !ok {
+		return nil, fmt.Errorf("unexpected type for %s option: %T", httpRuleExtension, dm.GetField(ext))
+	}
+	return appendHTTPBindings(nil, rule), nil
+}
+
+func findExtension(fd *desc.FileDescriptor, name string, seen map[string]bool) *desc.FieldDescriptor {
+	if seen[fd.GetName()] {
+		return nil
+	}
+	seen[fd.GetName()] = true
+	if ext, ok := fd.FindSymbol(name).(*desc.FieldDescriptor); ok && ext.IsExtension() {
+		return ext
+	}
+	for _, dep := range fd.GetDependencies() {
+		if ext := findExtension(dep, name, seen); ext != nil {
+			return ext
+		}
+	}
+	return nil
+}
+
+func appendHTTPBindings(bindings []httpBinding, rule *dynamic.Message) []httpBinding {
+	var b httpBinding
+	for _, verb := range []string{"get", "put", "post", "delete", "patch"} {
+		if path, _ := rule.TryGetFieldByName(verb); path != nil && path != "" {
+			b.verb, b.path = strings.ToUpper(verb), path.(string)
+		}
+	}
+	if custom, _ := rule.TryGetFieldByName("custom"); custom != nil {
+		if custom, ok := custom.(*dynamic.Message); ok && rule.HasFieldName("custom") {
+			kind, _ := custom.TryGetFieldByName("kind")
+			path, _ := custom.TryGetFieldByName("path")
+			b.verb, b.path = fmt.Sprint(kind), fmt.Sprint(path)
+		}
+	}
+	if body, _ := rule.TryGetFieldByName("body"); body != nil {
+		b.body = body.(string)
+	}
+	if b.verb != "" {
+		bindings = append(bindings, b)
+	}
+	if additional, _ := rule.TryGetFieldByName("additional_bindings"); additional != nil {
+		for _, r := range additional.([]interface{}) {
+			if r, ok := r.(*dynamic.Message); ok {
+				bindings = appendHTTPBindings(bindings, r)
+			}
+		}
+	}
+	return bindings
+}
+
+// curlCommand returns a curl command line that invokes the given binding via
+// an HTTP gateway whose base URL is expected in the GATEWAY environment
+// variable. Path parameters are left as placeholders.
+func (b httpBinding) curlCommand() string {
+	cmd := fmt.Sprintf("curl -X %s \"$GATEWAY%s\"", b.verb, b.path)
+	if b.body != "" {
+		cmd += " -H 'Content-Type: application/json' -d @request.json"
+	}
+	return cmd
+}
@@ -0,0 +1,120 @@
+package main
+
+import (
+	"reflect"
+	"testing"
+
+	"github.com/jhump/protoreflect/desc/protoparse"
+)
+
+// httpRuleProto is a trimmed copy of google/api/http.proto and
+// google/api/annotations.proto, with just the fields used by httpBindings.
+const httpRuleProto = `
+	syntax = "proto3";
+	package google.api;
+	import "google/protobuf/descriptor.proto";
+	extend google.protobuf.MethodOptions { HttpRule http = 72295728; }
+	message HttpRule {
+		oneof pattern {
+			string get = 2;
+			string put = 3;
+			string post = 4;
+			string delete = 5;
+			string patch = 6;
+			CustomHttpPattern custom = 8;
+		}
+		string body = 7;
+		repeated HttpRule additional_bindings = 11;
+	}
+	message CustomHttpPattern { string kind = 1; string path = 2; }`
+
+func TestHTTPBindings(t *testing.T) {
+	fds, err := (&protoparse.Parser{
+		Accessor: protoparse.FileContentsFromMap(map[string]string{
+			"google/api/annotations.proto": httpRuleProto,
+			"svc.proto": `
+				syntax = "proto3";
+				package hr;
+				import "google/api/annotations.proto";
+				import "google/protobuf/empty.proto";
+				service Svc {
+					rpc Get (google.protobuf.Empty) returns (google.protobuf.Empty) {
+						option (google.api.http) = { get: "/v1/things/{id}" };
+					}
+					rpc Create (google.protobuf.Empty) returns (google.protobuf.Empty) {
+						option (google.api.http) = {
+							post: "/v1/things"
+							body: "*"
+							additional_bindings { put: "/v1/things/{id}" body: "thing" }
+							additional_bindings { custom: { kind: "HEAD" path: "/v1/things" } }
+						};
+					}
+					rpc Plain (google.protobuf.Empty) returns (google.protobuf.Empty);
+				}`,
+			"nohttp.proto": `
+				syntax = "proto3";
+				package hr;
+				import "google/protobuf/empty.proto";
+				service NoHTTP { rpc Do (google.protobuf.Empty) returns (google.protobuf.Empty); }`,
+		}),
+	}).ParseFiles("svc.proto", "nohttp.proto")
+	if err != nil {
+		t.Fatalf("failed to parse protos: %v", err)
+	}
+	svc, noHTTP := fds[0].GetServices()[0], fds[1].GetServices()[0]
+
+	testCases := []struct {
+		method   string
+		expected []httpBinding
+	}{
+		{
+			method:   "Get",
+			expected: []httpBinding{{verb: "GET", path: "/v1/things/{id}"}},
+		},
+		{
+			method: "Create",
+			expected: []httpBinding{
+				{verb: "POST", path: "/v1/things", body: "*"},
+				{verb: "PUT", path: "/v1/things/{id}", body: "thing"},
+				{verb: "HEAD", path: "/v1/things"},
+			},
+		},
+		{
+			method: "Plain",
+		},
+	}
+	for _, tc := range testCases {
+		bindings, err := httpBindings(svc.FindMethodByName(tc.method))
+		if err != nil {
+			t.Errorf("%s: unexpected error: %v", tc.method, err)
+		} else if !reflect.DeepEqual(bindings, tc.expected) {
+			t.Errorf("%s: expecting bindings %+v, got %+v", tc.method, tc.expected, bindings)
+		}
+	}
+
+	// the option is not defined at all for files that don't import it
+	if bindings, err := httpBindings(noHTTP.GetMethods()[0]); bindings != nil || err != nil {
+		t.Errorf("expecting no bindings, got %+v, %v", bindings, err)
+	}
+}
+
+func TestHTTPBindingCurlCommand(t *testing.T) {
+	testCases := []struct {
+		binding  httpBinding
+		expected string
+	}{
+		{
+			binding:  httpBinding{verb: "GET", path: "/v1/things/{id}"},
+			expected: `curl -X GET "$GATEWAY/v1/things/{id}"`,
+		},
+		{
+			binding:  httpBinding{verb: "POST", path: "/v1/things", body: "*"},
+			expected: `curl -X POST "$GATEWAY/v1/things" -H 'Content-Type: application/json' -d @request.json`,
+		},
+	}
+	for _, tc := range testCases {
+		if got := tc.binding.curlCommand(); got != tc.expected {
+			t.Errorf("expecting %q, got %q", tc.expected, got)
+		}
+	}
+}
@@ -0,0 +1,497 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"math"
+	"net/http"
+	"os"
+	"reflect"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+	"unicode/utf8"
+
+	"github.com/golang/protobuf/proto" //lint:ignore SA1019 we have to import this because it appears in exported API
+
+	"github.com/fullstorydev/grpcurl"
+)
+
+// maxSchemaSize limits the size of a JSON Schema that is read from a file or
+// URL.
+const maxSchemaSize = 4 << 20
+
+// jsonSchema is a JSON Schema against which JSON documents can be validated.
+// Only the core validation keywords are supported: type, enum, const,
+// properties, required, additionalProperties, patternProperties, items,
+// minItems, maxItems, uniqueItems, minProperties, maxProperties, minLength,
+// maxLength, pattern, minimum, maximum, exclusiveMinimum, exclusiveMaximum,
+// multipleOf, allOf, anyOf, oneOf, not, and $ref (for references within the
+// schema, like "#/definitions/foo" or "#/$defs/foo"). Other keywords, such as
+// format, are ignored. Patterns use Go's regular expression syntax.
+type jsonSchema struct {
+	root interface{}
+
+	mu       sync.Mutex
+	patterns map[string]*regexp.Regexp
+}
+
+// loadJSONSchema reads a JSON Schema from the given file. If the name starts
+// with '@', the rest is a file name or an http or https URL from which the
+// schema is fetched.
+func loadJSONSchema(name string) (*jsonSchema, error) {
+	var data []byte
+	var err error
+	if loc := strings.TrimPrefix(name, "@"); strings.HasPrefix(loc, "http://") || strings.HasPrefix(loc, "https://") {
+		data, err = fetchJSONSchema(loc)
+	} else {
+		data, err = os.ReadFile(loc)
+	}
+	if err != nil {
+		return nil, err
+	}
+	return parseJSONSchema(data)
+}
+
+func fetchJSONSchema(url string) ([]byte, error) {
+	client := http.Client{Timeout: 30 * time.Second}
+	resp, err := client.Get(url)
+	if err != nil {
+		return nil, err
+	}
+	defer func() {
+		_ = resp.Body.Close()
+	}()
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("failed to fetch %s: %s", url, resp.Status)
+	}
+	return io.ReadAll(io.LimitReader(resp.Body, maxSchemaSize))
+}
+
+func parseJSONSchema(data []byte) (*jsonSchema, error) {
+	var root interface{}
+	if err := json.Unmarshal(data, &root); err != nil {
+		return nil, fmt.Errorf("schema is not valid JSON: %v", err)
+	}
+	switch root.(type) {
+	case map[string]interface{}, bool:
+	default:
+		return nil, fmt.Errorf("schema must be a JSON object or boolean")
+	}
+	s := &jsonSchema{root: root, patterns: map[string]*regexp.Regexp{}}
+	// report bad patterns up front, instead of as violations
+	if err := s.checkPatterns(root); err != nil {
+		return nil, err
+	}
+	return s, nil
+}
+
+func (s *jsonSchema) checkPatterns(v interface{}) error {
+	switch v := v.(type) {
+	case map[string]interface{}:
+		if p, ok := v["pattern"].(string); ok {
+			if _, err := s.pattern(p); err != nil {
+				return fmt.Errorf("schema has invalid pattern %q: %v", p, err)
+			}
+		}
+		if pp, ok := v["patternProperties"].(map[string]interface{}); ok {
+			for p := range pp {
+				if _, err := s.pattern(p); err != nil {
+					return fmt.Errorf("schema has invalid pattern %q: %v", p, err)
+				}
+			}
+		}
+		for _, child := range v {
+			if err := s.checkPatterns(child); err != nil {
+				return err
+			}
+		}
+	case []interface{}:
+		for _, child := range v {
+			if err := s.checkPatterns(child); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+func (s *jsonSchema) pattern(p string) (*regexp.Regexp, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if re, ok := s.patterns[p]; ok {
+		return re, nil
+	}
+	re, err := regexp.Compile(p)
+	if err != nil {
+		return nil, err
+	}
+	s.patterns[p] = re
+	return re, nil
+}
+
+// validate checks the given JSON document, as decoded by encoding/json, and
+// returns a description of each violation. Each description starts with the
+// path to the offending value, like "$.items[0].name".
+func (s *jsonSchema) validate(doc interface{}) []string {
+	var errs []string
+	s.validateValue(s.root, doc, "$", &errs, 0)
+	return errs
+}
+
+// maxSchemaDepth guards against cycles of references in a schema.
+const maxSchemaDepth = 100
+
+func (s *jsonSchema) validateValue(schema, v interface{}, path string, errs *[]string, depth int) {
+	if depth > maxSchemaDepth {
+		*errs = append(*errs, fmt.Sprintf("%s: schema references are nested too deeply", path))
+		return
+	}
+	violation := func(format string, args ...interface{}) {
+		*errs = append(*errs, path+": "+fmt.Sprintf(format, args...))
+	}
+	if allowed, ok := schema.(bool); ok {
+		if !allowed {
+			violation("no value is allowed")
+		}
+		return
+	}
+	sch, ok := schema.(map[string]interface{})
+	if !ok {
+		return
+	}
+
+	if ref, ok := sch["$ref"].(string); ok {
+		target, err := s.resolveRef(ref)
+		if err != nil {
+			violation("%v", err)
+		} else {
+			s.validateValue(target, v, path, errs, depth+1)
+		}
+	}
+
+	if t, ok := sch["type"]; ok {
+		var types []string
+		switch t := t.(type) {
+		case string:
+			types = []string{t}
+		case []interface{}:
+			for _, e := range t {
+				if str, ok := e.(string); ok {
+					types = append(types, str)
+				}
+			}
+		}
+		matched := false
+		for _, t := range types {
+			if jsonTypeMatches(t, v) {
+				matched = true
+				break
+			}
+		}
+		if !matched {
+			violation("expected %s, got %s", strings.Join(types, " or "), jsonTypeName(v))
+			// other keywords would only produce confusing follow-on errors
+			return
+		}
+	}
+	if enum, ok := sch["enum"].([]interface{}); ok {
+		found := false
+		for _, e := range enum {
+			if jsonEqual(e, v) {
+				found = true
+				break
+			}
+		}
+		if !found {
+			violation("value %s is not one of %s", jsonString(v), jsonString(enum))
+		}
+	}
+	if c, ok := sch["const"]; ok && !jsonEqual(c, v) {
+		violation("value %s is not %s", jsonString(v), jsonString(c))
+	}
+
+	switch v := v.(type) {
+	case map[string]interface{}:
+		s.validateObject(sch, v, path, errs, depth)
+	case []interface{}:
+		s.validateArray(sch, v, path, errs, depth)
+	case string:
+		n := float64(utf8.RuneCountInString(v))
+		if min, ok := sch["minLength"].(float64); ok && n < min {
+			violation("string is shorter than %v characters", min)
+		}
+		if max, ok := sch["maxLength"].(float64); ok && n > max {
+			violation("string is longer than %v characters", max)
+		}
+		if p, ok := sch["pattern"].(string); ok {
+			if re, err := s.pattern(p); err == nil && !re.MatchString(v) {
+				violation("string %q does not match pattern %q", v, p)
+			}
+		}
+	case float64:
+		if min, ok := sch["minimum"].(float64); ok && v < min {
+			violation("%v is less than minimum %v", v, min)
+		}
+		if max, ok := sch["maximum"].(float64); ok && v > max {
+			violation("%v is greater than maximum %v", v, max)
+		}
+		if min, ok := sch["exclusiveMinimum"].(float64); ok && v <= min {
+			violation("%v is not greater than %v", v, min)
+		}
+		if max, ok := sch["exclusiveMaximum"].(float64); ok && v >= max {
+			violation("%v is not less than %v", v, max)
+		}
+		if m, ok := sch["multipleOf"].(float64); ok && m > 0 {
+			if q := v / m; q != math.Trunc(q) {
+				violation("%v is not a multiple of %v", v, m)
+			}
+		}
+	}
+
+	if all, ok := sch["allOf"].([]interface{}); ok {
+		for _, sub := range all {
+			s.validateValue(sub, v, path, errs, depth+1)
+		}
+	}
+	if anyOf, ok := sch["anyOf"].([]interface{}); ok {
+		matched := false
+		for _, sub := range anyOf {
+			if len(s.subErrors(sub, v, path, depth)) == 0 {
+				matched = true
+				break
+			}
+		}
+		if !matched {
+			violation("value does not match any of the schemas in anyOf")
+		}
+	}
+	if oneOf, ok := sch["oneOf"].([]interface{}); ok {
+		matches := 0
+		for _, sub := range oneOf {
+			if len(s.subErrors(sub, v, path, depth)) == 0 {
+				matches++
+			}
+		}
+		if matches != 1 {
+			violation("value matches %d of the schemas in oneOf, instead of exactly one", matches)
+		}
+	}
+	if not, ok := sch["not"]; ok && len(s.subErrors(not, v, path, depth)) == 0 {
+		violation("value matches the schema in not")
+	}
+}
+
+func (s *jsonSchema) subErrors(schema, v interface{}, path string, depth int) []string {
+	var errs []string
+	s.validateValue(schema, v, path, &errs, depth+1)
+	return errs
+}
+
+func (s *jsonSchema) validateObject(sch, v map[string]interface{}, path string, errs *[]string, depth int) {
+	if req, ok := sch["required"].([]interface{}); ok {
+		for _, r := range req {
+			if name, ok := r.(string); ok {
+				if _, present := v[name]; !present {
+					*errs = append(*errs, fmt.Sprintf("%s: missing required property %q", path, name))
+				}
+			}
+		}
+	}
+	n := float64(len(v))
+	if min, ok := sch["minProperties"].(float64); ok && n < min {
+		*errs = append(*errs, fmt.Sprintf("%s: object has fewer than %v properties", path, min))
+	}
+	if max, ok := sch["maxProperties"].(float64); ok && n > max {
+		*errs = append(*errs, fmt.Sprintf("%s: object has more than %v properties", path, max))
+	}
+
+	props, _ := sch["properties"].(map[string]interface{})
+	patternProps, _ := sch["patternProperties"].(map[string]interface{})
+	additional, hasAdditional := sch["additionalProperties"]
+	// sorted, so violations are reported in a stable order
+	keys := make([]string, 0, len(v))
+	for k := range v {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	for _, k := range keys {
+		childPath := path + "." + k
+		matched := false
+		if sub, ok := props[k]; ok {
+			matched = true
+			s.validateValue(sub, v[k], childPath, errs, depth+1)
+		}
+		for p, sub := range patternProps {
+			if re, err := s.pattern(p); err == nil && re.MatchString(k) {
+				matched = true
+				s.validateValue(sub, v[k], childPath, errs, depth+1)
+			}
+		}
+		if !matched && hasAdditional {
+			if allowed, ok := additional.(bool); ok && !allowed {
+				*errs = append(*errs, fmt.Sprintf("%s: property %q is not allowed", path, k))
+			} else {
+				s.validateValue(additional, v[k], childPath, errs, depth+1)
+			}
+		}
+	}
+}
+
+func (s *jsonSchema) validateArray(sch map[string]interface{}, v []interface{}, path string, errs *[]string, depth int) {
+	n := float64(len(v))
+	if min, ok := sch["minItems"].(float64); ok && n < min {
+		*errs = append(*errs, fmt.Sprintf("%s: array has fewer than %v items", path, min))
+	}
+	if max, ok := sch["maxItems"].(float64); ok && n > max {
+		*errs = append(*errs, fmt.Sprintf("%s: array has more than %v items", path, max))
+	}
+	if unique, ok := sch["uniqueItems"].(bool); ok && unique {
+	outer:
+		for i := range v {
+			for j := 0; j < i; j++ {
+				if jsonEqual(v[i], v[j]) {
+					*errs = append(*errs, fmt.Sprintf("%s: items %d and %d are the same", path, j, i))
+					break outer
+				}
+			}
+		}
+	}
+	switch items := sch["items"].(type) {
+	case []interface{}:
+		// a schema for each position, as in draft 7 and earlier
+		for i, sub := range items {
+			if i < len(v) {
+				s.validateValue(sub, v[i], path+"["+strconv.Itoa(i)+"]", errs, depth+1)
+			}
+		}
+	case map[string]interface{}, bool:
+		for i := range v {
+			s.validateValue(items, v[i], path+"["+strconv.Itoa(i)+"]", errs, depth+1)
+		}
+	}
+}
+
+// resolveRef resolves a reference to a location in the schema, in the form
+// of a URI fragment that is a JSON pointer, like "#/definitions/foo".
+func (s *jsonSchema) resolveRef(ref string) (interface{}, error) {
+	ptr, ok := strings.CutPrefix(ref, "#")
+	if !ok {
+		return nil, fmt.Errorf("unsupported schema reference %q: only references within the schema are supported", ref)
+	}
+	cur := s.root
+	if ptr == "" {
+		return cur, nil
+	}
+	for _, tok := range strings.Split(strings.TrimPrefix(ptr, "/"), "/") {
+		tok = strings.ReplaceAll(strings.ReplaceAll(tok, "~1", "/"), "~0", "~")
+		switch c := cur.(type) {
+		case map[string]interface{}:
+			if cur, ok = c[tok]; !ok {
+				return nil, fmt.Errorf("schema reference %q not found", ref)
+			}
+		case []interface{}:
+			i, err := strconv.Atoi(tok)
+			if err != nil || i < 0 || i >= len(c) {
+				return nil, fmt.Errorf("schema reference %q not found", ref)
+			}
+			cur = c[i]
+		default:
+			return nil, fmt.Errorf("schema reference %q not found", ref)
+		}
+	}
+	return cur, nil
+}
+
+func jsonTypeMatches(t string, v interface{}) bool {
+	switch t {
+	case "integer":
+		f, ok := v.(float64)
+		return ok && f == math.Trunc(f)
+	case "number":
+		_, ok := v.(float64)
+		return ok
+	default:
+		return jsonTypeName(v) == t
+	}
+}
+
+func jsonTypeName(v interface{}) string {
+	switch v.(type) {
+	case nil:
+		return "null"
+	case bool:
+		return "boolean"
+	case float64:
+		return "number"
+	case string:
+		return "string"
+	case []interface{}:
+		return "array"
+	case map[string]interface{}:
+		return "object"
+	default:
+		return fmt.Sprintf("%T", v)
+	}
+}
+
+func jsonEqual(a, b interface{}) bool {
+	return reflect.DeepEqual(a, b)
+}
+
+func jsonString(v interface{}) string {
+	b, err := json.Marshal(v)
+	if err != nil {
+		return fmt.Sprint(v)
+	}
+	return string(b)
+}
+
+// schemaChecker wraps a formatter and validates each response message, as
+// JSON, against a JSON Schema. The JSON is produced by its own formatter, so
+// responses are validated even if they are printed in another format.
+type schemaChecker struct {
+	schema    *jsonSchema
+	formatter grpcurl.Formatter
+
+	mu         sync.Mutex
+	count      int
+	violations []string
+}
+
+func (c *schemaChecker) wrap(formatter grpcurl.Formatter) grpcurl.Formatter {
+	return func(m proto.Message) (string, error) {
+		c.check(m)
+		return formatter(m)
+	}
+}
+
+func (c *schemaChecker) check(m proto.Message) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.count++
+	js, err := c.formatter(m)
+	if err != nil {
+		c.violations = append(c.violations, fmt.Sprintf("response %d: failed to encode as JSON: %v", c.count, err))
+		return
+	}
+	var doc interface{}
+	if err := json.Unmarshal([]byte(js), &doc); err != nil {
+		c.violations = append(c.violations, fmt.Sprintf("response %d: failed to decode JSON: %v", c.count, err))
+		return
+	}
+	for _, v := range c.schema.validate(doc) {
+		c.violations = append(c.violations, fmt.Sprintf("response %d: %s", c.count, v))
+	}
+}
+
+// result returns the violations found in all responses checked so far.
+func (c *schemaChecker) result() []string {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.violations
+}
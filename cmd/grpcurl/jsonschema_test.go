@@ -0,0 +1,100 @@
+package main
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+const testSchema = `{
+	"type": "object",
+	"required": ["name", "items"],
+	"additionalProperties": false,
+	"properties": {
+		"name": {"type": "string", "minLength": 1, "pattern": "^[a-z]+$"},
+		"count": {"type": "integer", "minimum": 0},
+		"kind": {"enum": ["SMALL", "LARGE"]},
+		"items": {"type": "array", "maxItems": 2, "items": {"$ref": "#/$defs/item"}}
+	},
+	"$defs": {
+		"item": {
+			"type": "object",
+			"required": ["id"],
+			"properties": {"id": {"type": "string"}}
+		}
+	}
+}`
+
+func TestJSONSchemaValidate(t *testing.T) {
+	schema, err := parseJSONSchema([]byte(testSchema))
+	if err != nil {
+		t.Fatalf("failed to parse schema: %v", err)
+	}
+	testCases := []struct {
+		doc      string
+		expected []string
+	}{
+		{
+			doc: `{"name": "abc", "count": 3, "kind": "SMALL", "items": [{"id": "x"}]}`,
+		},
+		{
+			doc: `{"name": "ABC", "count": 1.5, "kind": "MEDIUM", "items": [{"id": 1}, {}, {"id": "z"}], "extra": true}`,
+			expected: []string{
+				`$.count: expected integer, got number`,
+				`$: property "extra" is not allowed`,
+				`$.items: array has more than 2 items`,
+				`$.items[0].id: expected string, got number`,
+				`$.items[1]: missing required property "id"`,
+				`$.kind: value "MEDIUM" is not one of ["SMALL","LARGE"]`,
+				`$.name: string "ABC" does not match pattern "^[a-z]+$"`,
+			},
+		},
+		{
+			doc:      `[]`,
+			expected: []string{`$: expected object, got array`},
+		},
+	}
+	for _, tc := range testCases {
+		var doc interface{}
+		if err := json.Unmarshal([]byte(tc.doc), &doc); err != nil {
+			t.Fatalf("failed to parse document: %v", err)
+		}
+		errs := schema.validate(doc)
+		if !reflect.DeepEqual(errs, tc.expected) {
+			t.Errorf("%s: wrong violations:\nwant: %q\ngot:  %q", tc.doc, tc.expected, errs)
+		}
+	}
+
+	if _, err := parseJSONSchema([]byte(`{"pattern": "("}`)); err == nil || !strings.Contains(err.Error(), "invalid pattern") {
+		t.Errorf("expecting error for invalid pattern, got %v", err)
+	}
+}
+
+func TestLoadJSONSchema(t *testing.T) {
+	fileName := filepath.Join(t.TempDir(), "schema.json")
+	if err := os.WriteFile(fileName, []byte(testSchema), 0666); err != nil {
+		t.Fatalf("failed to write schema: %v", err)
+	}
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "/schema.json" {
+			http.NotFound(w, r)
+			return
+		}
+		_, _ = w.Write([]byte(testSchema))
+	}))
+	defer srv.Close()
+
+	for _, name := range []string{fileName, "@" + fileName, "@" + srv.URL + "/schema.json"} {
+		if _, err := loadJSONSchema(name); err != nil {
+			t.Errorf("%s: failed to load schema: %v", name, err)
+		}
+	}
+	if _, err := loadJSONSchema("@" + srv.URL + "/missing.json"); err == nil || !strings.Contains(err.Error(), "404") {
+		t.Errorf("expecting error for missing schema, got %v", err)
+	}
+}
@@ -0,0 +1,62 @@
+package main
+
+import (
+	"context"
+	"sync/atomic"
+
+	"github.com/golang/protobuf/proto" //lint:ignore SA1019 we have to import this because it appears in exported API
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/status"
+
+	"github.com/fullstorydev/grpcurl"
+)
+
+// recvLimitHandler wraps an event handler and cancels the RPC once a given
+// number of response messages have been received. Any responses that arrive
+// after the limit is reached are discarded.
+type recvLimitHandler struct {
+	grpcurl.InvocationEventHandler
+	limit  int
+	cancel context.CancelFunc
+
+	count     int
+	reached   atomic.Bool
+	truncated atomic.Bool
+}
+
+func newRecvLimitHandler(h grpcurl.InvocationEventHandler, limit int, cancel context.CancelFunc) *recvLimitHandler {
+	return &recvLimitHandler{InvocationEventHandler: h, limit: limit, cancel: cancel}
+}
+
+// LimitReached returns true if the limit on the number of response messages
+// was reached, in which case the RPC was cancelled.
+func (l *recvLimitHandler) LimitReached() bool {
+	return l.reached.Load()
+}
+
+// Truncated returns true if the RPC was cut short because of the limit: either
+// responses were discarded or the RPC ended with a cancelled status.
+func (l *recvLimitHandler) Truncated() bool {
+	return l.truncated.Load()
+}
+
+func (l *recvLimitHandler) OnReceiveResponse(resp proto.Message) {
+	if l.reached.Load() {
+		l.truncated.Store(true)
+		return
+	}
+	l.InvocationEventHandler.OnReceiveResponse(resp)
+	l.count++
+	if l.count >= l.limit {
+		l.reached.Store(true)
+		l.cancel()
+	}
+}
+
+func (l *recvLimitHandler) OnReceiveTrailers(stat *status.Status, md metadata.MD) {
+	if l.reached.Load() && stat.Code() == codes.Canceled {
+		l.truncated.Store(true)
+	}
+	l.InvocationEventHandler.OnReceiveTrailers(stat, md)
+}
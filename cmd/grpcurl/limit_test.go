@@ -0,0 +1,54 @@
+package main
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"google.golang.org/grpc/codes"
+
+	"github.com/fullstorydev/grpcurl"
+)
+
+func TestRecvLimitHandler(t *testing.T) {
+	cc, source := dialTestServer(t)
+	testCases := []struct {
+		name      string
+		limit     int
+		reached   bool
+		responses int
+		// whether the RPC is known to complete or to be cut short; when the
+		// limit is reached with the last response, it could be either
+		completes, truncated bool
+	}{
+		{name: "below limit", limit: 5, responses: 3, completes: true},
+		{name: "at limit", limit: 3, reached: true, responses: 3},
+		{name: "over limit", limit: 2, reached: true, responses: 2, truncated: true},
+	}
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			ctx, cancel := context.WithCancel(context.Background())
+			defer cancel()
+			h := newDiscardingHandler()
+			l := newRecvLimitHandler(h, tc.limit, cancel)
+			// the gap before the last response gives the cancellation time
+			// to take effect when the limit is exceeded
+			req := streamingOutputRequest(t, 0, 0, 200*time.Millisecond)
+			if err := grpcurl.InvokeRPC(ctx, source, cc, "testing.TestService/StreamingOutputCall", nil, l, req); err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+			if l.LimitReached() != tc.reached {
+				t.Errorf("expecting LimitReached() to be %v", tc.reached)
+			}
+			if h.NumResponses != tc.responses {
+				t.Errorf("expecting %d responses to be handled, got %d", tc.responses, h.NumResponses)
+			}
+			if tc.truncated && (h.Status.Code() != codes.Canceled || !l.Truncated()) {
+				t.Errorf("expecting RPC to be truncated, got %v", h.Status)
+			}
+			if tc.completes && (h.Status.Code() != codes.OK || l.Truncated()) {
+				t.Errorf("expecting RPC to complete, got %v", h.Status)
+			}
+		})
+	}
+}
@@ -0,0 +1,62 @@
+package main
+
+import (
+	"encoding/json"
+	"io"
+	"sort"
+
+	"github.com/jhump/protoreflect/desc"
+
+	"github.com/fullstorydev/grpcurl"
+)
+
+// manifestEntry describes the files needed to use a single symbol.
+type manifestEntry struct {
+	Symbol string `json:"symbol"`
+	File   string `json:"file"`
+	// Dependencies are the names of all files on which File depends, directly
+	// or transitively, in sorted order.
+	Dependencies []string `json:"dependencies"`
+}
+
+// writeManifest resolves the given symbols and writes a JSON array to out
+// with a manifestEntry for each one. The entries are sorted by symbol so that
+// the output is stable.
+func writeManifest(out io.Writer, descSource grpcurl.DescriptorSource, symbols []string) error {
+	entries := make([]manifestEntry, 0, len(symbols))
+	for _, sym := range symbols {
+		d, err := descSource.FindSymbol(sym)
+		if err != nil {
+			return err
+		}
+		fd := d.GetFile()
+		seen := map[string]struct{}{}
+		addTransitiveDeps(fd, seen)
+		deps := make([]string, 0, len(seen))
+		for name := range seen {
+			deps = append(deps, name)
+		}
+		sort.Strings(deps)
+		entries = append(entries, manifestEntry{
+			Symbol:       d.GetFullyQualifiedName(),
+			File:         fd.GetName(),
+			Dependencies: deps,
+		})
+	}
+	sort.Slice(entries, func(i, j int) bool {
+		return entries[i].Symbol < entries[j].Symbol
+	})
+	enc := json.NewEncoder(out)
+	enc.SetIndent("", "  ")
+	return enc.Encode(entries)
+}
+
+func addTransitiveDeps(fd *desc.FileDescriptor, seen map[string]struct{}) {
+	for _, dep := range fd.GetDependencies() {
+		if _, ok := seen[dep.GetName()]; ok {
+			continue
+		}
+		seen[dep.GetName()] = struct{}{}
+		addTransitiveDeps(dep, seen)
+	}
+}
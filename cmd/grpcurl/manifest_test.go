@@ -0,0 +1,58 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"reflect"
+	"testing"
+
+	"github.com/jhump/protoreflect/desc/protoparse"
+
+	"github.com/fullstorydev/grpcurl"
+)
+
+func TestWriteManifest(t *testing.T) {
+	fds, err := (&protoparse.Parser{
+		Accessor: protoparse.FileContentsFromMap(map[string]string{
+			"svc.proto": `
+				syntax = "proto3";
+				package mf;
+				import "msgs.proto";
+				service Svc { rpc Do (Req) returns (Req); }`,
+			"msgs.proto": `
+				syntax = "proto3";
+				package mf;
+				import "google/protobuf/empty.proto";
+				message Req { google.protobuf.Empty e = 1; }`,
+		}),
+	}).ParseFiles("svc.proto")
+	if err != nil {
+		t.Fatalf("failed to parse protos: %v", err)
+	}
+	source, err := grpcurl.DescriptorSourceFromFileDescriptors(fds...)
+	if err != nil {
+		t.Fatalf("failed to create descriptor source: %v", err)
+	}
+
+	var buf bytes.Buffer
+	if err := writeManifest(&buf, source, []string{"mf.Svc", "google.protobuf.Empty", "mf.Req"}); err != nil {
+		t.Fatalf("failed to write manifest: %v", err)
+	}
+	var entries []manifestEntry
+	if err := json.Unmarshal(buf.Bytes(), &entries); err != nil {
+		t.Fatalf("manifest is not valid JSON: %v", err)
+	}
+	// entries are sorted by symbol and list transitive dependencies
+	expected := []manifestEntry{
+		{Symbol: "google.protobuf.Empty", File: "google/protobuf/empty.proto", Dependencies: []string{}},
+		{Symbol: "mf.Req", File: "msgs.proto", Dependencies: []string{"google/protobuf/empty.proto"}},
+		{Symbol: "mf.Svc", File: "svc.proto", Dependencies: []string{"google/protobuf/empty.proto", "msgs.proto"}},
+	}
+	if !reflect.DeepEqual(entries, expected) {
+		t.Errorf("wrong manifest:\nexpecting %+v\ngot %+v", expected, entries)
+	}
+
+	if err := writeManifest(&buf, source, []string{"mf.Nope"}); err == nil {
+		t.Error("expecting error for unknown symbol")
+	}
+}
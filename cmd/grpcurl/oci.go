@@ -0,0 +1,284 @@
+package main
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// ociProtosetMediaType is the media type of the layer, in an OCI artifact,
+// that holds an encoded FileDescriptorSet. Such an artifact can be pushed
+// with a tool like oras:
+//
+//	oras push registry.example.com/schemas:v1 my.protoset:application/vnd.grpcurl.protoset.v1
+const ociProtosetMediaType = "application/vnd.grpcurl.protoset.v1"
+
+const ociManifestMediaType = "application/vnd.oci.image.manifest.v1+json"
+
+// maxOCIProtosetSize limits the size of a protoset that is pulled from a
+// registry, to avoid exhausting memory or disk with a bad artifact.
+const maxOCIProtosetSize = 64 << 20
+
+// ociReference is a parsed "oci://" protoset reference, in the form
+// "oci://registry/repository:tag" or "oci://registry/repository@digest".
+type ociReference struct {
+	registry   string
+	repository string
+	// a tag or a digest
+	reference string
+}
+
+// parseOCIReference parses the given value of a -protoset flag. It returns
+// false if the value is not an "oci://" reference.
+func parseOCIReference(s string) (ociReference, bool, error) {
+	rest, ok := strings.CutPrefix(s, "oci://")
+	if !ok {
+		return ociReference{}, false, nil
+	}
+	registry, repo, ok := strings.Cut(rest, "/")
+	if !ok || registry == "" || repo == "" {
+		return ociReference{}, true, fmt.Errorf("OCI reference %q must be in 'oci://registry/repository:tag' form", s)
+	}
+	ref := "latest"
+	if pos := strings.Index(repo, "@"); pos >= 0 {
+		repo, ref = repo[:pos], repo[pos+1:]
+	} else if pos := strings.LastIndex(repo, ":"); pos >= 0 {
+		repo, ref = repo[:pos], repo[pos+1:]
+	}
+	if repo == "" || ref == "" {
+		return ociReference{}, true, fmt.Errorf("OCI reference %q must be in 'oci://registry/repository:tag' form", s)
+	}
+	return ociReference{registry: registry, repository: repo, reference: ref}, true, nil
+}
+
+func (r ociReference) String() string {
+	sep := ":"
+	if strings.Contains(r.reference, ":") {
+		sep = "@" // a digest, like "sha256:..."
+	}
+	return fmt.Sprintf("oci://%s/%s%s%s", r.registry, r.repository, sep, r.reference)
+}
+
+type ociDescriptor struct {
+	MediaType string `json:"mediaType"`
+	Digest    string `json:"digest"`
+	Size      int64  `json:"size"`
+}
+
+type ociManifest struct {
+	MediaType string          `json:"mediaType"`
+	Layers    []ociDescriptor `json:"layers"`
+}
+
+// ociClient pulls artifacts from an OCI registry, using the distribution API.
+// Only anonymous access is supported, including registries that require an
+// anonymous bearer token.
+type ociClient struct {
+	client *http.Client
+	// bearer tokens, by registry and repository
+	tokens map[string]string
+}
+
+func newOCIClient() *ociClient {
+	return &ociClient{client: http.DefaultClient, tokens: map[string]string{}}
+}
+
+// pullProtoset downloads the protoset layer of the given artifact into a new
+// file in the given directory and returns the file's name.
+func (c *ociClient) pullProtoset(ctx context.Context, ref ociReference, dir string) (string, error) {
+	var manifest ociManifest
+	resp, err := c.get(ctx, ref, "manifests/"+ref.reference, ociManifestMediaType)
+	if err != nil {
+		return "", err
+	}
+	err = json.NewDecoder(io.LimitReader(resp.Body, 4<<20)).Decode(&manifest)
+	_ = resp.Body.Close()
+	if err != nil {
+		return "", fmt.Errorf("failed to parse manifest for %v: %v", ref, err)
+	}
+	var layer *ociDescriptor
+	var found []string
+	for i := range manifest.Layers {
+		if manifest.Layers[i].MediaType == ociProtosetMediaType {
+			layer = &manifest.Layers[i]
+			break
+		}
+		found = append(found, manifest.Layers[i].MediaType)
+	}
+	if layer == nil {
+		return "", fmt.Errorf("artifact %v has no layer with media type %s (found %s)", ref, ociProtosetMediaType, strings.Join(found, ", "))
+	}
+	if layer.Size > maxOCIProtosetSize {
+		return "", fmt.Errorf("protoset in %v is too large: %d bytes", ref, layer.Size)
+	}
+	algo, wantHash, ok := strings.Cut(layer.Digest, ":")
+	if !ok || algo != "sha256" {
+		return "", fmt.Errorf("protoset in %v has unsupported digest %q", ref, layer.Digest)
+	}
+
+	resp, err = c.get(ctx, ref, "blobs/"+layer.Digest, "")
+	if err != nil {
+		return "", err
+	}
+	defer func() {
+		_ = resp.Body.Close()
+	}()
+	data, err := io.ReadAll(io.LimitReader(resp.Body, maxOCIProtosetSize+1))
+	if err != nil {
+		return "", fmt.Errorf("failed to download protoset from %v: %v", ref, err)
+	}
+	hash := sha256.Sum256(data)
+	if hex.EncodeToString(hash[:]) != wantHash {
+		return "", fmt.Errorf("protoset from %v does not match its digest %s", ref, layer.Digest)
+	}
+
+	f, err := os.CreateTemp(dir, filepath.Base(ref.repository)+"-*.protoset")
+	if err != nil {
+		return "", err
+	}
+	if _, err := f.Write(data); err != nil {
+		_ = f.Close()
+		return "", err
+	}
+	return f.Name(), f.Close()
+}
+
+// get sends a GET request for the given path in the reference's repository,
+// authenticating with an anonymous bearer token if the registry asks for
+// one. The caller must close the response body.
+func (c *ociClient) get(ctx context.Context, ref ociReference, path, accept string) (*http.Response, error) {
+	u := fmt.Sprintf("https://%s/v2/%s/%s", ref.registry, ref.repository, path)
+	tokenKey := ref.registry + "/" + ref.repository
+	for attempt := 0; ; attempt++ {
+		req, err := http.NewRequestWithContext(ctx, http.MethodGet, u, nil)
+		if err != nil {
+			return nil, err
+		}
+		if accept != "" {
+			req.Header.Set("Accept", accept)
+		}
+		if token := c.tokens[tokenKey]; token != "" {
+			req.Header.Set("Authorization", "Bearer "+token)
+		}
+		resp, err := c.client.Do(req)
+		if err != nil {
+			return nil, err
+		}
+		if resp.StatusCode == http.StatusOK {
+			return resp, nil
+		}
+		_ = resp.Body.Close()
+		if resp.StatusCode == http.StatusUnauthorized && attempt == 0 {
+			token, err := c.fetchToken(ctx, resp.Header.Get("WWW-Authenticate"))
+			if err != nil {
+				return nil, fmt.Errorf("failed to authenticate to %s: %v", ref.registry, err)
+			}
+			c.tokens[tokenKey] = token
+			continue
+		}
+		return nil, fmt.Errorf("failed to fetch %s: %s", u, resp.Status)
+	}
+}
+
+// fetchToken gets an anonymous bearer token, as described by the given
+// WWW-Authenticate challenge.
+func (c *ociClient) fetchToken(ctx context.Context, challenge string) (string, error) {
+	scheme, params, _ := strings.Cut(challenge, " ")
+	if !strings.EqualFold(scheme, "Bearer") {
+		return "", fmt.Errorf("unsupported authentication scheme %q; only anonymous access is supported", scheme)
+	}
+	attrs := map[string]string{}
+	for _, p := range strings.Split(params, ",") {
+		k, v, ok := strings.Cut(strings.TrimSpace(p), "=")
+		if ok {
+			attrs[strings.ToLower(k)] = strings.Trim(v, `"`)
+		}
+	}
+	realm := attrs["realm"]
+	if realm == "" {
+		return "", errors.New("bearer challenge has no realm")
+	}
+	q := url.Values{}
+	for _, k := range []string{"service", "scope"} {
+		if v := attrs[k]; v != "" {
+			q.Set(k, v)
+		}
+	}
+	u := realm
+	if len(q) > 0 {
+		u += "?" + q.Encode()
+	}
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, u, nil)
+	if err != nil {
+		return "", err
+	}
+	resp, err := c.client.Do(req)
+	if err != nil {
+		return "", err
+	}
+	defer func() {
+		_ = resp.Body.Close()
+	}()
+	if resp.StatusCode != http.StatusOK {
+		return "", fmt.Errorf("token request failed: %s", resp.Status)
+	}
+	var tok struct {
+		Token       string `json:"token"`
+		AccessToken string `json:"access_token"`
+	}
+	if err := json.NewDecoder(io.LimitReader(resp.Body, 1<<20)).Decode(&tok); err != nil {
+		return "", fmt.Errorf("failed to parse token response: %v", err)
+	}
+	if tok.Token != "" {
+		return tok.Token, nil
+	}
+	if tok.AccessToken != "" {
+		return tok.AccessToken, nil
+	}
+	return "", errors.New("token response has no token")
+}
+
+// pullOCIProtosets pulls any protosets given as "oci://" references into
+// files in a new temporary directory. It returns the protoset names with
+// each reference replaced by its file, along with a map of those files back
+// to their references. The caller should remove the returned directory, if
+// not empty, once the files have been read. The given context bounds the
+// requests to the registries.
+func pullOCIProtosets(ctx context.Context, protosets []string) ([]string, map[string]string, string, error) {
+	names := make([]string, len(protosets))
+	pulled := map[string]string{}
+	var dir string
+	var client *ociClient
+	for i, name := range protosets {
+		ref, ok, err := parseOCIReference(name)
+		if err != nil {
+			return nil, nil, dir, err
+		}
+		if !ok {
+			names[i] = name
+			continue
+		}
+		if client == nil {
+			client = newOCIClient()
+			if dir, err = os.MkdirTemp("", "grpcurl-oci-"); err != nil {
+				return nil, nil, "", err
+			}
+		}
+		file, err := client.pullProtoset(ctx, ref, dir)
+		if err != nil {
+			return nil, nil, dir, err
+		}
+		names[i] = file
+		pulled[file] = name
+	}
+	return names, pulled, dir, nil
+}
@@ -0,0 +1,112 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"strings"
+	"testing"
+)
+
+func TestParseOCIReference(t *testing.T) {
+	testCases := []struct {
+		in       string
+		expected ociReference
+		str      string
+	}{
+		{"oci://ghcr.io/acme/schemas:v1", ociReference{"ghcr.io", "acme/schemas", "v1"}, "oci://ghcr.io/acme/schemas:v1"},
+		{"oci://localhost:5000/schemas", ociReference{"localhost:5000", "schemas", "latest"}, "oci://localhost:5000/schemas:latest"},
+		{"oci://r.example/s@sha256:abcd", ociReference{"r.example", "s", "sha256:abcd"}, "oci://r.example/s@sha256:abcd"},
+	}
+	for _, tc := range testCases {
+		ref, ok, err := parseOCIReference(tc.in)
+		if err != nil || !ok {
+			t.Errorf("%s: unexpected result: %v, %v", tc.in, ok, err)
+		} else if ref != tc.expected {
+			t.Errorf("%s: wrong reference: expected %+v, got %+v", tc.in, tc.expected, ref)
+		} else if ref.String() != tc.str {
+			t.Errorf("%s: wrong string form: expected %s, got %s", tc.in, tc.str, ref)
+		}
+	}
+	if _, ok, _ := parseOCIReference("foo.protoset"); ok {
+		t.Error("file name should not be an OCI reference")
+	}
+	if _, _, err := parseOCIReference("oci://registry-only"); err == nil {
+		t.Error("expecting error for reference without repository")
+	}
+}
+
+func TestPullOCIProtoset(t *testing.T) {
+	protoset, err := os.ReadFile("../../internal/testing/test.protoset")
+	if err != nil {
+		t.Fatalf("failed to read protoset: %v", err)
+	}
+	hash := sha256.Sum256(protoset)
+	digest := "sha256:" + hex.EncodeToString(hash[:])
+
+	var layerType, blobDigest string
+	var srv *httptest.Server
+	srv = httptest.NewTLSServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch {
+		case r.URL.Path == "/token":
+			if r.URL.Query().Get("scope") != "repository:acme/schemas:pull" {
+				http.Error(w, "bad scope", http.StatusBadRequest)
+				return
+			}
+			_ = json.NewEncoder(w).Encode(map[string]string{"token": "anon"})
+		case r.Header.Get("Authorization") != "Bearer anon":
+			w.Header().Set("WWW-Authenticate", fmt.Sprintf(`Bearer realm="%s/token",service="test",scope="repository:acme/schemas:pull"`, srv.URL))
+			w.WriteHeader(http.StatusUnauthorized)
+		case r.URL.Path == "/v2/acme/schemas/manifests/v1":
+			_ = json.NewEncoder(w).Encode(ociManifest{
+				MediaType: ociManifestMediaType,
+				Layers:    []ociDescriptor{{MediaType: layerType, Digest: blobDigest, Size: int64(len(protoset))}},
+			})
+		case r.URL.Path == "/v2/acme/schemas/blobs/"+blobDigest:
+			_, _ = w.Write(protoset)
+		default:
+			http.NotFound(w, r)
+		}
+	}))
+	defer srv.Close()
+
+	ref := ociReference{registry: strings.TrimPrefix(srv.URL, "https://"), repository: "acme/schemas", reference: "v1"}
+	newClient := func() *ociClient {
+		c := newOCIClient()
+		c.client = srv.Client()
+		return c
+	}
+
+	layerType, blobDigest = ociProtosetMediaType, digest
+	file, err := newClient().pullProtoset(context.Background(), ref, t.TempDir())
+	if err != nil {
+		t.Fatalf("failed to pull protoset: %v", err)
+	}
+	if contents, err := os.ReadFile(file); err != nil || !bytes.Equal(contents, protoset) {
+		t.Errorf("pulled file has wrong contents (err = %v)", err)
+	}
+
+	layerType = "application/octet-stream"
+	if _, err := newClient().pullProtoset(context.Background(), ref, t.TempDir()); err == nil || !strings.Contains(err.Error(), "no layer with media type") {
+		t.Errorf("expecting error for wrong media type, got %v", err)
+	}
+
+	layerType, blobDigest = ociProtosetMediaType, "sha256:"+strings.Repeat("0", 64)
+	if _, err := newClient().pullProtoset(context.Background(), ref, t.TempDir()); err == nil || !strings.Contains(err.Error(), "does not match its digest") {
+		t.Errorf("expecting error for wrong digest, got %v", err)
+	}
+
+	// requests are abandoned when the context is done
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	if _, err := newClient().pullProtoset(ctx, ref, t.TempDir()); !errors.Is(err, context.Canceled) {
+		t.Errorf("expecting error for cancelled context, got %v", err)
+	}
+}
@@ -0,0 +1,49 @@
+package main
+
+import (
+	"sort"
+
+	"github.com/golang/protobuf/proto" //lint:ignore SA1019 we have to import this because it appears in exported API
+	"github.com/jhump/protoreflect/desc"
+	"github.com/jhump/protoreflect/dynamic"
+
+	"github.com/fullstorydev/grpcurl"
+)
+
+// customOptions returns the custom options, which are extensions of the
+// options message, of the given element in text format. Extensions are
+// resolved using the given descriptor source, so options are shown even when
+// the element's descriptor came from a server that does not link in the
+// extensions. It also returns the field numbers of options that could not be
+// resolved, so the caller can report them instead of failing.
+func customOptions(source grpcurl.DescriptorSource, dsc desc.Descriptor) (string, []int32, error) {
+	opts := dsc.GetOptions()
+	if opts == nil || proto.Size(opts) == 0 {
+		return "", nil, nil
+	}
+	dm, ok := grpcurl.EnsureExtensions(source, opts).(*dynamic.Message)
+	if !ok {
+		// extensions could not be loaded, so all custom options are unknown
+		var err error
+		if dm, err = dynamic.AsDynamicMessage(opts); err != nil {
+			return "", nil, err
+		}
+	}
+
+	custom := dynamic.NewMessage(dm.GetMessageDescriptor())
+	for _, ext := range dm.GetKnownExtensions() {
+		if dm.HasField(ext) {
+			if err := custom.TrySetField(ext, dm.GetField(ext)); err != nil {
+				return "", nil, err
+			}
+		}
+	}
+	unresolved := dm.GetUnknownFields()
+	sort.Slice(unresolved, func(i, j int) bool { return unresolved[i] < unresolved[j] })
+
+	txt, err := custom.MarshalTextIndent()
+	if err != nil {
+		return "", nil, err
+	}
+	return string(txt), unresolved, nil
+}
@@ -0,0 +1,95 @@
+package main
+
+import (
+	"reflect"
+	"testing"
+
+	"github.com/jhump/protoreflect/desc"
+	"github.com/jhump/protoreflect/desc/protoparse"
+
+	"github.com/fullstorydev/grpcurl"
+)
+
+const optionsProto = `
+syntax = "proto3";
+package opts;
+import "google/protobuf/descriptor.proto";
+message RateLimit {
+	int32 per_second = 1;
+}
+extend google.protobuf.MethodOptions {
+	string auth_scope = 50001;
+	RateLimit rate_limit = 50002;
+}
+`
+
+const optionsServiceProto = `
+syntax = "proto3";
+package svc;
+import "options.proto";
+message Req {}
+service Svc {
+	rpc Limited (Req) returns (Req) {
+		option deprecated = true;
+		option (opts.auth_scope) = "admin";
+		option (opts.rate_limit) = { per_second: 10 };
+	}
+	rpc Plain (Req) returns (Req);
+}
+`
+
+// noExtensionsSource is a descriptor source that knows no extensions, like a
+// server whose reflection service omits the files that define them.
+type noExtensionsSource struct {
+	grpcurl.DescriptorSource
+}
+
+func (noExtensionsSource) AllExtensionsForType(string) ([]*desc.FieldDescriptor, error) {
+	return nil, nil
+}
+
+func TestCustomOptions(t *testing.T) {
+	p := protoparse.Parser{
+		Accessor: protoparse.FileContentsFromMap(map[string]string{
+			"options.proto": optionsProto,
+			"svc.proto":     optionsServiceProto,
+		}),
+	}
+	fds, err := p.ParseFiles("svc.proto")
+	if err != nil {
+		t.Fatalf("failed to parse proto: %v", err)
+	}
+	source, err := grpcurl.DescriptorSourceFromFileDescriptors(fds...)
+	if err != nil {
+		t.Fatalf("failed to create descriptor source: %v", err)
+	}
+	svc := fds[0].FindService("svc.Svc")
+
+	txt, unresolved, err := customOptions(source, svc.FindMethodByName("Limited"))
+	if err != nil {
+		t.Fatalf("failed to get custom options: %v", err)
+	}
+	expected := "[opts.auth_scope]: \"admin\"\n[opts.rate_limit]: <\n  per_second: 10\n>"
+	if txt != expected {
+		t.Errorf("wrong custom options; want:\n%s\ngot:\n%s", expected, txt)
+	}
+	if len(unresolved) != 0 {
+		t.Errorf("expecting all options to be resolved, got %v", unresolved)
+	}
+
+	txt, unresolved, err = customOptions(source, svc.FindMethodByName("Plain"))
+	if err != nil || txt != "" || len(unresolved) != 0 {
+		t.Errorf("expecting no custom options, got %q, %v, %v", txt, unresolved, err)
+	}
+
+	txt, unresolved, err = customOptions(noExtensionsSource{source}, svc.FindMethodByName("Limited"))
+	if err != nil {
+		t.Fatalf("failed to get custom options: %v", err)
+	}
+	if txt != "" {
+		t.Errorf("expecting no resolved options, got %q", txt)
+	}
+	if !reflect.DeepEqual(unresolved, []int32{50001, 50002}) {
+		t.Errorf("wrong unresolved options: %v", unresolved)
+	}
+}
@@ -0,0 +1,112 @@
+package main
+
+import (
+	"io"
+	"net"
+	"os"
+	"strings"
+	"sync"
+
+	"github.com/golang/protobuf/proto" //lint:ignore SA1019 we have to import this because it appears in exported API
+
+	"github.com/fullstorydev/grpcurl"
+)
+
+// openOutput opens the destination named by the -o flag. A value that starts
+// with "tcp://" or "unix://" names a network sink, to which a connection is
+// made; any other value is the name of a file, which is created (or truncated).
+// If reconnect is true, a failed write to a network sink causes the connection
+// to be re-established and the write to be retried once.
+func openOutput(dest string, reconnect bool) (io.WriteCloser, error) {
+	var sink *netSink
+	if addr, ok := strings.CutPrefix(dest, "tcp://"); ok {
+		sink = &netSink{network: "tcp", address: addr, reconnect: reconnect}
+	} else if addr, ok := strings.CutPrefix(dest, "unix://"); ok {
+		sink = &netSink{network: "unix", address: addr, reconnect: reconnect}
+	} else {
+		return os.Create(dest)
+	}
+	if err := sink.connect(); err != nil {
+		return nil, err
+	}
+	return sink, nil
+}
+
+// netSink is a writer that sends data over a network connection.
+type netSink struct {
+	network, address string
+	reconnect        bool
+
+	mu   sync.Mutex
+	conn net.Conn
+}
+
+func (s *netSink) connect() error {
+	conn, err := net.Dial(s.network, s.address)
+	if err != nil {
+		return err
+	}
+	s.conn = conn
+	return nil
+}
+
+func (s *netSink) Write(p []byte) (int, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	n, err := s.conn.Write(p)
+	if err == nil || !s.reconnect {
+		return n, err
+	}
+	_ = s.conn.Close()
+	if err := s.connect(); err != nil {
+		return n, err
+	}
+	// retry whatever was not written on the old connection
+	m, err := s.conn.Write(p[n:])
+	return n + m, err
+}
+
+func (s *netSink) Close() error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.conn.Close()
+}
+
+// errWriter wraps a writer and remembers the first error it returns. After an
+// error, subsequent writes are discarded. This is used because the event
+// handler does not check the result of writes.
+type errWriter struct {
+	w   io.Writer
+	err error
+}
+
+func (w *errWriter) Write(p []byte) (int, error) {
+	if w.err != nil {
+		return len(p), nil
+	}
+	n, err := w.w.Write(p)
+	if err != nil {
+		w.err = err
+	}
+	return n, err
+}
+
+// syncer is implemented by outputs, like files, that can be flushed to
+// durable storage.
+type syncer interface {
+	Sync() error
+}
+
+// flushingHandler wraps an event handler and flushes the output after every
+// response message, so that downstream consumers see each message as soon as
+// it is received.
+type flushingHandler struct {
+	grpcurl.InvocationEventHandler
+	out syncer
+}
+
+func (f *flushingHandler) OnReceiveResponse(resp proto.Message) {
+	f.InvocationEventHandler.OnReceiveResponse(resp)
+	// errors are ignored since some outputs, like pipes, cannot be synced
+	_ = f.out.Sync()
+}
@@ -0,0 +1,196 @@
+package main
+
+import (
+	"bytes"
+	"errors"
+	"io"
+	"net"
+	"os"
+	"path/filepath"
+	"reflect"
+	"runtime"
+	"testing"
+	"time"
+
+	"google.golang.org/protobuf/types/known/wrapperspb"
+
+	"github.com/fullstorydev/grpcurl"
+)
+
+// sinkListener accepts connections and sends everything read from each one
+// on a channel, once the connection is closed.
+func sinkListener(t *testing.T, network, address string) (net.Listener, <-chan string) {
+	t.Helper()
+	l, err := net.Listen(network, address)
+	if err != nil {
+		t.Fatalf("failed to listen: %v", err)
+	}
+	t.Cleanup(func() { _ = l.Close() })
+	received := make(chan string, 10)
+	go func() {
+		for {
+			conn, err := l.Accept()
+			if err != nil {
+				return
+			}
+			go func() {
+				b, _ := io.ReadAll(conn)
+				_ = conn.Close()
+				received <- string(b)
+			}()
+		}
+	}()
+	return l, received
+}
+
+func receiveString(t *testing.T, ch <-chan string) string {
+	t.Helper()
+	select {
+	case s := <-ch:
+		return s
+	case <-time.After(5 * time.Second):
+		t.Fatal("timed out waiting for sink to receive data")
+		return ""
+	}
+}
+
+func TestOpenOutputFile(t *testing.T) {
+	file := filepath.Join(t.TempDir(), "out.txt")
+	if err := os.WriteFile(file, []byte("previous contents"), 0644); err != nil {
+		t.Fatalf("failed to write file: %v", err)
+	}
+	w, err := openOutput(file, false)
+	if err != nil {
+		t.Fatalf("failed to open output: %v", err)
+	}
+	if _, ok := w.(syncer); !ok {
+		t.Error("file output should support syncing, for -flush-each")
+	}
+	_, _ = io.WriteString(w, "hello\n")
+	if err := w.Close(); err != nil {
+		t.Fatalf("failed to close output: %v", err)
+	}
+	b, err := os.ReadFile(file)
+	if err != nil {
+		t.Fatalf("failed to read file: %v", err)
+	}
+	if string(b) != "hello\n" {
+		t.Errorf("expecting file to be truncated and written, got %q", b)
+	}
+
+	if _, err := openOutput(filepath.Join(t.TempDir(), "no-such-dir", "out.txt"), false); err == nil {
+		t.Error("expecting error creating file in missing directory")
+	}
+}
+
+func TestOpenOutputSocket(t *testing.T) {
+	testCases := []struct {
+		network, address string
+	}{
+		{network: "tcp", address: "127.0.0.1:0"},
+		{network: "unix", address: filepath.Join(t.TempDir(), "sink.sock")},
+	}
+	for _, tc := range testCases {
+		t.Run(tc.network, func(t *testing.T) {
+			if tc.network == "unix" && runtime.GOOS == "windows" {
+				t.Skip("unix sockets are not supported")
+			}
+			l, received := sinkListener(t, tc.network, tc.address)
+			w, err := openOutput(tc.network+"://"+l.Addr().String(), false)
+			if err != nil {
+				t.Fatalf("failed to open output: %v", err)
+			}
+			_, _ = io.WriteString(w, "first\n")
+			_, _ = io.WriteString(w, "second\n")
+			if err := w.Close(); err != nil {
+				t.Fatalf("failed to close output: %v", err)
+			}
+			if got := receiveString(t, received); got != "first\nsecond\n" {
+				t.Errorf("wrong data received by sink: %q", got)
+			}
+		})
+	}
+
+	l, _ := sinkListener(t, "tcp", "127.0.0.1:0")
+	addr := l.Addr().String()
+	_ = l.Close()
+	if _, err := openOutput("tcp://"+addr, false); err == nil {
+		t.Error("expecting error connecting to sink with no listener")
+	}
+}
+
+func TestNetSinkReconnect(t *testing.T) {
+	l, received := sinkListener(t, "tcp", "127.0.0.1:0")
+	w, err := openOutput("tcp://"+l.Addr().String(), true)
+	if err != nil {
+		t.Fatalf("failed to open output: %v", err)
+	}
+	defer w.Close()
+	sink := w.(*netSink)
+
+	// break the connection from the client side, so the next write fails
+	sink.mu.Lock()
+	_ = sink.conn.Close()
+	sink.mu.Unlock()
+	if got := receiveString(t, received); got != "" {
+		t.Errorf("expecting nothing on first connection, got %q", got)
+	}
+	if _, err := io.WriteString(w, "after reconnect\n"); err != nil {
+		t.Fatalf("expecting write to succeed after reconnecting, got %v", err)
+	}
+	_ = w.Close()
+	if got := receiveString(t, received); got != "after reconnect\n" {
+		t.Errorf("wrong data received after reconnect: %q", got)
+	}
+}
+
+type failingWriter struct {
+	writes int
+}
+
+func (w *failingWriter) Write(p []byte) (int, error) {
+	w.writes++
+	return 0, errors.New("broken pipe")
+}
+
+func TestErrWriter(t *testing.T) {
+	fw := &failingWriter{}
+	w := &errWriter{w: fw}
+	if _, err := w.Write([]byte("a")); err == nil {
+		t.Fatal("expecting first write to fail")
+	}
+	// later writes are discarded
+	if n, err := w.Write([]byte("bc")); n != 2 || err != nil {
+		t.Errorf("expecting later write to be discarded, got %d, %v", n, err)
+	}
+	if fw.writes != 1 || w.err == nil || w.err.Error() != "broken pipe" {
+		t.Errorf("expecting first error to be remembered after one write, got %d writes and %v", fw.writes, w.err)
+	}
+}
+
+// syncRecorder records the output written before each call to Sync.
+type syncRecorder struct {
+	bytes.Buffer
+	synced []string
+}
+
+func (s *syncRecorder) Sync() error {
+	s.synced = append(s.synced, s.String())
+	return errors.New("sync not supported")
+}
+
+func TestFlushingHandler(t *testing.T) {
+	out := &syncRecorder{}
+	h := &flushingHandler{
+		InvocationEventHandler: &grpcurl.DefaultEventHandler{Out: out, Formatter: grpcurl.NewJSONFormatter(false, nil)},
+		out:                    out,
+	}
+	h.OnReceiveResponse(wrapperspb.String("abc"))
+	h.OnReceiveResponse(wrapperspb.String("def"))
+	// each response is written in full before the output is synced, and a
+	// failure to sync does not stop later responses
+	expected := []string{"\"abc\"\n", "\"abc\"\n\"def\"\n"}
+	if !reflect.DeepEqual(out.synced, expected) {
+		t.Errorf("expecting output %q when synced, got %q", expected, out.synced)
+	}
+}
@@ -0,0 +1,138 @@
+package main
+
+import (
+	"fmt"
+	"io"
+	"strings"
+
+	"github.com/golang/protobuf/proto" //lint:ignore SA1019 we have to import this because it appears in exported API
+	"github.com/jhump/protoreflect/desc"
+	"github.com/jhump/protoreflect/dynamic"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/status"
+	"google.golang.org/protobuf/types/descriptorpb"
+
+	"github.com/fullstorydev/grpcurl"
+)
+
+// paginator invokes a unary method repeatedly, for the -paginate flag. After
+// each page, the page token in the response is copied into the request for
+// the next page, until a response has an empty token. It also acts as the
+// event handler for each invocation, so it can find the token.
+type paginator struct {
+	grpcurl.InvocationEventHandler
+	respField string
+	reqField  string
+
+	req   proto.Message // the first request, as given by the user
+	token string        // page token from the latest response
+	stat  *status.Status
+	pages int
+}
+
+// newPaginator parses the value of the -paginate flag, which is in
+// 'response-field:request-field' form, and verifies that the named fields
+// exist in the given method's messages and can hold a page token.
+func newPaginator(spec string, mtd *desc.MethodDescriptor) (*paginator, error) {
+	respField, reqField, ok := strings.Cut(spec, ":")
+	if !ok || respField == "" || reqField == "" {
+		return nil, fmt.Errorf("value %q must be in 'response-field:request-field' form", spec)
+	}
+	if mtd.IsClientStreaming() || mtd.IsServerStreaming() {
+		return nil, fmt.Errorf("method %q is a streaming RPC; only unary RPCs can be paginated", mtd.GetFullyQualifiedName())
+	}
+	if err := checkTokenField(mtd.GetOutputType(), respField); err != nil {
+		return nil, err
+	}
+	if err := checkTokenField(mtd.GetInputType(), reqField); err != nil {
+		return nil, err
+	}
+	return &paginator{respField: respField, reqField: reqField}, nil
+}
+
+func checkTokenField(md *desc.MessageDescriptor, name string) error {
+	fld := md.FindFieldByName(name)
+	if fld == nil {
+		return fmt.Errorf("message %s has no field named %q", md.GetFullyQualifiedName(), name)
+	}
+	if fld.IsRepeated() || fld.GetType() != descriptorpb.FieldDescriptorProto_TYPE_STRING {
+		return fmt.Errorf("field %s is not a singular string field, so it cannot hold a page token", fld.GetFullyQualifiedName())
+	}
+	return nil
+}
+
+// invoke calls the given function once per page. The function should invoke
+// the RPC using the given handler and request supplier. The given request
+// supplier provides the request for the first page. It returns when a page
+// has an empty token or when an invocation fails, in which case the returned
+// error, or the handler's status, describes the failure.
+func (p *paginator) invoke(handler grpcurl.InvocationEventHandler, requestData grpcurl.RequestSupplier,
+	invoke func(grpcurl.InvocationEventHandler, grpcurl.RequestSupplier) error) error {
+
+	p.InvocationEventHandler = handler
+	supplier := p.firstPage(requestData)
+	var prevToken string
+	for {
+		p.token = ""
+		p.stat = nil
+		err := invoke(p, supplier)
+		p.pages++
+		if err != nil || p.stat.Code() != codes.OK || p.token == "" {
+			return err
+		}
+		if p.token == prevToken {
+			return fmt.Errorf("server returned the same page token %q for pages %d and %d", p.token, p.pages-1, p.pages)
+		}
+		prevToken = p.token
+		supplier = p.nextPage(p.token)
+	}
+}
+
+// firstPage wraps the given request supplier so that a copy of the request is
+// kept, for use as the basis of the requests for subsequent pages.
+func (p *paginator) firstPage(requestData grpcurl.RequestSupplier) grpcurl.RequestSupplier {
+	return func(m proto.Message) error {
+		err := requestData(m)
+		if err == nil && p.req == nil {
+			p.req = proto.Clone(m)
+		}
+		return err
+	}
+}
+
+// nextPage returns a request supplier that provides a single request, which
+// is the first request with its token field set to the given token.
+func (p *paginator) nextPage(token string) grpcurl.RequestSupplier {
+	sent := false
+	return func(m proto.Message) error {
+		if sent {
+			return io.EOF
+		}
+		sent = true
+		dm, ok := m.(*dynamic.Message)
+		if !ok {
+			return fmt.Errorf("cannot set page token in request of type %T", m)
+		}
+		if p.req != nil {
+			if err := dm.MergeFrom(p.req); err != nil {
+				return err
+			}
+		}
+		return dm.TrySetFieldByName(p.reqField, token)
+	}
+}
+
+func (p *paginator) OnReceiveResponse(resp proto.Message) {
+	if dm, ok := resp.(*dynamic.Message); ok {
+		if v, err := dm.TryGetFieldByName(p.respField); err == nil {
+			p.token, _ = v.(string)
+		}
+	}
+	p.InvocationEventHandler.OnReceiveResponse(resp)
+}
+
+func (p *paginator) OnReceiveTrailers(stat *status.Status, md metadata.MD) {
+	p.stat = stat
+	p.InvocationEventHandler.OnReceiveTrailers(stat, md)
+}
@@ -0,0 +1,91 @@
+package main
+
+import (
+	"io"
+	"strings"
+	"testing"
+
+	"github.com/golang/protobuf/proto" //lint:ignore SA1019 we have to import this because it appears in exported API
+	"github.com/jhump/protoreflect/desc/protoparse"
+	"github.com/jhump/protoreflect/dynamic"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+
+	"github.com/fullstorydev/grpcurl"
+)
+
+const pagedProto = `
+syntax = "proto3";
+package paged;
+message ListRequest {
+  string filter = 1;
+  string page_token = 2;
+}
+message ListResponse {
+  repeated string items = 1;
+  string next_page_token = 2;
+}
+service Lister {
+  rpc List(ListRequest) returns (ListResponse);
+  rpc Watch(ListRequest) returns (stream ListResponse);
+}
+`
+
+func TestPaginator(t *testing.T) {
+	fds, err := (&protoparse.Parser{
+		Accessor: protoparse.FileContentsFromMap(map[string]string{"paged.proto": pagedProto}),
+	}).ParseFiles("paged.proto")
+	if err != nil {
+		t.Fatalf("failed to parse proto: %v", err)
+	}
+	svc := fds[0].FindService("paged.Lister")
+	mtd := svc.FindMethodByName("List")
+
+	for _, spec := range []string{"next_page_token", "next_page_token:", "nope:page_token", "next_page_token:nope", "items:page_token"} {
+		if _, err := newPaginator(spec, mtd); err == nil {
+			t.Errorf("expecting error for -paginate %q", spec)
+		}
+	}
+	if _, err := newPaginator("next_page_token:page_token", svc.FindMethodByName("Watch")); err == nil {
+		t.Error("expecting error for streaming method")
+	}
+
+	p, err := newPaginator("next_page_token:page_token", mtd)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	// the fake server returns these next page tokens, keyed by request token
+	pages := map[string]string{"": "a", "a": "b", "b": ""}
+	var filters, tokens []string
+	h := &grpcurl.DefaultEventHandler{Out: io.Discard, Formatter: func(proto.Message) (string, error) { return "", nil }}
+	err = p.invoke(h, grpcurl.NewJSONRequestParser(strings.NewReader(`{"filter": "x"}`), nil).Next,
+		func(handler grpcurl.InvocationEventHandler, requestData grpcurl.RequestSupplier) error {
+			req := dynamic.NewMessage(mtd.GetInputType())
+			if err := requestData(req); err != nil {
+				return err
+			}
+			if err := requestData(dynamic.NewMessage(mtd.GetInputType())); err != io.EOF {
+				t.Errorf("expecting a single request per page, got %v", err)
+			}
+			filters = append(filters, req.GetFieldByName("filter").(string))
+			token := req.GetFieldByName("page_token").(string)
+			tokens = append(tokens, token)
+			resp := dynamic.NewMessage(mtd.GetOutputType())
+			resp.SetFieldByName("next_page_token", pages[token])
+			handler.OnReceiveResponse(resp)
+			handler.OnReceiveTrailers(status.New(codes.OK, ""), nil)
+			return nil
+		})
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if p.pages != 3 || h.NumResponses != 3 {
+		t.Errorf("expecting 3 pages and responses, got %d and %d", p.pages, h.NumResponses)
+	}
+	expectedTokens := []string{"", "a", "b"}
+	for i := range expectedTokens {
+		if i >= len(tokens) || tokens[i] != expectedTokens[i] || filters[i] != "x" {
+			t.Fatalf("wrong requests: tokens %q, filters %q", tokens, filters)
+		}
+	}
+}
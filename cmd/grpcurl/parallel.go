@@ -0,0 +1,39 @@
+package main
+
+import (
+	"fmt"
+	"io"
+	"sort"
+	"time"
+
+	"google.golang.org/grpc/codes"
+
+	"github.com/fullstorydev/grpcurl"
+)
+
+// printParallelResult writes a summary of the calls made for the -n flag:
+// the number of calls with each status code and latency percentiles.
+func printParallelResult(out io.Writer, res *grpcurl.ParallelResult) {
+	rate := float64(res.Total()) / res.Elapsed.Seconds()
+	fmt.Fprintf(out, "Sent %d requests in %v (%.1f requests/sec)\n", res.Total(), res.Elapsed.Round(time.Millisecond), rate)
+
+	fmt.Fprintf(out, "\nStatus codes:\n")
+	statusCodes := make([]codes.Code, 0, len(res.Codes))
+	for c := range res.Codes {
+		statusCodes = append(statusCodes, c)
+	}
+	sort.Slice(statusCodes, func(i, j int) bool {
+		return statusCodes[i] < statusCodes[j]
+	})
+	for _, c := range statusCodes {
+		fmt.Fprintf(out, "  %s: %d\n", c, res.Codes[c])
+	}
+
+	fmt.Fprintf(out, "\nLatency:\n")
+	for _, p := range []struct {
+		name string
+		pct  float64
+	}{{"min", 0}, {"p50", 50}, {"p90", 90}, {"p99", 99}, {"max", 100}} {
+		fmt.Fprintf(out, "  %s: %v\n", p.name, res.Percentile(p.pct).Round(time.Microsecond))
+	}
+}
@@ -0,0 +1,45 @@
+package main
+
+import (
+	"context"
+	"crypto/tls"
+	"net"
+	"time"
+
+	"golang.org/x/net/http2"
+)
+
+// measurePing opens a separate HTTP/2 connection to the given address, sends
+// a PING frame, and returns the time until its acknowledgement is received.
+// Connection establishment, including any TLS handshake, is not included in
+// the result. If tlsConf is nil, the connection uses plaintext (h2c).
+func measurePing(ctx context.Context, network, address string, tlsConf *tls.Config, serverName string) (time.Duration, error) {
+	var dialer net.Dialer
+	conn, err := dialer.DialContext(ctx, network, address)
+	if err != nil {
+		return 0, err
+	}
+	defer conn.Close()
+	if tlsConf != nil {
+		tlsConf = tlsConf.Clone()
+		tlsConf.NextProtos = []string{http2.NextProtoTLS}
+		if tlsConf.ServerName == "" {
+			tlsConf.ServerName = serverName
+		}
+		tlsConn := tls.Client(conn, tlsConf)
+		if err := tlsConn.HandshakeContext(ctx); err != nil {
+			return 0, err
+		}
+		conn = tlsConn
+	}
+	cc, err := (&http2.Transport{}).NewClientConn(conn)
+	if err != nil {
+		return 0, err
+	}
+	defer cc.Close()
+	start := time.Now()
+	if err := cc.Ping(ctx); err != nil {
+		return 0, err
+	}
+	return time.Since(start), nil
+}
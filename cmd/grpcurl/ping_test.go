@@ -0,0 +1,34 @@
+package main
+
+import (
+	"context"
+	"net"
+	"testing"
+	"time"
+)
+
+func TestMeasurePing(t *testing.T) {
+	cc, _ := dialTestServer(t)
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	// the test server speaks HTTP/2 without TLS, so it answers the PING
+	rtt, err := measurePing(ctx, "tcp", cc.Target(), nil, "")
+	if err != nil {
+		t.Fatalf("failed to ping: %v", err)
+	}
+	if rtt <= 0 || rtt > 5*time.Second {
+		t.Errorf("implausible round-trip time: %v", rtt)
+	}
+
+	// nothing listens on a closed listener's address
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("failed to listen: %v", err)
+	}
+	addr := l.Addr().String()
+	_ = l.Close()
+	if _, err := measurePing(ctx, "tcp", addr, nil, ""); err == nil {
+		t.Error("expecting error pinging an address with no server")
+	}
+}
@@ -0,0 +1,95 @@
+package main
+
+import (
+	"flag"
+	"regexp"
+	"strings"
+)
+
+// commandHeaderFlags are the names of flags whose values are headers. These
+// are printed with their resolved values, after any expansion, instead of
+// their values as given.
+var commandHeaderFlags = map[string]bool{"H": true, "rpc-header": true, "reflect-header": true}
+
+// commandSkippedFlags are the names of flags that are not printed by
+// equivalentCommand, because their effect is already captured in resolved
+// headers or data, or because they don't affect the invocation.
+var commandSkippedFlags = map[string]bool{
+	"print-command":       true,
+	"expand-headers":      true, // headers are printed after expansion
+	"token-cmd":           true, // the token is printed as an authorization header
+	"token-file":          true,
+	"token-prefix":        true,
+	"rpc-header-file":     true, // the file's headers are printed as resolved
+	"reflect-header-file": true,
+	"d":                   true, // the data is printed as read
+	"d-cmd":               true,
+}
+
+// sensitiveHeaderRegex matches the names of headers whose values are
+// redacted by equivalentCommand, since they likely hold credentials.
+var sensitiveHeaderRegex = regexp.MustCompile(`(?i)^(proxy-)?authorization$|^(set-)?cookie$|token|secret|password|passwd|api-?key|credential|session`)
+
+// equivalentCommand returns a grpcurl command line, suitable for a POSIX
+// shell, that reproduces an invocation. It includes all flags that were set
+// in the given flag set, except that headers are given by the resolved
+// headers and request data by the given data. The values of sensitive
+// headers, like "authorization", are replaced by "REDACTED".
+func equivalentCommand(fs *flag.FlagSet, resolvedHeaders map[string][]string, data string, hasData bool, args []string) string {
+	parts := []string{"grpcurl"}
+	fs.Visit(func(f *flag.Flag) {
+		if commandSkippedFlags[f.Name] || commandHeaderFlags[f.Name] {
+			return
+		}
+		if ms, ok := f.Value.(*multiString); ok {
+			for _, v := range *ms {
+				parts = append(parts, "-"+f.Name, shellQuote(v))
+			}
+			return
+		}
+		if bf, ok := f.Value.(interface{ IsBoolFlag() bool }); ok && bf.IsBoolFlag() {
+			if v := f.Value.String(); v == "true" {
+				parts = append(parts, "-"+f.Name)
+			} else {
+				parts = append(parts, "-"+f.Name+"="+shellQuote(v))
+			}
+			return
+		}
+		parts = append(parts, "-"+f.Name, shellQuote(f.Value.String()))
+	})
+	for _, name := range []string{"H", "rpc-header", "reflect-header"} {
+		for _, hdr := range resolvedHeaders[name] {
+			parts = append(parts, "-"+name, shellQuote(redactHeader(hdr)))
+		}
+	}
+	if hasData {
+		// data read from a file usually ends with a newline, which is noise
+		parts = append(parts, "-d", shellQuote(strings.TrimRight(data, "\r\n")))
+	}
+	for _, arg := range args {
+		parts = append(parts, shellQuote(arg))
+	}
+	return strings.Join(parts, " ")
+}
+
+// redactHeader replaces the value of the given header, in 'name: value' form,
+// if it is sensitive.
+func redactHeader(hdr string) string {
+	name, _, _ := strings.Cut(hdr, ":")
+	name = strings.TrimSpace(name)
+	if sensitiveHeaderRegex.MatchString(name) {
+		return name + ": REDACTED"
+	}
+	return hdr
+}
+
+var shellSafeRegex = regexp.MustCompile(`^[A-Za-z0-9_@%+=:,./-]+$`)
+
+// shellQuote quotes the given string, if necessary, so that a POSIX shell
+// treats it as a single word.
+func shellQuote(s string) string {
+	if shellSafeRegex.MatchString(s) {
+		return s
+	}
+	return "'" + strings.ReplaceAll(s, "'", `'\''`) + "'"
+}
@@ -0,0 +1,38 @@
+package main
+
+import (
+	"flag"
+	"io"
+	"testing"
+)
+
+func TestEquivalentCommand(t *testing.T) {
+	fs := flag.NewFlagSet("grpcurl", flag.ContinueOnError)
+	fs.SetOutput(io.Discard)
+	var paths multiString
+	fs.Var(&paths, "import-path", "")
+	fs.Bool("plaintext", false, "")
+	fs.Bool("emit-defaults", true, "")
+	fs.String("format", "json", "")
+	fs.String("d", "", "")
+	fs.Bool("print-command", false, "")
+	var hdrs multiString
+	fs.Var(&hdrs, "H", "")
+	err := fs.Parse([]string{"-plaintext", "-emit-defaults=false", "-import-path", "a", "-import-path", "b c",
+		"-format", "text", "-d", "@req.json", "-print-command", "-H", "x: ${X}", "host:443", "svc/Method"})
+	if err != nil {
+		t.Fatalf("failed to parse flags: %v", err)
+	}
+
+	headers := map[string][]string{
+		"H":          {"x: expanded", "Authorization: Bearer abc"},
+		"rpc-header": {"x-api-key: 123", "note: it's"},
+	}
+	cmd := equivalentCommand(fs, headers, "{\"a\": 1}\n", true, fs.Args())
+	expected := `grpcurl -emit-defaults=false -format text -import-path a -import-path 'b c' -plaintext ` +
+		`-H 'x: expanded' -H 'Authorization: REDACTED' -rpc-header 'x-api-key: REDACTED' -rpc-header 'note: it'\''s' ` +
+		`-d '{"a": 1}' host:443 svc/Method`
+	if cmd != expected {
+		t.Errorf("wrong command:\nexpected: %s\ngot:      %s", expected, cmd)
+	}
+}
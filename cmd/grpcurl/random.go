@@ -0,0 +1,48 @@
+package main
+
+import (
+	"io"
+	"math/rand"
+
+	"github.com/golang/protobuf/proto" //lint:ignore SA1019 we have to import this because it appears in exported API
+	"github.com/jhump/protoreflect/desc"
+
+	"github.com/fullstorydev/grpcurl"
+)
+
+// randomRequestParser is a grpcurl.RequestParser that, instead of parsing
+// input, supplies a single request message whose fields are populated with
+// random values.
+type randomRequestParser struct {
+	rnd          *rand.Rand
+	requestCount int
+}
+
+func newRandomRequestParser(seed int64) *randomRequestParser {
+	return &randomRequestParser{rnd: rand.New(rand.NewSource(seed))}
+}
+
+func (p *randomRequestParser) Next(m proto.Message) error {
+	if p.requestCount > 0 {
+		return io.EOF
+	}
+	md, err := desc.LoadMessageDescriptorForMessage(m)
+	if err != nil {
+		return err
+	}
+	// round-trip through the binary format, so that the generated data is
+	// copied into the given message regardless of its concrete type
+	b, err := proto.Marshal(grpcurl.MakeRandomMessage(md, p.rnd))
+	if err != nil {
+		return err
+	}
+	if err := proto.Unmarshal(b, m); err != nil {
+		return err
+	}
+	p.requestCount++
+	return nil
+}
+
+func (p *randomRequestParser) NumRequests() int {
+	return p.requestCount
+}
@@ -0,0 +1,86 @@
+package main
+
+import (
+	"context"
+	"strings"
+	"sync"
+
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/metadata"
+
+	"github.com/fullstorydev/grpcurl"
+)
+
+// reflectHeaderCapture records the response headers of server reflection
+// calls. The reflection client does not expose them, so they are captured
+// by a stream interceptor on the connection instead.
+type reflectHeaderCapture struct {
+	mu     sync.Mutex
+	header metadata.MD
+}
+
+func (c *reflectHeaderCapture) interceptor(ctx context.Context, desc *grpc.StreamDesc, cc *grpc.ClientConn, method string, streamer grpc.Streamer, opts ...grpc.CallOption) (grpc.ClientStream, error) {
+	cs, err := streamer(ctx, desc, cc, method, opts...)
+	if err != nil || !isReflectionMethod(method) {
+		return cs, err
+	}
+	return &headerCapturingStream{ClientStream: cs, capture: c}, nil
+}
+
+// Get returns the values of the given header from the most recent reflection
+// response.
+func (c *reflectHeaderCapture) Get(name string) []string {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.header.Get(name)
+}
+
+func isReflectionMethod(method string) bool {
+	return strings.HasPrefix(method, "/grpc.reflection.v1.ServerReflection/") ||
+		strings.HasPrefix(method, "/grpc.reflection.v1alpha.ServerReflection/")
+}
+
+// headerCapturingStream records the stream's response headers once the first
+// response message has been received, at which point they are available.
+type headerCapturingStream struct {
+	grpc.ClientStream
+	capture *reflectHeaderCapture
+	once    sync.Once
+}
+
+func (s *headerCapturingStream) RecvMsg(m interface{}) error {
+	err := s.ClientStream.RecvMsg(m)
+	if err == nil {
+		s.once.Do(func() {
+			if md, err := s.ClientStream.Header(); err == nil {
+				s.capture.mu.Lock()
+				s.capture.header = md
+				s.capture.mu.Unlock()
+			}
+		})
+	}
+	return err
+}
+
+// carriedHeaders returns the given headers, named by -carry-reflect-header,
+// in 'name: value' form, from the reflection response. To make sure there is a
+// reflection response, it first resolves the service of the given method,
+// which the invocation would otherwise do itself.
+func carriedHeaders(descSource grpcurl.DescriptorSource, symbol string, capture *reflectHeaderCapture, names []string) []string {
+	if pos := strings.LastIndexAny(symbol, "/."); pos > 0 {
+		// errors are reported when the RPC is invoked
+		_, _ = descSource.FindSymbol(symbol[:pos])
+	}
+	var headers []string
+	for _, name := range names {
+		vals := capture.Get(name)
+		if len(vals) == 0 {
+			warn("Reflection response did not include header %q (-carry-reflect-header).", name)
+			continue
+		}
+		for _, val := range vals {
+			headers = append(headers, name+": "+val)
+		}
+	}
+	return headers
+}
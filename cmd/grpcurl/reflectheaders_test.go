@@ -0,0 +1,65 @@
+package main
+
+import (
+	"context"
+	"net"
+	"reflect"
+	"testing"
+
+	"github.com/jhump/protoreflect/grpcreflect"
+	"google.golang.org/grpc"
+	insecureCreds "google.golang.org/grpc/credentials/insecure"
+	"google.golang.org/grpc/metadata"
+	grpcReflection "google.golang.org/grpc/reflection"
+
+	"github.com/fullstorydev/grpcurl"
+	grpcurl_testing "github.com/fullstorydev/grpcurl/internal/testing"
+)
+
+func TestIsReflectionMethod(t *testing.T) {
+	testCases := map[string]bool{
+		"/grpc.reflection.v1.ServerReflection/ServerReflectionInfo":      true,
+		"/grpc.reflection.v1alpha.ServerReflection/ServerReflectionInfo": true,
+		"/testing.TestService/EmptyCall":                                 false,
+		"/grpc.reflection.v2.ServerReflection/ServerReflectionInfo":      false,
+	}
+	for method, expected := range testCases {
+		if got := isReflectionMethod(method); got != expected {
+			t.Errorf("%s: expecting %v, got %v", method, expected, got)
+		}
+	}
+}
+
+func TestCarriedHeaders(t *testing.T) {
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("failed to listen: %v", err)
+	}
+	// the server sends a header with reflection responses only
+	svr := grpc.NewServer(grpc.StreamInterceptor(func(srv interface{}, ss grpc.ServerStream, info *grpc.StreamServerInfo, handler grpc.StreamHandler) error {
+		if isReflectionMethod(info.FullMethod) {
+			_ = ss.SetHeader(metadata.Pairs("x-routing-token", "abc", "x-routing-token", "def"))
+		}
+		return handler(srv, ss)
+	}))
+	grpcurl_testing.RegisterTestServiceServer(svr, grpcurl_testing.TestServer{})
+	grpcReflection.Register(svr)
+	go svr.Serve(l)
+	defer svr.Stop()
+
+	capture := &reflectHeaderCapture{}
+	cc, err := grpc.Dial(l.Addr().String(), grpc.WithTransportCredentials(insecureCreds.NewCredentials()), grpc.WithStreamInterceptor(capture.interceptor))
+	if err != nil {
+		t.Fatalf("failed to dial: %v", err)
+	}
+	defer cc.Close()
+	refClient := grpcreflect.NewClientAuto(context.Background(), cc)
+	defer refClient.Reset()
+	source := grpcurl.DescriptorSourceFromServer(context.Background(), refClient)
+
+	headers := carriedHeaders(source, "testing.TestService/EmptyCall", capture, []string{"x-routing-token", "x-missing"})
+	expected := []string{"x-routing-token: abc", "x-routing-token: def"}
+	if !reflect.DeepEqual(headers, expected) {
+		t.Errorf("expecting headers %q, got %q", expected, headers)
+	}
+}
@@ -0,0 +1,273 @@
+package main
+
+import (
+	"fmt"
+	"io"
+	"sort"
+	"strings"
+
+	"github.com/jhump/protoreflect/desc"
+
+	"github.com/fullstorydev/grpcurl"
+)
+
+// schemaChange is one difference between two schemas.
+type schemaChange struct {
+	// "+" for an added element, "-" for a removed one, or "~" for one
+	// that is present in both schemas but differs
+	Op string
+	// the kind of element, such as "service", "method", or "field"
+	Kind string
+	// the fully-qualified name of the element
+	Name string
+	// for changed elements, a description of what changed
+	Detail string
+}
+
+func (c schemaChange) String() string {
+	if c.Detail == "" {
+		return fmt.Sprintf("%s %s %s", c.Op, c.Kind, c.Name)
+	}
+	return fmt.Sprintf("%s %s %s: %s", c.Op, c.Kind, c.Name, c.Detail)
+}
+
+// diffSchemas compares the services in the two given sources. Services and
+// methods are matched by fully-qualified name. The request and response types
+// of methods in both schemas are compared, including any message and enum
+// types they reference, with fields and enum values matched by number. The
+// changes are returned in a stable order: by service, and then in the order
+// in which elements are reached from it.
+func diffSchemas(oldSource, newSource grpcurl.DescriptorSource) ([]schemaChange, error) {
+	oldSvcs, err := resolveServices(oldSource)
+	if err != nil {
+		return nil, err
+	}
+	newSvcs, err := resolveServices(newSource)
+	if err != nil {
+		return nil, err
+	}
+	d := schemaDiffer{seen: map[string]bool{}}
+	for _, name := range unionKeys(oldSvcs, newSvcs) {
+		o, n := oldSvcs[name], newSvcs[name]
+		switch {
+		case o == nil:
+			d.add("+", "service", name, "")
+		case n == nil:
+			d.add("-", "service", name, "")
+		default:
+			d.diffService(o, n)
+		}
+	}
+	return d.changes, nil
+}
+
+func resolveServices(source grpcurl.DescriptorSource) (map[string]*desc.ServiceDescriptor, error) {
+	names, err := grpcurl.ListServices(source)
+	if err != nil {
+		return nil, err
+	}
+	svcs := make(map[string]*desc.ServiceDescriptor, len(names))
+	for _, name := range names {
+		d, err := source.FindSymbol(name)
+		if err != nil {
+			return nil, err
+		}
+		sd, ok := d.(*desc.ServiceDescriptor)
+		if !ok {
+			return nil, fmt.Errorf("%s is not a service: %T", name, d)
+		}
+		svcs[name] = sd
+	}
+	return svcs, nil
+}
+
+type schemaDiffer struct {
+	changes []schemaChange
+	// names of message and enum types already compared
+	seen map[string]bool
+}
+
+func (d *schemaDiffer) add(op, kind, name, detail string) {
+	d.changes = append(d.changes, schemaChange{Op: op, Kind: kind, Name: name, Detail: detail})
+}
+
+func (d *schemaDiffer) diffService(o, n *desc.ServiceDescriptor) {
+	oldMethods := map[string]*desc.MethodDescriptor{}
+	for _, md := range o.GetMethods() {
+		oldMethods[md.GetName()] = md
+	}
+	newMethods := map[string]*desc.MethodDescriptor{}
+	for _, md := range n.GetMethods() {
+		newMethods[md.GetName()] = md
+	}
+	for _, name := range unionKeys(oldMethods, newMethods) {
+		om, nm := oldMethods[name], newMethods[name]
+		switch {
+		case om == nil:
+			d.add("+", "method", nm.GetFullyQualifiedName(), "")
+		case nm == nil:
+			d.add("-", "method", om.GetFullyQualifiedName(), "")
+		default:
+			d.diffMethod(om, nm)
+		}
+	}
+}
+
+func (d *schemaDiffer) diffMethod(o, n *desc.MethodDescriptor) {
+	name := o.GetFullyQualifiedName()
+	if o.GetInputType().GetFullyQualifiedName() != n.GetInputType().GetFullyQualifiedName() {
+		d.add("~", "method", name, fmt.Sprintf("request type %s -> %s", o.GetInputType().GetFullyQualifiedName(), n.GetInputType().GetFullyQualifiedName()))
+	}
+	if o.GetOutputType().GetFullyQualifiedName() != n.GetOutputType().GetFullyQualifiedName() {
+		d.add("~", "method", name, fmt.Sprintf("response type %s -> %s", o.GetOutputType().GetFullyQualifiedName(), n.GetOutputType().GetFullyQualifiedName()))
+	}
+	if o.IsClientStreaming() != n.IsClientStreaming() || o.IsServerStreaming() != n.IsServerStreaming() {
+		d.add("~", "method", name, fmt.Sprintf("%s -> %s", streamingKind(o), streamingKind(n)))
+	}
+	if o.GetInputType().GetFullyQualifiedName() == n.GetInputType().GetFullyQualifiedName() {
+		d.diffMessage(o.GetInputType(), n.GetInputType())
+	}
+	if o.GetOutputType().GetFullyQualifiedName() == n.GetOutputType().GetFullyQualifiedName() {
+		d.diffMessage(o.GetOutputType(), n.GetOutputType())
+	}
+}
+
+func (d *schemaDiffer) diffMessage(o, n *desc.MessageDescriptor) {
+	name := o.GetFullyQualifiedName()
+	if d.seen[name] {
+		return
+	}
+	d.seen[name] = true
+	oldFields := map[int32]*desc.FieldDescriptor{}
+	for _, fd := range o.GetFields() {
+		oldFields[fd.GetNumber()] = fd
+	}
+	newFields := map[int32]*desc.FieldDescriptor{}
+	for _, fd := range n.GetFields() {
+		newFields[fd.GetNumber()] = fd
+	}
+	for _, num := range unionNumbers(oldFields, newFields) {
+		of, nf := oldFields[num], newFields[num]
+		switch {
+		case of == nil:
+			d.add("+", "field", nf.GetFullyQualifiedName(), fmt.Sprintf("%s = %d", fieldTypeName(nf), num))
+		case nf == nil:
+			d.add("-", "field", of.GetFullyQualifiedName(), fmt.Sprintf("%s = %d", fieldTypeName(of), num))
+		default:
+			d.diffField(of, nf)
+		}
+	}
+}
+
+func (d *schemaDiffer) diffField(o, n *desc.FieldDescriptor) {
+	name := o.GetFullyQualifiedName()
+	if o.GetName() != n.GetName() {
+		d.add("~", "field", name, fmt.Sprintf("renamed to %s", n.GetName()))
+	}
+	oldType, newType := fieldTypeName(o), fieldTypeName(n)
+	if oldType != newType {
+		d.add("~", "field", name, fmt.Sprintf("type %s -> %s", oldType, newType))
+		return
+	}
+	if o.GetMessageType() != nil {
+		d.diffMessage(o.GetMessageType(), n.GetMessageType())
+	} else if o.GetEnumType() != nil {
+		d.diffEnum(o.GetEnumType(), n.GetEnumType())
+	}
+}
+
+func (d *schemaDiffer) diffEnum(o, n *desc.EnumDescriptor) {
+	name := o.GetFullyQualifiedName()
+	if d.seen[name] {
+		return
+	}
+	d.seen[name] = true
+	oldValues := map[int32]*desc.EnumValueDescriptor{}
+	for _, vd := range o.GetValues() {
+		oldValues[vd.GetNumber()] = vd
+	}
+	newValues := map[int32]*desc.EnumValueDescriptor{}
+	for _, vd := range n.GetValues() {
+		newValues[vd.GetNumber()] = vd
+	}
+	for _, num := range unionNumbers(oldValues, newValues) {
+		ov, nv := oldValues[num], newValues[num]
+		switch {
+		case ov == nil:
+			d.add("+", "enum value", nv.GetFullyQualifiedName(), fmt.Sprintf("= %d", num))
+		case nv == nil:
+			d.add("-", "enum value", ov.GetFullyQualifiedName(), fmt.Sprintf("= %d", num))
+		case ov.GetName() != nv.GetName():
+			d.add("~", "enum value", ov.GetFullyQualifiedName(), fmt.Sprintf("renamed to %s", nv.GetName()))
+		}
+	}
+}
+
+func streamingKind(md *desc.MethodDescriptor) string {
+	switch {
+	case md.IsClientStreaming() && md.IsServerStreaming():
+		return "bidi-streaming"
+	case md.IsClientStreaming():
+		return "client-streaming"
+	case md.IsServerStreaming():
+		return "server-streaming"
+	default:
+		return "unary"
+	}
+}
+
+// fieldTypeName returns the type of the given field as it would be written in
+// a proto source file, including its cardinality if repeated.
+func fieldTypeName(fd *desc.FieldDescriptor) string {
+	if fd.IsMap() {
+		return fmt.Sprintf("map<%s, %s>", fieldTypeName(fd.GetMapKeyType()), fieldTypeName(fd.GetMapValueType()))
+	}
+	var t string
+	switch {
+	case fd.GetMessageType() != nil:
+		t = fd.GetMessageType().GetFullyQualifiedName()
+	case fd.GetEnumType() != nil:
+		t = fd.GetEnumType().GetFullyQualifiedName()
+	default:
+		t = strings.ToLower(strings.TrimPrefix(fd.GetType().String(), "TYPE_"))
+	}
+	if fd.IsRepeated() {
+		return "repeated " + t
+	}
+	return t
+}
+
+func unionKeys[T any](a, b map[string]T) []string {
+	keys := make([]string, 0, len(a)+len(b))
+	for k := range a {
+		keys = append(keys, k)
+	}
+	for k := range b {
+		if _, ok := a[k]; !ok {
+			keys = append(keys, k)
+		}
+	}
+	sort.Strings(keys)
+	return keys
+}
+
+func unionNumbers[T any](a, b map[int32]T) []int32 {
+	nums := make([]int32, 0, len(a)+len(b))
+	for k := range a {
+		nums = append(nums, k)
+	}
+	for k := range b {
+		if _, ok := a[k]; !ok {
+			nums = append(nums, k)
+		}
+	}
+	sort.Slice(nums, func(i, j int) bool { return nums[i] < nums[j] })
+	return nums
+}
+
+// printSchemaChanges writes one line for each of the given changes to out.
+func printSchemaChanges(out io.Writer, changes []schemaChange) {
+	for _, c := range changes {
+		fmt.Fprintln(out, c)
+	}
+}
@@ -0,0 +1,116 @@
+package main
+
+import (
+	"bytes"
+	"testing"
+
+	"github.com/jhump/protoreflect/desc/protoparse"
+
+	"github.com/fullstorydev/grpcurl"
+)
+
+const oldSchemaProto = `
+syntax = "proto3";
+package drift;
+enum Color {
+  RED = 0;
+  GREEN = 1;
+  BLUE = 2;
+}
+message Item {
+  string name = 1;
+  Color color = 2;
+}
+message Request {
+  string id = 1;
+  int32 count = 2;
+  repeated Item items = 3;
+  string note = 4;
+}
+service Svc {
+  rpc Get(Request) returns (Item);
+  rpc Watch(Request) returns (stream Item);
+  rpc Old(Request) returns (Item);
+}
+service Gone {
+  rpc Get(Request) returns (Item);
+}
+`
+
+const newSchemaProto = `
+syntax = "proto3";
+package drift;
+enum Color {
+  RED = 0;
+  VERDE = 1;
+  YELLOW = 3;
+}
+message Item {
+  string name = 1;
+  Color color = 2;
+  string label = 5;
+}
+message Request {
+  string id = 1;
+  int64 count = 2;
+  repeated Item items = 3;
+  string comment = 4;
+}
+service Svc {
+  rpc Get(Request) returns (Item);
+  rpc Watch(stream Request) returns (stream Item);
+  rpc New(Request) returns (Request);
+}
+service Added {
+  rpc Get(Request) returns (Item);
+}
+`
+
+func parseSchemaSource(t *testing.T, source string) grpcurl.DescriptorSource {
+	fds, err := (&protoparse.Parser{
+		Accessor: protoparse.FileContentsFromMap(map[string]string{"drift.proto": source}),
+	}).ParseFiles("drift.proto")
+	if err != nil {
+		t.Fatalf("failed to parse proto: %v", err)
+	}
+	ds, err := grpcurl.DescriptorSourceFromFileDescriptors(fds...)
+	if err != nil {
+		t.Fatalf("failed to create descriptor source: %v", err)
+	}
+	return ds
+}
+
+func TestDiffSchemas(t *testing.T) {
+	oldSource := parseSchemaSource(t, oldSchemaProto)
+	newSource := parseSchemaSource(t, newSchemaProto)
+
+	changes, err := diffSchemas(oldSource, oldSource)
+	if err != nil {
+		t.Fatalf("failed to compare schemas: %v", err)
+	}
+	if len(changes) != 0 {
+		t.Errorf("expecting no changes when comparing a schema to itself, got %v", changes)
+	}
+
+	changes, err = diffSchemas(oldSource, newSource)
+	if err != nil {
+		t.Fatalf("failed to compare schemas: %v", err)
+	}
+	var buf bytes.Buffer
+	printSchemaChanges(&buf, changes)
+	expected := `+ service drift.Added
+- service drift.Gone
+~ field drift.Request.count: type int32 -> int64
+~ enum value drift.Color.GREEN: renamed to VERDE
+- enum value drift.Color.BLUE: = 2
++ enum value drift.Color.YELLOW: = 3
++ field drift.Item.label: string = 5
+~ field drift.Request.note: renamed to comment
++ method drift.Svc.New
+- method drift.Svc.Old
+~ method drift.Svc.Watch: server-streaming -> bidi-streaming
+`
+	if buf.String() != expected {
+		t.Errorf("wrong changes:\nexpected:\n%s\ngot:\n%s", expected, buf.String())
+	}
+}
@@ -0,0 +1,228 @@
+package main
+
+import (
+	"encoding/json"
+	"io"
+	"strings"
+
+	"github.com/jhump/protoreflect/desc"
+
+	"github.com/fullstorydev/grpcurl"
+)
+
+// The types below define the JSON document written by -describe-all-json.
+// The document has a single "files" array, sorted by file name. Each file
+// lists the services, messages, enums, and extensions that it defines, in
+// declaration order. Nested messages and enums appear inside the message
+// that declares them. Type references (such as a method's input type or a
+// field's message type) are fully-qualified names, without a leading dot.
+// Optional properties are omitted when empty.
+
+type schemaDoc struct {
+	Files []schemaFile `json:"files"`
+}
+
+type schemaFile struct {
+	Name         string          `json:"name"`
+	Package      string          `json:"package,omitempty"`
+	Syntax       string          `json:"syntax"`
+	Dependencies []string        `json:"dependencies,omitempty"`
+	Services     []schemaService `json:"services,omitempty"`
+	Messages     []schemaMessage `json:"messages,omitempty"`
+	Enums        []schemaEnum    `json:"enums,omitempty"`
+	Extensions   []schemaField   `json:"extensions,omitempty"`
+}
+
+type schemaService struct {
+	Name        string         `json:"name"`
+	FullName    string         `json:"fullName"`
+	Description string         `json:"description,omitempty"`
+	Methods     []schemaMethod `json:"methods"`
+}
+
+type schemaMethod struct {
+	Name            string `json:"name"`
+	FullName        string `json:"fullName"`
+	Description     string `json:"description,omitempty"`
+	InputType       string `json:"inputType"`
+	OutputType      string `json:"outputType"`
+	ClientStreaming bool   `json:"clientStreaming"`
+	ServerStreaming bool   `json:"serverStreaming"`
+}
+
+type schemaMessage struct {
+	Name        string          `json:"name"`
+	FullName    string          `json:"fullName"`
+	Description string          `json:"description,omitempty"`
+	MapEntry    bool            `json:"mapEntry,omitempty"`
+	Fields      []schemaField   `json:"fields"`
+	Oneofs      []string        `json:"oneofs,omitempty"`
+	Messages    []schemaMessage `json:"messages,omitempty"`
+	Enums       []schemaEnum    `json:"enums,omitempty"`
+	Extensions  []schemaField   `json:"extensions,omitempty"`
+}
+
+type schemaField struct {
+	Name        string `json:"name"`
+	Number      int32  `json:"number"`
+	Description string `json:"description,omitempty"`
+	// Label is "optional", "required", or "repeated".
+	Label string `json:"label"`
+	// Type is the field's type as named in proto source, such as "int32",
+	// "string", "message", or "enum".
+	Type string `json:"type"`
+	// TypeName is the fully-qualified name of the message or enum type, for
+	// fields whose Type is "message", "group", or "enum".
+	TypeName string `json:"typeName,omitempty"`
+	JSONName string `json:"jsonName"`
+	Oneof    string `json:"oneof,omitempty"`
+	// Extendee is the fully-qualified name of the extended message, for
+	// extensions.
+	Extendee string `json:"extendee,omitempty"`
+}
+
+type schemaEnum struct {
+	Name        string            `json:"name"`
+	FullName    string            `json:"fullName"`
+	Description string            `json:"description,omitempty"`
+	Values      []schemaEnumValue `json:"values"`
+}
+
+type schemaEnumValue struct {
+	Name        string `json:"name"`
+	Number      int32  `json:"number"`
+	Description string `json:"description,omitempty"`
+}
+
+// writeSchemaJSON writes a JSON document that describes every file in the
+// given descriptor source to out.
+func writeSchemaJSON(out io.Writer, descSource grpcurl.DescriptorSource) error {
+	files, err := grpcurl.GetAllFiles(descSource)
+	if err != nil {
+		return err
+	}
+	doc := schemaDoc{Files: make([]schemaFile, 0, len(files))}
+	for _, fd := range files {
+		f := schemaFile{
+			Name:    fd.GetName(),
+			Package: fd.GetPackage(),
+			Syntax:  "proto2",
+		}
+		if fd.IsProto3() {
+			f.Syntax = "proto3"
+		}
+		for _, dep := range fd.GetDependencies() {
+			f.Dependencies = append(f.Dependencies, dep.GetName())
+		}
+		for _, sd := range fd.GetServices() {
+			svc := schemaService{
+				Name:        sd.GetName(),
+				FullName:    sd.GetFullyQualifiedName(),
+				Description: descriptionOf(sd),
+				Methods:     []schemaMethod{},
+			}
+			for _, mtd := range sd.GetMethods() {
+				svc.Methods = append(svc.Methods, schemaMethod{
+					Name:            mtd.GetName(),
+					FullName:        mtd.GetFullyQualifiedName(),
+					Description:     descriptionOf(mtd),
+					InputType:       mtd.GetInputType().GetFullyQualifiedName(),
+					OutputType:      mtd.GetOutputType().GetFullyQualifiedName(),
+					ClientStreaming: mtd.IsClientStreaming(),
+					ServerStreaming: mtd.IsServerStreaming(),
+				})
+			}
+			f.Services = append(f.Services, svc)
+		}
+		for _, md := range fd.GetMessageTypes() {
+			f.Messages = append(f.Messages, schemaMessageOf(md))
+		}
+		for _, ed := range fd.GetEnumTypes() {
+			f.Enums = append(f.Enums, schemaEnumOf(ed))
+		}
+		for _, ext := range fd.GetExtensions() {
+			f.Extensions = append(f.Extensions, schemaFieldOf(ext))
+		}
+		doc.Files = append(doc.Files, f)
+	}
+	enc := json.NewEncoder(out)
+	enc.SetIndent("", "  ")
+	return enc.Encode(doc)
+}
+
+func schemaMessageOf(md *desc.MessageDescriptor) schemaMessage {
+	msg := schemaMessage{
+		Name:        md.GetName(),
+		FullName:    md.GetFullyQualifiedName(),
+		Description: descriptionOf(md),
+		MapEntry:    md.IsMapEntry(),
+		Fields:      []schemaField{},
+	}
+	for _, fld := range md.GetFields() {
+		msg.Fields = append(msg.Fields, schemaFieldOf(fld))
+	}
+	for _, ood := range md.GetOneOfs() {
+		msg.Oneofs = append(msg.Oneofs, ood.GetName())
+	}
+	for _, nested := range md.GetNestedMessageTypes() {
+		msg.Messages = append(msg.Messages, schemaMessageOf(nested))
+	}
+	for _, ed := range md.GetNestedEnumTypes() {
+		msg.Enums = append(msg.Enums, schemaEnumOf(ed))
+	}
+	for _, ext := range md.GetNestedExtensions() {
+		msg.Extensions = append(msg.Extensions, schemaFieldOf(ext))
+	}
+	return msg
+}
+
+func schemaFieldOf(fld *desc.FieldDescriptor) schemaField {
+	f := schemaField{
+		Name:        fld.GetName(),
+		Number:      fld.GetNumber(),
+		Description: descriptionOf(fld),
+		Label:       strings.ToLower(strings.TrimPrefix(fld.GetLabel().String(), "LABEL_")),
+		Type:        strings.ToLower(strings.TrimPrefix(fld.GetType().String(), "TYPE_")),
+		JSONName:    fld.GetJSONName(),
+	}
+	if md := fld.GetMessageType(); md != nil {
+		f.TypeName = md.GetFullyQualifiedName()
+	} else if ed := fld.GetEnumType(); ed != nil {
+		f.TypeName = ed.GetFullyQualifiedName()
+	}
+	if ood := fld.GetOneOf(); ood != nil {
+		f.Oneof = ood.GetName()
+	}
+	if fld.IsExtension() {
+		f.Extendee = fld.GetOwner().GetFullyQualifiedName()
+	}
+	return f
+}
+
+func schemaEnumOf(ed *desc.EnumDescriptor) schemaEnum {
+	enum := schemaEnum{
+		Name:        ed.GetName(),
+		FullName:    ed.GetFullyQualifiedName(),
+		Description: descriptionOf(ed),
+		Values:      []schemaEnumValue{},
+	}
+	for _, vd := range ed.GetValues() {
+		enum.Values = append(enum.Values, schemaEnumValue{
+			Name:        vd.GetName(),
+			Number:      vd.GetNumber(),
+			Description: descriptionOf(vd),
+		})
+	}
+	return enum
+}
+
+// descriptionOf returns the leading comment for the given element, if the
+// descriptor includes source code info. The space that usually follows the
+// comment marker is removed from each line.
+func descriptionOf(d desc.Descriptor) string {
+	lines := strings.Split(strings.TrimSpace(d.GetSourceInfo().GetLeadingComments()), "\n")
+	for i, line := range lines {
+		lines[i] = strings.TrimPrefix(line, " ")
+	}
+	return strings.Join(lines, "\n")
+}
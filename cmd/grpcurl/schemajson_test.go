@@ -0,0 +1,166 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"testing"
+
+	"github.com/jhump/protoreflect/desc"
+	"github.com/jhump/protoreflect/desc/protoparse"
+
+	"github.com/fullstorydev/grpcurl"
+)
+
+const schemaProto = `
+syntax = "proto3";
+package schema;
+
+// Greeter says hello.
+service Greeter {
+  // Hello greets
+  //   one person.
+  rpc Hello (Req) returns (stream Resp);
+}
+
+message Req {
+  string name = 1;
+  repeated Kind kinds = 2;
+  oneof choice {
+    Resp resp = 3;
+    int64 num = 4;
+  }
+  map<string, int32> counts = 5;
+}
+
+message Resp {
+  enum Inner {
+    INNER_UNSET = 0;
+  }
+  Inner inner = 1;
+}
+
+enum Kind {
+  // The default.
+  KIND_UNSET = 0;
+  KIND_A = 1;
+}
+`
+
+func parseSchemaProto(t *testing.T) *desc.FileDescriptor {
+	t.Helper()
+	fds, err := (&protoparse.Parser{
+		Accessor:              protoparse.FileContentsFromMap(map[string]string{"schema.proto": schemaProto}),
+		IncludeSourceCodeInfo: true,
+	}).ParseFiles("schema.proto")
+	if err != nil {
+		t.Fatalf("failed to parse proto: %v", err)
+	}
+	return fds[0]
+}
+
+func TestSchemaFieldOf(t *testing.T) {
+	fd := parseSchemaProto(t)
+	req := fd.FindMessage("schema.Req")
+	testCases := []struct {
+		field    string
+		expected schemaField
+	}{
+		{
+			field:    "name",
+			expected: schemaField{Name: "name", Number: 1, Label: "optional", Type: "string", JSONName: "name"},
+		},
+		{
+			field:    "kinds",
+			expected: schemaField{Name: "kinds", Number: 2, Label: "repeated", Type: "enum", TypeName: "schema.Kind", JSONName: "kinds"},
+		},
+		{
+			field:    "resp",
+			expected: schemaField{Name: "resp", Number: 3, Label: "optional", Type: "message", TypeName: "schema.Resp", JSONName: "resp", Oneof: "choice"},
+		},
+		{
+			field:    "counts",
+			expected: schemaField{Name: "counts", Number: 5, Label: "repeated", Type: "message", TypeName: "schema.Req.CountsEntry", JSONName: "counts"},
+		},
+	}
+	for _, tc := range testCases {
+		got := schemaFieldOf(req.FindFieldByName(tc.field))
+		if got != tc.expected {
+			t.Errorf("field %s: expecting %+v, got %+v", tc.field, tc.expected, got)
+		}
+	}
+}
+
+func TestDescriptionOf(t *testing.T) {
+	fd := parseSchemaProto(t)
+	testCases := []struct {
+		symbol   string
+		expected string
+	}{
+		{symbol: "schema.Greeter", expected: "Greeter says hello."},
+		{symbol: "schema.Greeter.Hello", expected: "Hello greets\n  one person."},
+		{symbol: "schema.KIND_UNSET", expected: "The default."},
+		{symbol: "schema.Req", expected: ""},
+	}
+	for _, tc := range testCases {
+		d := fd.FindSymbol(tc.symbol)
+		if d == nil {
+			t.Fatalf("failed to find %s", tc.symbol)
+		}
+		if got := descriptionOf(d); got != tc.expected {
+			t.Errorf("%s: expecting %q, got %q", tc.symbol, tc.expected, got)
+		}
+	}
+}
+
+func TestWriteSchemaJSON(t *testing.T) {
+	source, err := grpcurl.DescriptorSourceFromFileDescriptors(parseSchemaProto(t))
+	if err != nil {
+		t.Fatalf("failed to create descriptor source: %v", err)
+	}
+	var buf bytes.Buffer
+	if err := writeSchemaJSON(&buf, source); err != nil {
+		t.Fatalf("failed to write schema: %v", err)
+	}
+	var doc schemaDoc
+	if err := json.Unmarshal(buf.Bytes(), &doc); err != nil {
+		t.Fatalf("schema is not valid JSON: %v", err)
+	}
+	if len(doc.Files) != 1 {
+		t.Fatalf("expecting one file, got %d", len(doc.Files))
+	}
+	f := doc.Files[0]
+	if f.Name != "schema.proto" || f.Package != "schema" || f.Syntax != "proto3" {
+		t.Errorf("wrong file: %+v", f)
+	}
+	if len(f.Services) != 1 || len(f.Services[0].Methods) != 1 {
+		t.Fatalf("expecting one service with one method, got %+v", f.Services)
+	}
+	mtd := f.Services[0].Methods[0]
+	expectedMtd := schemaMethod{
+		Name:            "Hello",
+		FullName:        "schema.Greeter.Hello",
+		Description:     "Hello greets\n  one person.",
+		InputType:       "schema.Req",
+		OutputType:      "schema.Resp",
+		ServerStreaming: true,
+	}
+	if mtd != expectedMtd {
+		t.Errorf("wrong method: expecting %+v, got %+v", expectedMtd, mtd)
+	}
+	if len(f.Messages) != 2 || f.Messages[0].Name != "Req" || f.Messages[1].Name != "Resp" {
+		t.Fatalf("wrong messages: %+v", f.Messages)
+	}
+	req := f.Messages[0]
+	if len(req.Oneofs) != 1 || req.Oneofs[0] != "choice" {
+		t.Errorf("wrong oneofs: %v", req.Oneofs)
+	}
+	if len(req.Messages) != 1 || !req.Messages[0].MapEntry {
+		t.Errorf("expecting nested map entry message, got %+v", req.Messages)
+	}
+	if resp := f.Messages[1]; len(resp.Enums) != 1 || resp.Enums[0].FullName != "schema.Resp.Inner" {
+		t.Errorf("expecting nested enum, got %+v", resp.Enums)
+	}
+	if len(f.Enums) != 1 || len(f.Enums[0].Values) != 2 || f.Enums[0].Values[1].Name != "KIND_A" {
+		t.Errorf("wrong enums: %+v", f.Enums)
+	}
+}
@@ -0,0 +1,45 @@
+package main
+
+import (
+	"fmt"
+	"io"
+	"text/tabwriter"
+
+	"github.com/golang/protobuf/proto" //lint:ignore SA1019 we have to import this because it appears in exported API
+	"github.com/jhump/protoreflect/desc"
+
+	"github.com/fullstorydev/grpcurl"
+)
+
+// printMethodSizes writes, for each of the given methods, the encoded size of
+// a template request and response message, as made by grpcurl.MakeTemplate.
+// Templates include one element of each repeated field and each map, and set
+// each nested message, but scalar fields have default values, which are not
+// encoded. So the sizes are a rough lower bound, reflecting the shape of the
+// messages more than their real footprint.
+func printMethodSizes(out io.Writer, descSource grpcurl.DescriptorSource, methods []string) error {
+	tw := tabwriter.NewWriter(out, 0, 8, 2, ' ', 0)
+	fmt.Fprintln(tw, "METHOD\tREQUEST\tRESPONSE")
+	for _, m := range methods {
+		d, err := descSource.FindSymbol(m)
+		if err != nil {
+			return err
+		}
+		mtd, ok := d.(*desc.MethodDescriptor)
+		if !ok {
+			return fmt.Errorf("%s is not a method", m)
+		}
+		fmt.Fprintf(tw, "%s\t%s\t%s\n", m, templateSize(mtd.GetInputType()), templateSize(mtd.GetOutputType()))
+	}
+	return tw.Flush()
+}
+
+// templateSize returns a description of the encoded size of a template for
+// the given message type.
+func templateSize(md *desc.MessageDescriptor) string {
+	b, err := proto.Marshal(grpcurl.MakeTemplate(md))
+	if err != nil {
+		return fmt.Sprintf("? (%v)", err)
+	}
+	return fmt.Sprintf("%d bytes", len(b))
+}
@@ -0,0 +1,50 @@
+package main
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+)
+
+func TestPrintMethodSizes(t *testing.T) {
+	source := parseSource(t, `
+		syntax = "proto3";
+		package sz;
+		import "google/protobuf/empty.proto";
+		message Inner { int32 x = 1; }
+		message Req {
+			string name = 1;
+			repeated string tags = 2;
+			Inner inner = 3;
+			map<string, Inner> things = 4;
+		}
+		service Svc {
+			rpc Get (Req) returns (google.protobuf.Empty);
+			rpc List (google.protobuf.Empty) returns (stream Req);
+		}`)
+
+	var out bytes.Buffer
+	if err := printMethodSizes(&out, source, []string{"sz.Svc.Get", "sz.Svc.List"}); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	// scalar fields are not encoded, but one element is for repeated fields
+	// and maps (2 bytes and 6 bytes), and nested messages are set (2 bytes)
+	expected := `
+METHOD       REQUEST   RESPONSE
+sz.Svc.Get   10 bytes  0 bytes
+sz.Svc.List  0 bytes   10 bytes
+`
+	if out.String() != strings.TrimPrefix(expected, "\n") {
+		t.Errorf("wrong output:\n%s", out.String())
+	}
+
+	for symbol, errMsg := range map[string]string{
+		"sz.Svc.Nope": "Symbol not found: sz.Svc.Nope",
+		"sz.Req":      "sz.Req is not a method",
+	} {
+		err := printMethodSizes(&out, source, []string{symbol})
+		if err == nil || !strings.Contains(err.Error(), errMsg) {
+			t.Errorf("%s: expecting error containing %q, got %v", symbol, errMsg, err)
+		}
+	}
+}
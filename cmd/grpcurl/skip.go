@@ -0,0 +1,45 @@
+package main
+
+import (
+	"fmt"
+	"io"
+
+	"github.com/golang/protobuf/proto" //lint:ignore SA1019 we have to import this because it appears in exported API
+
+	"github.com/fullstorydev/grpcurl"
+)
+
+// skippingRequestParser wraps a request parser so that a message that cannot
+// be parsed is reported and skipped instead of failing the RPC. This is only
+// possible if the underlying parser was able to find where the bad message
+// ends, which it indicates by counting it in NumRequests. Otherwise, such as
+// for JSON that is not well-formed, the error is returned.
+type skippingRequestParser struct {
+	grpcurl.RequestParser
+	errOut  io.Writer
+	skipped int
+}
+
+func (p *skippingRequestParser) Next(m proto.Message) error {
+	for {
+		before := p.RequestParser.NumRequests()
+		err := p.RequestParser.Next(m)
+		if err == nil || err == io.EOF || p.RequestParser.NumRequests() == before {
+			return err
+		}
+		p.skipped++
+		fmt.Fprintf(p.errOut, "Skipping request message %d: %v\n", p.RequestParser.NumRequests(), err)
+		m.Reset()
+	}
+}
+
+// NumRequests returns the number of messages parsed, not including the ones
+// that were skipped.
+func (p *skippingRequestParser) NumRequests() int {
+	return p.RequestParser.NumRequests() - p.skipped
+}
+
+// Skipped returns the number of messages that were skipped.
+func (p *skippingRequestParser) Skipped() int {
+	return p.skipped
+}
@@ -0,0 +1,79 @@
+package main
+
+import (
+	"bytes"
+	"io"
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/fullstorydev/grpcurl"
+	grpcurl_testing "github.com/fullstorydev/grpcurl/internal/testing"
+)
+
+func TestSkippingRequestParser(t *testing.T) {
+	testCases := []struct {
+		name     string
+		input    string
+		expected []int32
+		skipped  []string
+		errMsg   string
+	}{
+		{
+			name:     "all valid",
+			input:    `{"responseSize": 1} {"responseSize": 2}`,
+			expected: []int32{1, 2},
+		},
+		{
+			name:     "bad messages skipped",
+			input:    `{"nope": 1} {"responseSize": 1} {"responseSize": "x"} {"nope": 3} {"responseSize": 2} {"nope": 4}`,
+			expected: []int32{1, 2},
+			skipped:  []string{"Skipping request message 1: ", "Skipping request message 3: ", "Skipping request message 4: ", "Skipping request message 6: "},
+		},
+		{
+			// the parser cannot find the end of malformed JSON
+			name:     "malformed",
+			input:    `{"responseSize": 1} {"responseSize": `,
+			expected: []int32{1},
+			errMsg:   "unexpected EOF",
+		},
+	}
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			var errOut bytes.Buffer
+			p := &skippingRequestParser{RequestParser: grpcurl.NewJSONRequestParser(strings.NewReader(tc.input), nil), errOut: &errOut}
+			var values []int32
+			var err error
+			for {
+				var msg grpcurl_testing.SimpleRequest
+				if err = p.Next(&msg); err != nil {
+					break
+				}
+				values = append(values, msg.ResponseSize)
+			}
+			if tc.errMsg == "" && err != io.EOF {
+				t.Errorf("unexpected error: %v", err)
+			} else if tc.errMsg != "" && (err == nil || !strings.Contains(err.Error(), tc.errMsg)) {
+				t.Errorf("expecting error containing %q, got %v", tc.errMsg, err)
+			}
+			if !reflect.DeepEqual(values, tc.expected) {
+				t.Errorf("expecting values %v, got %v", tc.expected, values)
+			}
+			if p.NumRequests() != len(tc.expected) || p.Skipped() != len(tc.skipped) {
+				t.Errorf("expecting %d requests and %d skipped, got %d and %d", len(tc.expected), len(tc.skipped), p.NumRequests(), p.Skipped())
+			}
+			var lines []string
+			if errOut.Len() > 0 {
+				lines = strings.Split(strings.TrimSuffix(errOut.String(), "\n"), "\n")
+			}
+			if len(lines) != len(tc.skipped) {
+				t.Fatalf("expecting %d skipped messages to be reported, got %q", len(tc.skipped), errOut.String())
+			}
+			for i := range lines {
+				if !strings.HasPrefix(lines[i], tc.skipped[i]) {
+					t.Errorf("expecting report to start with %q, got %q", tc.skipped[i], lines[i])
+				}
+			}
+		})
+	}
+}
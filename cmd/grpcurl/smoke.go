@@ -0,0 +1,130 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"strconv"
+	"strings"
+	"text/tabwriter"
+
+	"github.com/golang/protobuf/proto" //lint:ignore SA1019 we have to import this because it appears in exported API
+	"github.com/jhump/protoreflect/desc"
+	"github.com/jhump/protoreflect/dynamic/grpcdynamic"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/status"
+
+	"github.com/fullstorydev/grpcurl"
+)
+
+// runSmoke invokes every unary method of the named service with an empty
+// request and writes a table with the outcome of each call to out. Streaming
+// methods are skipped. It returns true if every call that was made completed
+// with OK or with one of the given ignored codes.
+func runSmoke(ctx context.Context, out io.Writer, descSource grpcurl.DescriptorSource, ch grpcdynamic.Channel, svc string, headers []string, ignored map[codes.Code]bool) (bool, error) {
+	methods, err := grpcurl.ListMethods(descSource, svc)
+	if err != nil {
+		return false, err
+	}
+
+	allOK := true
+	w := tabwriter.NewWriter(out, 0, 8, 2, ' ', 0)
+	fmt.Fprintln(w, "METHOD\tRESULT\tSTATUS")
+	for _, m := range methods {
+		d, err := descSource.FindSymbol(m)
+		if err != nil {
+			return false, err
+		}
+		mtd, ok := d.(*desc.MethodDescriptor)
+		if !ok {
+			return false, fmt.Errorf("%s is not a method: %T", m, d)
+		}
+		if mtd.IsClientStreaming() || mtd.IsServerStreaming() {
+			fmt.Fprintf(w, "%s\tSKIP\t(streaming)\n", m)
+			continue
+		}
+
+		var h smokeHandler
+		err = grpcurl.InvokeRPC(ctx, descSource, ch, m, headers, &h, func(proto.Message) error {
+			return io.EOF
+		})
+		if err != nil {
+			if stat, ok := status.FromError(err); ok {
+				h.stat = stat
+			} else {
+				allOK = false
+				fmt.Fprintf(w, "%s\tFAIL\t%v\n", m, err)
+				continue
+			}
+		}
+		result := "PASS"
+		if code := h.stat.Code(); code != codes.OK && !ignored[code] {
+			result = "FAIL"
+			allOK = false
+		}
+		fmt.Fprintf(w, "%s\t%s\t%s\n", m, result, h.stat.Code())
+	}
+	if err := w.Flush(); err != nil {
+		return false, err
+	}
+	return allOK, nil
+}
+
+// smokeHandler is an InvocationEventHandler that discards everything but the
+// final status of the RPC.
+type smokeHandler struct {
+	stat *status.Status
+}
+
+func (h *smokeHandler) OnResolveMethod(*desc.MethodDescriptor) {}
+
+func (h *smokeHandler) OnSendHeaders(metadata.MD) {}
+
+func (h *smokeHandler) OnReceiveHeaders(metadata.MD) {}
+
+func (h *smokeHandler) OnReceiveResponse(proto.Message) {}
+
+func (h *smokeHandler) OnReceiveTrailers(stat *status.Status, _ metadata.MD) {
+	h.stat = stat
+}
+
+// parseStatusCodes parses a comma-separated list of gRPC status codes. Each
+// code may be given as a number or by name, either in the form used by
+// codes.Code.String (e.g. "NotFound") or the canonical upper-case form (e.g.
+// "NOT_FOUND").
+func parseStatusCodes(s string) (map[codes.Code]bool, error) {
+	result := map[codes.Code]bool{}
+	for _, part := range strings.Split(s, ",") {
+		part = strings.TrimSpace(part)
+		if part == "" {
+			continue
+		}
+		code, err := parseStatusCode(part)
+		if err != nil {
+			return nil, err
+		}
+		result[code] = true
+	}
+	return result, nil
+}
+
+func parseStatusCode(s string) (codes.Code, error) {
+	if n, err := strconv.ParseUint(s, 10, 32); err == nil {
+		if n > uint64(codes.Unauthenticated) {
+			return 0, fmt.Errorf("status code %d is out of range: must be from 0 to %d", n, codes.Unauthenticated)
+		}
+		return codes.Code(n), nil
+	}
+	canonical := strings.ReplaceAll(strings.ToLower(s), "_", "")
+	if canonical == "cancelled" {
+		// canonical name uses British spelling, but Go constant does not
+		canonical = "canceled"
+	}
+	for c := codes.OK; c <= codes.Unauthenticated; c++ {
+		if strings.ToLower(c.String()) == canonical {
+			return c, nil
+		}
+	}
+	return 0, fmt.Errorf("unrecognized status code %q", s)
+}
@@ -0,0 +1,95 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"reflect"
+	"strconv"
+	"strings"
+	"testing"
+
+	"google.golang.org/grpc/codes"
+
+	grpcurl_testing "github.com/fullstorydev/grpcurl/internal/testing"
+)
+
+func TestParseStatusCodes(t *testing.T) {
+	actual, err := parseStatusCodes("NotFound, PERMISSION_DENIED,12,CANCELLED,")
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	expected := map[codes.Code]bool{
+		codes.NotFound:         true,
+		codes.PermissionDenied: true,
+		codes.Unimplemented:    true,
+		codes.Canceled:         true,
+	}
+	if !reflect.DeepEqual(expected, actual) {
+		t.Errorf("wrong codes parsed: wanted %v, got %v", expected, actual)
+	}
+
+	if _, err := parseStatusCodes("Bogus"); err == nil {
+		t.Error("expecting error for unrecognized code but got none")
+	}
+	if _, err := parseStatusCodes("16"); err != nil {
+		t.Errorf("unexpected error for highest code: %v", err)
+	}
+	if _, err := parseStatusCodes("17"); err == nil {
+		t.Error("expecting error for out-of-range code but got none")
+	}
+}
+
+func TestRunSmoke(t *testing.T) {
+	cc, source := dialTestServer(t)
+	failNotFound := []string{grpcurl_testing.MetadataFailEarly + ": " + strconv.Itoa(int(codes.NotFound))}
+	testCases := []struct {
+		name     string
+		headers  []string
+		ignored  map[codes.Code]bool
+		ok       bool
+		expected []string
+	}{
+		{
+			name: "pass",
+			ok:   true,
+			expected: []string{
+				"testing.TestService.EmptyCall PASS OK",
+				"testing.TestService.StreamingOutputCall SKIP (streaming)",
+			},
+		},
+		{
+			name:     "fail",
+			headers:  failNotFound,
+			expected: []string{"testing.TestService.EmptyCall FAIL NotFound"},
+		},
+		{
+			name:     "ignored code",
+			headers:  failNotFound,
+			ignored:  map[codes.Code]bool{codes.NotFound: true},
+			ok:       true,
+			expected: []string{"testing.TestService.EmptyCall PASS NotFound"},
+		},
+	}
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			var out bytes.Buffer
+			ok, err := runSmoke(context.Background(), &out, source, cc, "testing.TestService", tc.headers, tc.ignored)
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+			if ok != tc.ok {
+				t.Errorf("expecting result %v, got %v", tc.ok, ok)
+			}
+			// compare rows without the table's column padding
+			rows := map[string]bool{}
+			for _, line := range strings.Split(out.String(), "\n") {
+				rows[strings.Join(strings.Fields(line), " ")] = true
+			}
+			for _, row := range tc.expected {
+				if !rows[row] {
+					t.Errorf("expecting row %q in output:\n%s", row, out.String())
+				}
+			}
+		})
+	}
+}
@@ -0,0 +1,21 @@
+package main
+
+import (
+	"io"
+
+	"github.com/fullstorydev/grpcurl"
+)
+
+// writeSnapshot writes a protoset to w with the files for all services in the
+// given descriptor source, along with all of their transitive dependencies,
+// so that the result is self-contained. It returns the number of services.
+func writeSnapshot(w io.Writer, descSource grpcurl.DescriptorSource, opts grpcurl.ProtosetOptions) (int, error) {
+	svcs, err := grpcurl.ListServices(descSource)
+	if err != nil {
+		return 0, err
+	}
+	if err := grpcurl.WriteProtosetWithOptions(w, descSource, opts, svcs...); err != nil {
+		return 0, err
+	}
+	return len(svcs), nil
+}
@@ -0,0 +1,73 @@
+package main
+
+import (
+	"bytes"
+	"reflect"
+	"sort"
+	"testing"
+
+	"github.com/golang/protobuf/proto" //lint:ignore SA1019 we have to import this because it appears in exported API
+	"github.com/jhump/protoreflect/desc/protoparse"
+	"google.golang.org/protobuf/types/descriptorpb"
+
+	"github.com/fullstorydev/grpcurl"
+)
+
+func TestWriteSnapshot(t *testing.T) {
+	fds, err := (&protoparse.Parser{
+		Accessor: protoparse.FileContentsFromMap(map[string]string{
+			"svc.proto": `
+				syntax = "proto3";
+				package snap;
+				import "msgs.proto";
+				service Svc { rpc Do (Req) returns (Req); }`,
+			"msgs.proto": `
+				syntax = "proto3";
+				package snap;
+				import "google/protobuf/empty.proto";
+				message Req { google.protobuf.Empty e = 1; }`,
+		}),
+	}).ParseFiles("svc.proto")
+	if err != nil {
+		t.Fatalf("failed to parse protos: %v", err)
+	}
+	source, err := grpcurl.DescriptorSourceFromFileDescriptors(fds...)
+	if err != nil {
+		t.Fatalf("failed to create descriptor source: %v", err)
+	}
+
+	var buf bytes.Buffer
+	numSvcs, err := writeSnapshot(&buf, source, grpcurl.ProtosetOptions{SortFiles: true})
+	if err != nil {
+		t.Fatalf("failed to write snapshot: %v", err)
+	}
+	if numSvcs != 1 {
+		t.Errorf("expecting 1 service, got %d", numSvcs)
+	}
+
+	// the snapshot includes transitive dependencies, so it can be used alone
+	var fs descriptorpb.FileDescriptorSet
+	if err := proto.Unmarshal(buf.Bytes(), &fs); err != nil {
+		t.Fatalf("failed to parse snapshot: %v", err)
+	}
+	var names []string
+	for _, fd := range fs.File {
+		names = append(names, fd.GetName())
+	}
+	expected := []string{"google/protobuf/empty.proto", "msgs.proto", "svc.proto"}
+	if !reflect.DeepEqual(names, expected) {
+		t.Errorf("wrong files in snapshot: expecting %v, got %v", expected, names)
+	}
+	snapSource, err := grpcurl.DescriptorSourceFromFileDescriptorSet(&fs)
+	if err != nil {
+		t.Fatalf("snapshot is not self-contained: %v", err)
+	}
+	svcs, err := snapSource.ListServices()
+	if err != nil {
+		t.Fatalf("failed to list services: %v", err)
+	}
+	sort.Strings(svcs)
+	if !reflect.DeepEqual(svcs, []string{"snap.Svc"}) {
+		t.Errorf("wrong services in snapshot: %v", svcs)
+	}
+}
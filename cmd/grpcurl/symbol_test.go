@@ -0,0 +1,55 @@
+package main
+
+import (
+	"testing"
+
+	"github.com/fullstorydev/grpcurl"
+)
+
+func TestNormalizeMethodSymbol(t *testing.T) {
+	testCases := []struct {
+		symbol   string
+		expected string
+		errMsg   string
+	}{
+		{symbol: "testing.TestService/UnaryCall", expected: "testing.TestService/UnaryCall"},
+		{symbol: "testing.TestService.UnaryCall", expected: "testing.TestService.UnaryCall"},
+		{symbol: "/testing.TestService/UnaryCall", expected: "testing.TestService/UnaryCall"},
+		{symbol: "/", errMsg: "a path must be in '/package.Service/Method' form"},
+		{symbol: "/testing.TestService", errMsg: "a path must be in '/package.Service/Method' form"},
+		{symbol: "/testing.TestService/", errMsg: "a path must be in '/package.Service/Method' form"},
+		{symbol: "//UnaryCall", errMsg: "a path must be in '/package.Service/Method' form"},
+		{symbol: "/testing.TestService/UnaryCall/extra", errMsg: "a path must be in '/package.Service/Method' form"},
+	}
+	for _, tc := range testCases {
+		got, err := normalizeMethodSymbol(tc.symbol)
+		if tc.errMsg != "" {
+			if err == nil || err.Error() != tc.errMsg {
+				t.Errorf("%q: expecting error %q, got %v", tc.symbol, tc.errMsg, err)
+			}
+			continue
+		}
+		if err != nil {
+			t.Errorf("%q: unexpected error: %v", tc.symbol, err)
+		} else if got != tc.expected {
+			t.Errorf("%q: expecting %q, got %q", tc.symbol, tc.expected, got)
+		}
+	}
+
+	// the normalized path resolves to the method
+	source, err := grpcurl.DescriptorSourceFromProtoSets("../../internal/testing/test.protoset")
+	if err != nil {
+		t.Fatalf("failed to load protoset: %v", err)
+	}
+	symbol, err := normalizeMethodSymbol("/testing.TestService/UnaryCall")
+	if err != nil {
+		t.Fatalf("failed to normalize method: %v", err)
+	}
+	mtd := findMethod(source, symbol)
+	if mtd == nil {
+		t.Fatalf("failed to resolve %q", symbol)
+	}
+	if mtd.GetFullyQualifiedName() != "testing.TestService.UnaryCall" {
+		t.Errorf("resolved wrong method: %s", mtd.GetFullyQualifiedName())
+	}
+}
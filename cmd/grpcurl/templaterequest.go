@@ -0,0 +1,43 @@
+package main
+
+import (
+	"io"
+
+	"github.com/golang/protobuf/proto" //lint:ignore SA1019 we have to import this because it appears in exported API
+	"github.com/jhump/protoreflect/desc"
+
+	"github.com/fullstorydev/grpcurl"
+)
+
+// templateRequestParser is a grpcurl.RequestParser that, instead of parsing
+// input, supplies a single request message built by grpcurl.MakeTemplate,
+// like the template shown by 'describe -msg-template'. Repeated and map
+// fields have one element, so every field is exercised.
+type templateRequestParser struct {
+	requestCount int
+}
+
+func (p *templateRequestParser) Next(m proto.Message) error {
+	if p.requestCount > 0 {
+		return io.EOF
+	}
+	md, err := desc.LoadMessageDescriptorForMessage(m)
+	if err != nil {
+		return err
+	}
+	// round-trip through the binary format, so that the template is copied
+	// into the given message regardless of its concrete type
+	b, err := proto.Marshal(grpcurl.MakeTemplate(md))
+	if err != nil {
+		return err
+	}
+	if err := proto.Unmarshal(b, m); err != nil {
+		return err
+	}
+	p.requestCount++
+	return nil
+}
+
+func (p *templateRequestParser) NumRequests() int {
+	return p.requestCount
+}
@@ -0,0 +1,74 @@
+package main
+
+import (
+	"context"
+	"io"
+	"net"
+	"strings"
+	"testing"
+
+	"github.com/golang/protobuf/proto" //lint:ignore SA1019 we have to import this because it appears in exported API
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	insecureCreds "google.golang.org/grpc/credentials/insecure"
+
+	"github.com/fullstorydev/grpcurl"
+	grpcurl_testing "github.com/fullstorydev/grpcurl/internal/testing"
+)
+
+func TestTemplateRequestParser(t *testing.T) {
+	var req grpcurl_testing.SimpleRequest
+	rf := &templateRequestParser{}
+	if err := rf.Next(&req); err != nil {
+		t.Fatalf("failed to get template request: %v", err)
+	}
+	if err := rf.Next(&req); err != io.EOF {
+		t.Fatalf("expecting a single request, got %v", err)
+	}
+	if req.GetPayload() == nil || req.GetResponseStatus() == nil {
+		t.Errorf("template request should have message fields set: %v", &req)
+	}
+}
+
+func TestInvokeWithTemplateRequest(t *testing.T) {
+	source, err := grpcurl.DescriptorSourceFromProtoSets("../../internal/testing/test.protoset")
+	if err != nil {
+		t.Fatalf("failed to create descriptor source: %v", err)
+	}
+	svr := grpc.NewServer()
+	grpcurl_testing.RegisterTestServiceServer(svr, grpcurl_testing.TestServer{})
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("failed to listen: %v", err)
+	}
+	go svr.Serve(l)
+	defer svr.Stop()
+	cc, err := grpc.Dial(l.Addr().String(), grpc.WithTransportCredentials(insecureCreds.NewCredentials()))
+	if err != nil {
+		t.Fatalf("failed to dial: %v", err)
+	}
+	defer cc.Close()
+
+	var responses []string
+	formatter := grpcurl.NewJSONFormatter(false, nil)
+	h := &grpcurl.DefaultEventHandler{
+		Out: io.Discard,
+		Formatter: func(m proto.Message) (string, error) {
+			str, err := formatter(m)
+			responses = append(responses, str)
+			return str, err
+		},
+	}
+	rf := &templateRequestParser{}
+	err = grpcurl.InvokeRPC(context.Background(), source, cc, "testing.TestService/UnaryCall", nil, h, rf.Next)
+	if err != nil {
+		t.Fatalf("failed to invoke: %v", err)
+	}
+	if h.Status.Code() != codes.OK || rf.NumRequests() != 1 || len(responses) != 1 {
+		t.Fatalf("expecting one request and response and OK status, got %d, %d, %v", rf.NumRequests(), len(responses), h.Status)
+	}
+	// the server echoes the request's payload, which the template populated
+	if !strings.Contains(responses[0], `"payload"`) {
+		t.Errorf("expecting response to echo the template payload, got %s", responses[0])
+	}
+}
@@ -0,0 +1,73 @@
+package main
+
+import (
+	"context"
+	"time"
+
+	"google.golang.org/grpc/keepalive"
+)
+
+// defaultConnectTimeout is used when -connect-timeout is not specified.
+const defaultConnectTimeout = 10 * time.Second
+
+// connectContext returns a context for establishing a connection, which
+// expires after the given number of seconds or defaultConnectTimeout if zero.
+// It is deliberately not derived from the context for the operation, so that
+// -max-time does not limit how long connecting can take.
+func connectContext(connectTimeout float64) (context.Context, context.CancelFunc) {
+	timeout := defaultConnectTimeout
+	if connectTimeout > 0 {
+		timeout = time.Duration(connectTimeout * float64(time.Second))
+	}
+	return context.WithTimeout(context.Background(), timeout)
+}
+
+// pullContext returns a context for pulling protosets from OCI registries,
+// which happens before connecting to the server. It expires after the
+// -connect-timeout (or defaultConnectTimeout) or the -max-time, whichever
+// is sooner, so that an unresponsive registry cannot stall the command.
+func pullContext(connectTimeout, maxTime float64) (context.Context, context.CancelFunc) {
+	ctx, cancelConnect := connectContext(connectTimeout)
+	ctx, cancelMaxTime := withMaxTime(ctx, maxTime)
+	return ctx, func() {
+		cancelMaxTime()
+		cancelConnect()
+	}
+}
+
+// withMaxTime returns a context derived from ctx that expires after the given
+// number of seconds. If maxTime is zero, the returned context has no deadline
+// of its own.
+func withMaxTime(ctx context.Context, maxTime float64) (context.Context, context.CancelFunc) {
+	if maxTime <= 0 {
+		return context.WithCancel(ctx)
+	}
+	return context.WithTimeout(ctx, time.Duration(maxTime*float64(time.Second)))
+}
+
+// withReflectTimeout returns a context for server reflection requests, derived
+// from ctx, that expires after the given number of seconds. Since it is not
+// used for invoking RPCs, time spent on reflection does not count against the
+// RPC. If reflectTimeout is zero, the returned context has no deadline of its
+// own.
+func withReflectTimeout(ctx context.Context, reflectTimeout float64) (context.Context, context.CancelFunc) {
+	if reflectTimeout <= 0 {
+		return context.WithCancel(ctx)
+	}
+	return context.WithTimeout(ctx, time.Duration(reflectTimeout*float64(time.Second)))
+}
+
+// keepaliveParams returns the keepalive parameters for the given durations,
+// in seconds. The keepalive time is the interval after which an idle
+// connection is probed, and the timeout is how long to wait for the probe to
+// be acknowledged. If timeout is zero, it is the same as the time.
+func keepaliveParams(keepaliveTime, timeout float64, permitWithoutStream bool) keepalive.ClientParameters {
+	if timeout <= 0 {
+		timeout = keepaliveTime
+	}
+	return keepalive.ClientParameters{
+		Time:                time.Duration(keepaliveTime * float64(time.Second)),
+		Timeout:             time.Duration(timeout * float64(time.Second)),
+		PermitWithoutStream: permitWithoutStream,
+	}
+}
@@ -0,0 +1,122 @@
+package main
+
+import (
+	"context"
+	"net"
+	"testing"
+	"time"
+
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/keepalive"
+
+	"github.com/fullstorydev/grpcurl"
+)
+
+// slowListener delays accepting each connection, to simulate a server that
+// is slow to connect to.
+type slowListener struct {
+	net.Listener
+	delay time.Duration
+}
+
+func (l *slowListener) Accept() (net.Conn, error) {
+	conn, err := l.Listener.Accept()
+	if err == nil {
+		time.Sleep(l.delay)
+	}
+	return conn, err
+}
+
+func TestConnectTimeoutIndependentOfMaxTime(t *testing.T) {
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("failed to listen: %v", err)
+	}
+	svr := grpc.NewServer()
+	go svr.Serve(&slowListener{Listener: l, delay: 300 * time.Millisecond})
+	defer svr.Stop()
+
+	// A -max-time shorter than the time it takes to connect does not cause
+	// the connection to fail, and its deadline starts once connected.
+	start := time.Now()
+	dialCtx, cancel := connectContext(5)
+	defer cancel()
+	cc, err := grpcurl.BlockingDial(dialCtx, "tcp", l.Addr().String(), nil)
+	if err != nil {
+		t.Fatalf("failed to dial: %v", err)
+	}
+	defer cc.Close()
+	if elapsed := time.Since(start); elapsed < 300*time.Millisecond {
+		t.Fatalf("connection was established too quickly: %v", elapsed)
+	}
+	ctx, cancel := withMaxTime(context.Background(), 0.2)
+	defer cancel()
+	if err := ctx.Err(); err != nil {
+		t.Errorf("max-time context expired before the RPC started: %v", err)
+	}
+	<-ctx.Done()
+	if err := dialCtx.Err(); err != nil {
+		t.Errorf("connect context expired with max-time: %v", err)
+	}
+
+	// A -connect-timeout shorter than the time it takes to connect fails,
+	// regardless of -max-time.
+	dialCtx, cancel = connectContext(0.1)
+	defer cancel()
+	start = time.Now()
+	if cc, err := grpcurl.BlockingDial(dialCtx, "tcp", l.Addr().String(), nil); err == nil {
+		cc.Close()
+		t.Error("expecting dial to fail after connect timeout")
+	} else if elapsed := time.Since(start); elapsed > 250*time.Millisecond {
+		t.Errorf("dial did not fail at connect timeout: took %v", elapsed)
+	}
+}
+
+func TestKeepaliveParams(t *testing.T) {
+	testCases := []struct {
+		time, timeout float64
+		permit        bool
+		expected      keepalive.ClientParameters
+	}{
+		{
+			time:     30,
+			expected: keepalive.ClientParameters{Time: 30 * time.Second, Timeout: 30 * time.Second},
+		},
+		{
+			time:     30,
+			timeout:  5,
+			expected: keepalive.ClientParameters{Time: 30 * time.Second, Timeout: 5 * time.Second},
+		},
+		{
+			time:     0.5,
+			timeout:  0.25,
+			permit:   true,
+			expected: keepalive.ClientParameters{Time: 500 * time.Millisecond, Timeout: 250 * time.Millisecond, PermitWithoutStream: true},
+		},
+	}
+	for _, tc := range testCases {
+		if got := keepaliveParams(tc.time, tc.timeout, tc.permit); got != tc.expected {
+			t.Errorf("keepaliveParams(%v, %v, %v): expecting %+v, got %+v", tc.time, tc.timeout, tc.permit, tc.expected, got)
+		}
+	}
+}
+
+func TestReflectTimeoutIndependentOfRPC(t *testing.T) {
+	ctx, cancel := withMaxTime(context.Background(), 0)
+	defer cancel()
+	refCtx, cancelReflect := withReflectTimeout(ctx, 0.05)
+	defer cancelReflect()
+	<-refCtx.Done()
+	if err := refCtx.Err(); err != context.DeadlineExceeded {
+		t.Errorf("expecting reflect context to expire, got %v", err)
+	}
+	if err := ctx.Err(); err != nil {
+		t.Errorf("context for RPCs expired with reflect timeout: %v", err)
+	}
+
+	refCtx, cancelReflect = withReflectTimeout(ctx, 0)
+	defer cancelReflect()
+	if _, ok := refCtx.Deadline(); ok {
+		t.Error("expecting no deadline without reflect timeout")
+	}
+}
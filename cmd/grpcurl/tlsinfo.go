@@ -0,0 +1,180 @@
+package main
+
+import (
+	"crypto/tls"
+	"crypto/x509/pkix"
+	"encoding/asn1"
+	"errors"
+	"fmt"
+	"io"
+	"math/big"
+	"time"
+)
+
+// printTLSInfo writes a description of the given TLS connection state,
+// including the status of any OCSP response stapled by the server.
+func printTLSInfo(w io.Writer, cs tls.ConnectionState, now time.Time) {
+	fmt.Fprintf(w, "TLS connection info:\n")
+	fmt.Fprintf(w, "  Version: %s\n", tls.VersionName(cs.Version))
+	fmt.Fprintf(w, "  Cipher suite: %s\n", tls.CipherSuiteName(cs.CipherSuite))
+	if cs.NegotiatedProtocol != "" {
+		fmt.Fprintf(w, "  ALPN protocol: %s\n", cs.NegotiatedProtocol)
+	}
+	if cs.ServerName != "" {
+		fmt.Fprintf(w, "  Server name: %s\n", cs.ServerName)
+	}
+	fmt.Fprintf(w, "  Session resumed: %v\n", cs.DidResume)
+	if len(cs.PeerCertificates) > 0 {
+		leaf := cs.PeerCertificates[0]
+		fmt.Fprintf(w, "  Server certificate: %s\n", leaf.Subject)
+		fmt.Fprintf(w, "    Issuer: %s\n", leaf.Issuer)
+		fmt.Fprintf(w, "    Valid: %s to %s\n", leaf.NotBefore.Format(time.RFC3339), leaf.NotAfter.Format(time.RFC3339))
+	}
+	fmt.Fprintf(w, "  OCSP staple: %s\n", describeOCSPStaple(cs, now))
+}
+
+// describeOCSPStaple returns a one-line description of the OCSP response
+// stapled by the server, if any, and whether it is currently valid. The
+// response's signature is not verified.
+func describeOCSPStaple(cs tls.ConnectionState, now time.Time) string {
+	if len(cs.OCSPResponse) == 0 {
+		return "none"
+	}
+	resp, err := parseOCSPResponse(cs.OCSPResponse)
+	if err != nil {
+		return fmt.Sprintf("invalid (%v)", err)
+	}
+	if len(cs.PeerCertificates) > 0 && resp.serial.Cmp(cs.PeerCertificates[0].SerialNumber) != 0 {
+		return fmt.Sprintf("invalid (response is for serial number %s, not the server certificate)", resp.serial)
+	}
+	var desc string
+	switch resp.status {
+	case ocspGood:
+		desc = "good"
+	case ocspRevoked:
+		desc = fmt.Sprintf("REVOKED at %s", resp.revokedAt.Format(time.RFC3339))
+	default:
+		desc = "unknown"
+	}
+	desc += fmt.Sprintf(", produced %s, this update %s", resp.producedAt.Format(time.RFC3339), resp.thisUpdate.Format(time.RFC3339))
+	if !resp.nextUpdate.IsZero() {
+		desc += fmt.Sprintf(", next update %s", resp.nextUpdate.Format(time.RFC3339))
+	}
+	switch {
+	case now.Before(resp.thisUpdate):
+		desc += " (NOT YET VALID)"
+	case !resp.nextUpdate.IsZero() && now.After(resp.nextUpdate):
+		desc += " (EXPIRED)"
+	}
+	return desc
+}
+
+type ocspCertStatus int
+
+const (
+	ocspGood ocspCertStatus = iota
+	ocspRevoked
+	ocspUnknown
+)
+
+// ocspStaple is the information about a certificate in an OCSP response.
+type ocspStaple struct {
+	serial     *big.Int
+	status     ocspCertStatus
+	revokedAt  time.Time
+	producedAt time.Time
+	thisUpdate time.Time
+	nextUpdate time.Time
+}
+
+// The following types mirror the ASN.1 structures in RFC 6960, section 4.2.1.
+
+type ocspResponse struct {
+	Status   asn1.Enumerated
+	Response ocspResponseBytes `asn1:"explicit,tag:0,optional"`
+}
+
+type ocspResponseBytes struct {
+	ResponseType asn1.ObjectIdentifier
+	Response     []byte
+}
+
+type ocspBasicResponse struct {
+	TBSResponseData    ocspResponseData
+	SignatureAlgorithm pkix.AlgorithmIdentifier
+	Signature          asn1.BitString
+	Certificates       []asn1.RawValue `asn1:"explicit,tag:0,optional"`
+}
+
+type ocspResponseData struct {
+	Version            int `asn1:"optional,default:0,explicit,tag:0"`
+	ResponderID        asn1.RawValue
+	ProducedAt         time.Time `asn1:"generalized"`
+	Responses          []ocspSingleResponse
+	ResponseExtensions []pkix.Extension `asn1:"explicit,tag:1,optional"`
+}
+
+type ocspSingleResponse struct {
+	CertID           ocspCertID
+	Good             asn1.Flag        `asn1:"tag:0,optional"`
+	Revoked          ocspRevokedInfo  `asn1:"tag:1,optional"`
+	Unknown          asn1.Flag        `asn1:"tag:2,optional"`
+	ThisUpdate       time.Time        `asn1:"generalized"`
+	NextUpdate       time.Time        `asn1:"generalized,explicit,tag:0,optional"`
+	SingleExtensions []pkix.Extension `asn1:"explicit,tag:1,optional"`
+}
+
+type ocspCertID struct {
+	HashAlgorithm  pkix.AlgorithmIdentifier
+	IssuerNameHash []byte
+	IssuerKeyHash  []byte
+	SerialNumber   *big.Int
+}
+
+type ocspRevokedInfo struct {
+	RevocationTime time.Time       `asn1:"generalized"`
+	Reason         asn1.Enumerated `asn1:"explicit,tag:0,optional"`
+}
+
+var oidOCSPBasic = asn1.ObjectIdentifier{1, 3, 6, 1, 5, 5, 7, 48, 1, 1}
+
+// parseOCSPResponse parses a DER-encoded OCSP response, as stapled in a TLS
+// handshake, and returns the status of the first certificate in it.
+func parseOCSPResponse(der []byte) (*ocspStaple, error) {
+	var resp ocspResponse
+	if rest, err := asn1.Unmarshal(der, &resp); err != nil {
+		return nil, err
+	} else if len(rest) > 0 {
+		return nil, errors.New("trailing data after OCSP response")
+	}
+	if resp.Status != 0 {
+		return nil, fmt.Errorf("OCSP response status %d", resp.Status)
+	}
+	if !resp.Response.ResponseType.Equal(oidOCSPBasic) {
+		return nil, fmt.Errorf("unsupported OCSP response type %v", resp.Response.ResponseType)
+	}
+	var basic ocspBasicResponse
+	if _, err := asn1.Unmarshal(resp.Response.Response, &basic); err != nil {
+		return nil, err
+	}
+	if len(basic.TBSResponseData.Responses) == 0 {
+		return nil, errors.New("OCSP response contains no certificate status")
+	}
+	single := basic.TBSResponseData.Responses[0]
+	staple := &ocspStaple{
+		serial:     single.CertID.SerialNumber,
+		producedAt: basic.TBSResponseData.ProducedAt,
+		thisUpdate: single.ThisUpdate,
+		nextUpdate: single.NextUpdate,
+	}
+	switch {
+	case bool(single.Good):
+		staple.status = ocspGood
+	case bool(single.Unknown):
+		staple.status = ocspUnknown
+	default:
+		staple.status = ocspRevoked
+		staple.revokedAt = single.Revoked.RevocationTime
+	}
+	return staple, nil
+}
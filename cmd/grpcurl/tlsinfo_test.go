@@ -0,0 +1,107 @@
+package main
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/asn1"
+	"math/big"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestDescribeOCSPStaple(t *testing.T) {
+	thisUpdate := time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+	nextUpdate := thisUpdate.Add(7 * 24 * time.Hour)
+	good := asn1.RawValue{Class: asn1.ClassContextSpecific, Tag: 0}
+	revokedTime, err := asn1.MarshalWithParams(thisUpdate.Add(-time.Hour), "generalized")
+	if err != nil {
+		t.Fatalf("failed to marshal time: %v", err)
+	}
+	revoked := asn1.RawValue{Class: asn1.ClassContextSpecific, Tag: 1, IsCompound: true, Bytes: revokedTime}
+
+	cs := tls.ConnectionState{
+		PeerCertificates: []*x509.Certificate{{SerialNumber: big.NewInt(42)}},
+	}
+	testCases := []struct {
+		name     string
+		serial   int64
+		status   asn1.RawValue
+		now      time.Time
+		expected string
+	}{
+		{name: "good", serial: 42, status: good, now: thisUpdate.Add(time.Hour), expected: "good, produced 2024-01-01T00:00:00Z, this update 2024-01-01T00:00:00Z, next update 2024-01-08T00:00:00Z"},
+		{name: "expired", serial: 42, status: good, now: nextUpdate.Add(time.Hour), expected: "good, produced 2024-01-01T00:00:00Z, this update 2024-01-01T00:00:00Z, next update 2024-01-08T00:00:00Z (EXPIRED)"},
+		{name: "revoked", serial: 42, status: revoked, now: thisUpdate, expected: "REVOKED at 2023-12-31T23:00:00Z"},
+		{name: "wrong cert", serial: 43, status: good, now: thisUpdate, expected: "invalid (response is for serial number 43, not the server certificate)"},
+	}
+	for _, tc := range testCases {
+		cs.OCSPResponse = makeOCSPResponse(t, tc.serial, tc.status, thisUpdate, nextUpdate)
+		desc := describeOCSPStaple(cs, tc.now)
+		if !strings.HasPrefix(desc, tc.expected) {
+			t.Errorf("%s: wrong description: expected %q, got %q", tc.name, tc.expected, desc)
+		}
+	}
+
+	cs.OCSPResponse = nil
+	if desc := describeOCSPStaple(cs, thisUpdate); desc != "none" {
+		t.Errorf("wrong description without staple: %q", desc)
+	}
+	cs.OCSPResponse = []byte{1, 2, 3}
+	if desc := describeOCSPStaple(cs, thisUpdate); !strings.HasPrefix(desc, "invalid (") {
+		t.Errorf("wrong description for malformed staple: %q", desc)
+	}
+}
+
+func makeOCSPResponse(t *testing.T, serial int64, status asn1.RawValue, thisUpdate, nextUpdate time.Time) []byte {
+	type singleResponse struct {
+		CertID     ocspCertID
+		Status     asn1.RawValue
+		ThisUpdate time.Time `asn1:"generalized"`
+		NextUpdate time.Time `asn1:"generalized,explicit,tag:0,optional"`
+	}
+	type responseData struct {
+		ResponderID asn1.RawValue
+		ProducedAt  time.Time `asn1:"generalized"`
+		Responses   []singleResponse
+	}
+	type basicResponse struct {
+		TBSResponseData    responseData
+		SignatureAlgorithm pkix.AlgorithmIdentifier
+		Signature          asn1.BitString
+	}
+	keyHash, err := asn1.Marshal([]byte("key-hash"))
+	if err != nil {
+		t.Fatalf("failed to marshal key hash: %v", err)
+	}
+	basic, err := asn1.Marshal(basicResponse{
+		TBSResponseData: responseData{
+			ResponderID: asn1.RawValue{Class: asn1.ClassContextSpecific, Tag: 2, IsCompound: true, Bytes: keyHash},
+			ProducedAt:  thisUpdate,
+			Responses: []singleResponse{{
+				CertID: ocspCertID{
+					HashAlgorithm:  pkix.AlgorithmIdentifier{Algorithm: asn1.ObjectIdentifier{1, 3, 14, 3, 2, 26}},
+					IssuerNameHash: []byte("name-hash"),
+					IssuerKeyHash:  []byte("key-hash"),
+					SerialNumber:   big.NewInt(serial),
+				},
+				Status:     status,
+				ThisUpdate: thisUpdate,
+				NextUpdate: nextUpdate,
+			}},
+		},
+		SignatureAlgorithm: pkix.AlgorithmIdentifier{Algorithm: asn1.ObjectIdentifier{1, 2, 840, 113549, 1, 1, 11}},
+		Signature:          asn1.BitString{Bytes: []byte{0}, BitLength: 8},
+	})
+	if err != nil {
+		t.Fatalf("failed to marshal basic OCSP response: %v", err)
+	}
+	der, err := asn1.Marshal(ocspResponse{
+		Response: ocspResponseBytes{ResponseType: oidOCSPBasic, Response: basic},
+	})
+	if err != nil {
+		t.Fatalf("failed to marshal OCSP response: %v", err)
+	}
+	return der
+}
@@ -0,0 +1,61 @@
+package main
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"os"
+	"os/exec"
+	"strings"
+)
+
+// runTokenCommand runs the given shell command and returns its stdout, with
+// surrounding whitespace removed, for use as a bearer token. The command's
+// stderr is relayed to this process's stderr.
+func runTokenCommand(command string) (string, error) {
+	var stdout bytes.Buffer
+	cmd := shellCommand(command)
+	cmd.Stdout = &stdout
+	cmd.Stderr = os.Stderr
+	if err := cmd.Run(); err != nil {
+		if exitErr, ok := err.(*exec.ExitError); ok {
+			return "", fmt.Errorf("command exited with status %d", exitErr.ExitCode())
+		}
+		return "", err
+	}
+	token := strings.TrimSpace(stdout.String())
+	if token == "" {
+		return "", errors.New("command produced no output")
+	}
+	if strings.ContainsAny(token, "\r\n") {
+		return "", errors.New("command output must be a single line")
+	}
+	return token, nil
+}
+
+// readTokenFile returns the contents of the named file, with surrounding
+// whitespace removed, for use as a bearer token.
+func readTokenFile(name string) (string, error) {
+	data, err := os.ReadFile(name)
+	if err != nil {
+		return "", err
+	}
+	token := strings.TrimSpace(string(data))
+	if token == "" {
+		return "", errors.New("file is empty")
+	}
+	if strings.ContainsAny(token, "\r\n") {
+		return "", errors.New("file must contain a single line")
+	}
+	return token, nil
+}
+
+// authorizationHeader returns an authorization header, in 'name: value'
+// form, for the given token and scheme, like "Bearer". If the scheme is
+// empty, the header value is just the token.
+func authorizationHeader(scheme, token string) string {
+	if scheme == "" {
+		return "authorization: " + token
+	}
+	return "authorization: " + scheme + " " + token
+}
@@ -0,0 +1,39 @@
+package main
+
+import (
+	"runtime"
+	"strings"
+	"testing"
+)
+
+func TestRunTokenCommand(t *testing.T) {
+	if runtime.GOOS == "windows" {
+		t.Skip("test commands use a POSIX shell")
+	}
+
+	testCases := []struct {
+		command  string
+		expected string
+		errMsg   string
+	}{
+		{command: "echo abc123", expected: "abc123"},
+		{command: "printf '  abc123 \\n\\n'", expected: "abc123"},
+		{command: "echo abc123; exit 2", errMsg: "command exited with status 2"},
+		{command: "true", errMsg: "command produced no output"},
+		{command: "printf 'abc\\n123\\n'", errMsg: "command output must be a single line"},
+	}
+	for _, tc := range testCases {
+		token, err := runTokenCommand(tc.command)
+		if tc.errMsg != "" {
+			if err == nil || !strings.Contains(err.Error(), tc.errMsg) {
+				t.Errorf("%q: expecting error containing %q, got %v", tc.command, tc.errMsg, err)
+			}
+			continue
+		}
+		if err != nil {
+			t.Errorf("%q: unexpected error: %v", tc.command, err)
+		} else if token != tc.expected {
+			t.Errorf("%q: expecting token %q, got %q", tc.command, tc.expected, token)
+		}
+	}
+}
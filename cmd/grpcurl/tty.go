@@ -0,0 +1,33 @@
+package main
+
+import (
+	"os"
+	"runtime"
+)
+
+// isTerminal returns true if the given file is a terminal (character device)
+// rather than a regular file or pipe. All decisions about terminal-specific
+// output, like interactive hints, should be made with this function so that
+// redirected output is free of them.
+func isTerminal(f *os.File) bool {
+	fi, err := f.Stat()
+	if err != nil {
+		return false
+	}
+	return fi.Mode()&os.ModeCharDevice != 0
+}
+
+// interactive returns true if a user is likely typing input and watching
+// the output, in which case hints on how to use the terminal are helpful.
+// Hints are written to stderr, so they are only shown if that is a terminal.
+func interactive() bool {
+	return isTerminal(os.Stdin) && isTerminal(os.Stderr)
+}
+
+// eofKeys describes the keys that end input typed into a terminal.
+func eofKeys() string {
+	if runtime.GOOS == "windows" {
+		return "Ctrl-Z and Enter"
+	}
+	return "Ctrl-D"
+}
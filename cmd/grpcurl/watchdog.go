@@ -0,0 +1,143 @@
+package main
+
+import (
+	"context"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/golang/protobuf/proto" //lint:ignore SA1019 we have to import this because it appears in exported API
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/status"
+
+	"github.com/fullstorydev/grpcurl"
+)
+
+// firstResponseWatchdog wraps an event handler and cancels the RPC if no
+// response message is received within a timeout after request headers are
+// sent. Once the first response is received, the watchdog is disarmed.
+type firstResponseWatchdog struct {
+	grpcurl.InvocationEventHandler
+	timeout time.Duration
+	cancel  context.CancelFunc
+
+	mu       sync.Mutex
+	timer    *time.Timer
+	timedOut atomic.Bool
+}
+
+func newFirstResponseWatchdog(h grpcurl.InvocationEventHandler, timeout time.Duration, cancel context.CancelFunc) *firstResponseWatchdog {
+	return &firstResponseWatchdog{InvocationEventHandler: h, timeout: timeout, cancel: cancel}
+}
+
+// TimedOut returns true if the RPC was cancelled because no response arrived
+// in time.
+func (w *firstResponseWatchdog) TimedOut() bool {
+	return w.timedOut.Load()
+}
+
+// Status returns the status with which the RPC fails when it is cancelled
+// because no response arrived in time.
+func (w *firstResponseWatchdog) Status() *status.Status {
+	return status.Newf(codes.DeadlineExceeded, "no response received within %v", w.timeout)
+}
+
+func (w *firstResponseWatchdog) OnSendHeaders(md metadata.MD) {
+	w.mu.Lock()
+	w.timer = time.AfterFunc(w.timeout, func() {
+		w.timedOut.Store(true)
+		w.cancel()
+	})
+	w.mu.Unlock()
+	w.InvocationEventHandler.OnSendHeaders(md)
+}
+
+func (w *firstResponseWatchdog) OnReceiveResponse(resp proto.Message) {
+	w.disarm()
+	w.InvocationEventHandler.OnReceiveResponse(resp)
+}
+
+func (w *firstResponseWatchdog) OnReceiveTrailers(stat *status.Status, md metadata.MD) {
+	w.disarm()
+	w.InvocationEventHandler.OnReceiveTrailers(stat, md)
+}
+
+func (w *firstResponseWatchdog) disarm() {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	if w.timer != nil {
+		w.timer.Stop()
+		w.timer = nil
+	}
+}
+
+// recvTimeoutWatchdog wraps an event handler and cancels the RPC if, after a
+// response message is received, the next one does not arrive within a
+// timeout. The timer is reset on each received message and disarmed when the
+// RPC completes. Waiting for the first response message is not covered; that
+// is what firstResponseWatchdog is for.
+type recvTimeoutWatchdog struct {
+	grpcurl.InvocationEventHandler
+	timeout time.Duration
+	cancel  context.CancelFunc
+
+	mu       sync.Mutex
+	timer    *time.Timer
+	count    int
+	done     bool
+	timedOut atomic.Bool
+}
+
+func newRecvTimeoutWatchdog(h grpcurl.InvocationEventHandler, timeout time.Duration, cancel context.CancelFunc) *recvTimeoutWatchdog {
+	return &recvTimeoutWatchdog{InvocationEventHandler: h, timeout: timeout, cancel: cancel}
+}
+
+// TimedOut returns true if the RPC was cancelled because the next response
+// message did not arrive in time.
+func (w *recvTimeoutWatchdog) TimedOut() bool {
+	return w.timedOut.Load()
+}
+
+// Received returns the number of response messages received before the
+// stream stalled or completed.
+func (w *recvTimeoutWatchdog) Received() int {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	return w.count
+}
+
+// Status returns the status with which the RPC fails when it is cancelled
+// because the next response message did not arrive in time.
+func (w *recvTimeoutWatchdog) Status() *status.Status {
+	n := w.Received()
+	return status.Newf(codes.DeadlineExceeded, "stream stalled: response message #%d not received within %v of message #%d", n+1, w.timeout, n)
+}
+
+func (w *recvTimeoutWatchdog) OnReceiveResponse(resp proto.Message) {
+	w.InvocationEventHandler.OnReceiveResponse(resp)
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	w.count++
+	if w.done {
+		return
+	}
+	if w.timer != nil {
+		w.timer.Stop()
+	}
+	w.timer = time.AfterFunc(w.timeout, func() {
+		w.timedOut.Store(true)
+		w.cancel()
+	})
+}
+
+func (w *recvTimeoutWatchdog) OnReceiveTrailers(stat *status.Status, md metadata.MD) {
+	w.mu.Lock()
+	w.done = true
+	if w.timer != nil {
+		w.timer.Stop()
+		w.timer = nil
+	}
+	w.mu.Unlock()
+	w.InvocationEventHandler.OnReceiveTrailers(stat, md)
+}
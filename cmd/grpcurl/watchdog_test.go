@@ -0,0 +1,173 @@
+package main
+
+import (
+	"context"
+	"io"
+	"net"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/golang/protobuf/jsonpb" //lint:ignore SA1019 we have to import this because it appears in exported API
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	insecureCreds "google.golang.org/grpc/credentials/insecure"
+
+	"github.com/fullstorydev/grpcurl"
+	grpcurl_testing "github.com/fullstorydev/grpcurl/internal/testing"
+)
+
+// dialTestServer starts a server for the test service and returns a
+// connection to it and a descriptor source for its schema. They are cleaned
+// up when the test ends.
+func dialTestServer(t *testing.T) (*grpc.ClientConn, grpcurl.DescriptorSource) {
+	t.Helper()
+	source, err := grpcurl.DescriptorSourceFromProtoSets("../../internal/testing/test.protoset")
+	if err != nil {
+		t.Fatalf("failed to create descriptor source: %v", err)
+	}
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("failed to listen: %v", err)
+	}
+	svr := grpc.NewServer()
+	grpcurl_testing.RegisterTestServiceServer(svr, grpcurl_testing.TestServer{})
+	go svr.Serve(l)
+	t.Cleanup(svr.Stop)
+	cc, err := grpc.Dial(l.Addr().String(), grpc.WithTransportCredentials(insecureCreds.NewCredentials()))
+	if err != nil {
+		t.Fatalf("failed to dial: %v", err)
+	}
+	t.Cleanup(func() { _ = cc.Close() })
+	return cc, source
+}
+
+// streamingOutputRequest returns a supplier of a single request for the
+// StreamingOutputCall method, which asks the server to wait for each of the
+// given intervals and then send a response message.
+func streamingOutputRequest(t *testing.T, intervals ...time.Duration) grpcurl.RequestSupplier {
+	t.Helper()
+	req := &grpcurl_testing.StreamingOutputCallRequest{}
+	for _, interval := range intervals {
+		req.ResponseParameters = append(req.ResponseParameters, &grpcurl_testing.ResponseParameters{
+			Size:       1,
+			IntervalUs: int32(interval / time.Microsecond),
+		})
+	}
+	js, err := (&jsonpb.Marshaler{}).MarshalToString(req)
+	if err != nil {
+		t.Fatalf("failed to construct request: %v", err)
+	}
+	return grpcurl.NewJSONRequestParser(strings.NewReader(js), nil).Next
+}
+
+func newDiscardingHandler() *grpcurl.DefaultEventHandler {
+	return &grpcurl.DefaultEventHandler{Out: io.Discard, Formatter: grpcurl.NewJSONFormatter(false, nil)}
+}
+
+func TestFirstResponseWatchdog(t *testing.T) {
+	cc, source := dialTestServer(t)
+	testCases := []struct {
+		name      string
+		intervals []time.Duration
+		timedOut  bool
+		responses int
+	}{
+		{
+			name:      "stalled",
+			intervals: []time.Duration{time.Second},
+			timedOut:  true,
+		},
+		{
+			// only the first response is watched, so later gaps are fine
+			name:      "prompt",
+			intervals: []time.Duration{0, 300 * time.Millisecond},
+			responses: 2,
+		},
+	}
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			ctx, cancel := context.WithCancel(context.Background())
+			defer cancel()
+			h := newDiscardingHandler()
+			w := newFirstResponseWatchdog(h, 100*time.Millisecond, cancel)
+			err := grpcurl.InvokeRPC(ctx, source, cc, "testing.TestService/StreamingOutputCall", nil, w, streamingOutputRequest(t, tc.intervals...))
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+			if w.TimedOut() != tc.timedOut {
+				t.Fatalf("expecting TimedOut() to be %v", tc.timedOut)
+			}
+			if h.NumResponses != tc.responses {
+				t.Errorf("expecting %d responses, got %d", tc.responses, h.NumResponses)
+			}
+			if !tc.timedOut {
+				if h.Status.Code() != codes.OK {
+					t.Errorf("expecting OK status, got %v", h.Status)
+				}
+				return
+			}
+			if h.Status.Code() != codes.Canceled {
+				t.Errorf("expecting RPC to be cancelled, got %v", h.Status)
+			}
+			stat := w.Status()
+			if stat.Code() != codes.DeadlineExceeded || stat.Message() != "no response received within 100ms" {
+				t.Errorf("wrong status for timeout: %v", stat)
+			}
+		})
+	}
+}
+
+func TestRecvTimeoutWatchdog(t *testing.T) {
+	cc, source := dialTestServer(t)
+	testCases := []struct {
+		name      string
+		intervals []time.Duration
+		timedOut  bool
+		responses int
+	}{
+		{
+			name:      "stalled",
+			intervals: []time.Duration{0, 50 * time.Millisecond, time.Second},
+			timedOut:  true,
+			responses: 2,
+		},
+		{
+			// the time until the first response is not watched
+			name:      "steady",
+			intervals: []time.Duration{300 * time.Millisecond, 20 * time.Millisecond, 20 * time.Millisecond, 20 * time.Millisecond},
+			responses: 4,
+		},
+	}
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			ctx, cancel := context.WithCancel(context.Background())
+			defer cancel()
+			h := newDiscardingHandler()
+			w := newRecvTimeoutWatchdog(h, 200*time.Millisecond, cancel)
+			err := grpcurl.InvokeRPC(ctx, source, cc, "testing.TestService/StreamingOutputCall", nil, w, streamingOutputRequest(t, tc.intervals...))
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+			if w.TimedOut() != tc.timedOut {
+				t.Fatalf("expecting TimedOut() to be %v", tc.timedOut)
+			}
+			if h.NumResponses != tc.responses || w.Received() != tc.responses {
+				t.Errorf("expecting %d responses, got %d (watchdog counted %d)", tc.responses, h.NumResponses, w.Received())
+			}
+			if !tc.timedOut {
+				if h.Status.Code() != codes.OK {
+					t.Errorf("expecting OK status, got %v", h.Status)
+				}
+				return
+			}
+			if h.Status.Code() != codes.Canceled {
+				t.Errorf("expecting RPC to be cancelled, got %v", h.Status)
+			}
+			stat := w.Status()
+			if stat.Code() != codes.DeadlineExceeded || stat.Message() != "stream stalled: response message #3 not received within 200ms of message #2" {
+				t.Errorf("wrong status for timeout: %v", stat)
+			}
+		})
+	}
+}
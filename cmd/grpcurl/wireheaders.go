@@ -0,0 +1,196 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"net"
+	"sync"
+	"time"
+
+	"github.com/golang/protobuf/proto" //lint:ignore SA1019 we have to import this because it appears in exported API
+	"github.com/jhump/protoreflect/desc"
+	"golang.org/x/net/http2"
+	"golang.org/x/net/http2/hpack"
+	"google.golang.org/grpc/credentials"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/status"
+
+	"github.com/fullstorydev/grpcurl"
+)
+
+// wireHeaderRecorder records the request headers that are actually sent on
+// the wire, as decoded from outgoing HTTP/2 HEADERS frames. This includes
+// pseudo-headers and headers that grpc-go adds itself, like "te" and
+// "content-type", which are not visible in the metadata given to an RPC.
+type wireHeaderRecorder struct {
+	mu      sync.Mutex
+	headers map[string][]hpack.HeaderField // most recent request, by :path
+	updated chan struct{}                  // closed and replaced on each update
+}
+
+func newWireHeaderRecorder() *wireHeaderRecorder {
+	return &wireHeaderRecorder{
+		headers: map[string][]hpack.HeaderField{},
+		updated: make(chan struct{}),
+	}
+}
+
+func (r *wireHeaderRecorder) record(fields []hpack.HeaderField) {
+	var path string
+	for _, hf := range fields {
+		if hf.Name == ":path" {
+			path = hf.Value
+		}
+	}
+	if path == "" {
+		// not a request; could be trailers sent at the end of a stream
+		return
+	}
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.headers[path] = fields
+	close(r.updated)
+	r.updated = make(chan struct{})
+}
+
+// take returns and forgets the headers most recently sent for a request with
+// the given path. Since frames are decoded asynchronously, it waits up to the
+// given timeout for them to be recorded.
+func (r *wireHeaderRecorder) take(path string, timeout time.Duration) []hpack.HeaderField {
+	timer := time.NewTimer(timeout)
+	defer timer.Stop()
+	for {
+		r.mu.Lock()
+		fields, ok := r.headers[path]
+		updated := r.updated
+		if ok {
+			delete(r.headers, path)
+		}
+		r.mu.Unlock()
+		if ok {
+			return fields
+		}
+		select {
+		case <-updated:
+		case <-timer.C:
+			return nil
+		}
+	}
+}
+
+// wireHeaderCreds wraps transport credentials so that, after the handshake,
+// outgoing request headers are decoded and given to a wireHeaderRecorder.
+type wireHeaderCreds struct {
+	credentials.TransportCredentials
+	rec *wireHeaderRecorder
+}
+
+func (c *wireHeaderCreds) ClientHandshake(ctx context.Context, addr string, rawConn net.Conn) (net.Conn, credentials.AuthInfo, error) {
+	conn, auth, err := c.TransportCredentials.ClientHandshake(ctx, addr, rawConn)
+	if err != nil {
+		return nil, nil, err
+	}
+	pr, pw := io.Pipe()
+	go c.decode(pr)
+	return &wireHeaderConn{Conn: conn, sent: pw}, auth, nil
+}
+
+func (c *wireHeaderCreds) Clone() credentials.TransportCredentials {
+	return &wireHeaderCreds{TransportCredentials: c.TransportCredentials.Clone(), rec: c.rec}
+}
+
+func (c *wireHeaderCreds) decode(r io.Reader) {
+	// we must always drain the pipe, even if we can't decode it, or else
+	// the connection will block
+	defer func() {
+		_, _ = io.Copy(io.Discard, r)
+	}()
+	preface := make([]byte, len(http2.ClientPreface))
+	if _, err := io.ReadFull(r, preface); err != nil {
+		return
+	}
+	fr := http2.NewFramer(nil, r)
+	fr.SetMaxReadFrameSize(1<<24 - 1)
+	fr.ReadMetaHeaders = hpack.NewDecoder(4096, nil)
+	fr.MaxHeaderListSize = 1<<32 - 1
+	for {
+		f, err := fr.ReadFrame()
+		if err != nil {
+			return
+		}
+		if hf, ok := f.(*http2.MetaHeadersFrame); ok {
+			c.rec.record(hf.Fields)
+		}
+	}
+}
+
+// wireHeaderConn copies all data written to the connection into a pipe.
+type wireHeaderConn struct {
+	net.Conn
+	sent      *io.PipeWriter
+	closeOnce sync.Once
+}
+
+func (c *wireHeaderConn) Write(b []byte) (int, error) {
+	n, err := c.Conn.Write(b)
+	if n > 0 {
+		_, _ = c.sent.Write(b[:n])
+	}
+	return n, err
+}
+
+func (c *wireHeaderConn) Close() error {
+	c.closeOnce.Do(func() {
+		_ = c.sent.Close()
+	})
+	return c.Conn.Close()
+}
+
+// wireHeaderHandler wraps an event handler and prints the request headers
+// that were sent on the wire for the RPC, once the server has responded with
+// headers or, for a trailers-only response, with trailers.
+type wireHeaderHandler struct {
+	grpcurl.InvocationEventHandler
+	rec *wireHeaderRecorder
+	out io.Writer
+
+	path    string
+	printed bool
+}
+
+func (h *wireHeaderHandler) OnResolveMethod(md *desc.MethodDescriptor) {
+	h.path = fmt.Sprintf("/%s/%s", md.GetService().GetFullyQualifiedName(), md.GetName())
+	h.InvocationEventHandler.OnResolveMethod(md)
+}
+
+func (h *wireHeaderHandler) OnReceiveHeaders(md metadata.MD) {
+	h.print()
+	h.InvocationEventHandler.OnReceiveHeaders(md)
+}
+
+func (h *wireHeaderHandler) OnReceiveResponse(resp proto.Message) {
+	h.print()
+	h.InvocationEventHandler.OnReceiveResponse(resp)
+}
+
+func (h *wireHeaderHandler) OnReceiveTrailers(stat *status.Status, md metadata.MD) {
+	h.print()
+	h.InvocationEventHandler.OnReceiveTrailers(stat, md)
+}
+
+func (h *wireHeaderHandler) print() {
+	if h.printed {
+		return
+	}
+	h.printed = true
+	fields := h.rec.take(h.path, time.Second)
+	if fields == nil {
+		fmt.Fprintf(h.out, "\nRequest headers sent on the wire:\n(not observed)\n")
+		return
+	}
+	fmt.Fprintf(h.out, "\nRequest headers sent on the wire:\n")
+	for _, hf := range fields {
+		fmt.Fprintf(h.out, "%s: %s\n", hf.Name, hf.Value)
+	}
+}
@@ -0,0 +1,102 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"net"
+	"strings"
+	"testing"
+	"time"
+
+	"golang.org/x/net/http2/hpack"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	insecureCreds "google.golang.org/grpc/credentials/insecure"
+
+	"github.com/fullstorydev/grpcurl"
+	grpcurl_testing "github.com/fullstorydev/grpcurl/internal/testing"
+)
+
+func TestWireHeaderRecorder(t *testing.T) {
+	rec := newWireHeaderRecorder()
+
+	// headers without a path, like trailers, are ignored
+	rec.record([]hpack.HeaderField{{Name: "grpc-status", Value: "0"}})
+	if fields := rec.take("", 10*time.Millisecond); fields != nil {
+		t.Errorf("expecting nothing recorded, got %v", fields)
+	}
+
+	go func() {
+		time.Sleep(50 * time.Millisecond)
+		rec.record([]hpack.HeaderField{{Name: ":path", Value: "/svc.Svc/Other"}})
+		rec.record([]hpack.HeaderField{{Name: ":path", Value: "/svc.Svc/Get"}, {Name: "x-one", Value: "1"}})
+	}()
+	// waits for headers that are recorded asynchronously
+	fields := rec.take("/svc.Svc/Get", 5*time.Second)
+	if len(fields) != 2 || fields[1].Value != "1" {
+		t.Errorf("wrong headers recorded: %v", fields)
+	}
+	// and forgets them once taken
+	if fields := rec.take("/svc.Svc/Get", 10*time.Millisecond); fields != nil {
+		t.Errorf("expecting headers to be taken only once, got %v", fields)
+	}
+	if fields := rec.take("/svc.Svc/Other", 10*time.Millisecond); len(fields) != 1 {
+		t.Errorf("expecting headers for other path to be kept, got %v", fields)
+	}
+}
+
+func TestWireHeaders(t *testing.T) {
+	source, err := grpcurl.DescriptorSourceFromProtoSets("../../internal/testing/test.protoset")
+	if err != nil {
+		t.Fatalf("failed to create descriptor source: %v", err)
+	}
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("failed to listen: %v", err)
+	}
+	svr := grpc.NewServer()
+	grpcurl_testing.RegisterTestServiceServer(svr, grpcurl_testing.TestServer{})
+	go svr.Serve(l)
+	defer svr.Stop()
+
+	rec := newWireHeaderRecorder()
+	creds := &wireHeaderCreds{TransportCredentials: insecureCreds.NewCredentials(), rec: rec}
+	cc, err := grpc.Dial(l.Addr().String(), grpc.WithTransportCredentials(creds))
+	if err != nil {
+		t.Fatalf("failed to dial: %v", err)
+	}
+	defer cc.Close()
+
+	var out bytes.Buffer
+	dh := newDiscardingHandler()
+	h := &wireHeaderHandler{InvocationEventHandler: dh, rec: rec, out: &out}
+	err = grpcurl.InvokeRPC(context.Background(), source, cc, "testing.TestService/EmptyCall", []string{"x-custom: val"}, h, grpcurl.NewJSONRequestParser(strings.NewReader("{}"), nil).Next)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if dh.Status.Code() != codes.OK {
+		t.Fatalf("RPC failed: %v", dh.Status)
+	}
+	if strings.Count(out.String(), "Request headers sent on the wire:") != 1 {
+		t.Fatalf("expecting wire headers to be printed once, got %q", out.String())
+	}
+	lines := strings.Split(out.String(), "\n")
+	for _, expected := range []string{
+		":method: POST",
+		":path: /testing.TestService/EmptyCall",
+		"content-type: application/grpc",
+		"te: trailers",
+		"x-custom: val",
+	} {
+		found := false
+		for _, line := range lines {
+			if line == expected {
+				found = true
+				break
+			}
+		}
+		if !found {
+			t.Errorf("expecting header %q in output %q", expected, out.String())
+		}
+	}
+}
@@ -7,6 +7,8 @@ import (
 	"io"
 	"os"
 	"path/filepath"
+	"sort"
+	"strings"
 	"sync"
 
 	"github.com/golang/protobuf/proto" //lint:ignore SA1019 we have to import this because it appears in exported API
@@ -17,6 +19,8 @@ import (
 	"github.com/jhump/protoreflect/grpcreflect"
 	"google.golang.org/grpc/codes"
 	"google.golang.org/grpc/status"
+	"google.golang.org/protobuf/encoding/protowire"
+	protov2 "google.golang.org/protobuf/proto"
 	"google.golang.org/protobuf/types/descriptorpb"
 )
 
@@ -26,6 +30,20 @@ import (
 // (like file descriptor sets) must be used.
 var ErrReflectionNotSupported = errors.New("server does not support the reflection API")
 
+// ErrReflectionNotAuthorized is matched, via errors.Is, by errors returned from
+// DescriptorSource operations when the server rejects reflection requests with
+// a PermissionDenied or Unauthenticated status. This usually means the server
+// requires credentials, in request metadata, for its reflection service. The
+// returned error retains the server's status, so status.FromError still works.
+var ErrReflectionNotAuthorized = errors.New("server reflection requires authorization")
+
+// ErrReflectionDeadlineExceeded is matched, via errors.Is, by errors returned
+// from DescriptorSource operations that are backed by server reflection when a
+// request fails after the deadline of the source's context has passed. The
+// context is the one given to DescriptorSourceFromServer, which should be the
+// one with which the reflection client was created.
+var ErrReflectionDeadlineExceeded = errors.New("server reflection did not complete before its deadline")
+
 // DescriptorSource is a source of protobuf descriptor information. It can be backed by a FileDescriptorSet
 // proto (like a file generated by protoc) or a remote server that supports the reflection API.
 type DescriptorSource interface {
@@ -39,24 +57,133 @@ type DescriptorSource interface {
 }
 
 // DescriptorSourceFromProtoSets creates a DescriptorSource that is backed by the named files, whose contents
-// are encoded FileDescriptorSet protos.
+// are encoded FileDescriptorSet protos. If more than one of the named files contains a file with the same
+// name, the copy in the last one is used. A file may instead contain a stream of FileDescriptorProto
+// messages, each preceded by its varint-encoded length, as written by some build tools.
 func DescriptorSourceFromProtoSets(fileNames ...string) (DescriptorSource, error) {
+	return DescriptorSourceFromProtoSetsWithOptions(ProtoSetsOptions{Override: true}, fileNames...)
+}
+
+// ProtoSetsOptions are options that control how the files in multiple
+// protosets are merged by DescriptorSourceFromProtoSetsWithOptions.
+type ProtoSetsOptions struct {
+	// If true, a file in a protoset replaces a file with the same name but
+	// different contents from an earlier protoset. This allows a patched
+	// protoset to be layered over a base one. If false, such a conflict is an
+	// error. Identical copies of a file are never a conflict.
+	Override bool
+	// If non-nil, this function is called for each file that is replaced
+	// because of Override, with the name of the file and the names of the
+	// protosets that contain the new and the replaced copies.
+	OnOverride func(name, protoset, previous string)
+}
+
+// DescriptorSourceFromProtoSetsWithOptions is like DescriptorSourceFromProtoSets,
+// except that the given options control how files with the same name in
+// different protosets are handled.
+func DescriptorSourceFromProtoSetsWithOptions(opts ProtoSetsOptions, fileNames ...string) (DescriptorSource, error) {
 	files := &descriptorpb.FileDescriptorSet{}
+	type loadedFile struct {
+		index    int
+		protoset string
+	}
+	loaded := map[string]loadedFile{}
 	for _, fileName := range fileNames {
 		b, err := os.ReadFile(fileName)
 		if err != nil {
 			return nil, fmt.Errorf("could not load protoset file %q: %v", fileName, err)
 		}
-		var fs descriptorpb.FileDescriptorSet
-		err = proto.Unmarshal(b, &fs)
+		fs, err := parseProtoset(b)
 		if err != nil {
 			return nil, fmt.Errorf("could not parse contents of protoset file %q: %v", fileName, err)
 		}
-		files.File = append(files.File, fs.File...)
+		for _, fd := range fs.File {
+			prev, ok := loaded[fd.GetName()]
+			if !ok {
+				loaded[fd.GetName()] = loadedFile{index: len(files.File), protoset: fileName}
+				files.File = append(files.File, fd)
+				continue
+			}
+			if protov2.Equal(files.File[prev.index], fd) {
+				continue
+			}
+			if !opts.Override {
+				return nil, fmt.Errorf("protoset files %q and %q contain different copies of %q", prev.protoset, fileName, fd.GetName())
+			}
+			if opts.OnOverride != nil {
+				opts.OnOverride(fd.GetName(), fileName, prev.protoset)
+			}
+			files.File[prev.index] = fd
+			loaded[fd.GetName()] = loadedFile{index: prev.index, protoset: fileName}
+		}
 	}
 	return DescriptorSourceFromFileDescriptorSet(files)
 }
 
+// parseProtoset parses the contents of a protoset file. This is usually an
+// encoded FileDescriptorSet. But some build tools instead write a stream of
+// FileDescriptorProto messages, each preceded by its varint-encoded length,
+// so that is accepted, too. Since a FileDescriptorSet always starts with the
+// tag of its file field, the contents are only parsed as a stream if they do
+// not start with that tag or if they do not parse as a set of named files.
+func parseProtoset(b []byte) (*descriptorpb.FileDescriptorSet, error) {
+	var fs descriptorpb.FileDescriptorSet
+	if len(b) == 0 {
+		return &fs, nil
+	}
+	var setErr error
+	if b[0] == fileDescriptorSetFileTag {
+		setErr = proto.Unmarshal(b, &fs)
+		if setErr == nil && allFilesNamed(fs.File) {
+			return &fs, nil
+		}
+	}
+	files, err := parseDelimitedFiles(b)
+	if err == nil && allFilesNamed(files) {
+		return &descriptorpb.FileDescriptorSet{File: files}, nil
+	}
+	if setErr != nil {
+		return nil, setErr
+	}
+	if err != nil {
+		return nil, err
+	}
+	return nil, errors.New("contents are neither a FileDescriptorSet nor a stream of FileDescriptorProtos")
+}
+
+// fileDescriptorSetFileTag is the first byte of any non-empty encoded
+// FileDescriptorSet: the tag of its file field, which is a length-delimited
+// field with number 1.
+var fileDescriptorSetFileTag = byte(protowire.EncodeTag(1, protowire.BytesType))
+
+// parseDelimitedFiles parses a stream of FileDescriptorProto messages, each
+// preceded by its varint-encoded length.
+func parseDelimitedFiles(b []byte) ([]*descriptorpb.FileDescriptorProto, error) {
+	var files []*descriptorpb.FileDescriptorProto
+	for len(b) > 0 {
+		data, n := protowire.ConsumeBytes(b)
+		if n < 0 {
+			return nil, protowire.ParseError(n)
+		}
+		var fd descriptorpb.FileDescriptorProto
+		if err := protov2.Unmarshal(data, &fd); err != nil {
+			return nil, err
+		}
+		files = append(files, &fd)
+		b = b[n:]
+	}
+	return files, nil
+}
+
+func allFilesNamed(files []*descriptorpb.FileDescriptorProto) bool {
+	for _, fd := range files {
+		if fd.GetName() == "" {
+			return false
+		}
+	}
+	return true
+}
+
 // DescriptorSourceFromProtoFiles creates a DescriptorSource that is backed by the named files,
 // whose contents are Protocol Buffer source files. The given importPaths are used to locate
 // any imported files.
@@ -90,7 +217,7 @@ func DescriptorSourceFromFileDescriptorSet(files *descriptorpb.FileDescriptorSet
 			return nil, err
 		}
 	}
-	return &fileSource{files: resolved}, nil
+	return newFileSource(resolved), nil
 }
 
 func resolveFileDescriptor(unresolved map[string]*descriptorpb.FileDescriptorProto, resolved map[string]*desc.FileDescriptor, filename string) (*desc.FileDescriptor, error) {
@@ -126,7 +253,7 @@ func DescriptorSourceFromFileDescriptors(files ...*desc.FileDescriptor) (Descrip
 			return nil, err
 		}
 	}
-	return &fileSource{files: fds}, nil
+	return newFileSource(fds), nil
 }
 
 func addFile(fd *desc.FileDescriptor, fds map[string]*desc.FileDescriptor) error {
@@ -149,9 +276,22 @@ func addFile(fd *desc.FileDescriptor, fds map[string]*desc.FileDescriptor) error
 }
 
 type fileSource struct {
-	files  map[string]*desc.FileDescriptor
-	er     *dynamic.ExtensionRegistry
-	erInit sync.Once
+	files map[string]*desc.FileDescriptor
+	// the keys of files, in sorted order
+	fileNames []string
+	er        *dynamic.ExtensionRegistry
+	erInit    sync.Once
+	// if true, FindSymbol fails when more than one file defines the symbol
+	strict bool
+}
+
+func newFileSource(files map[string]*desc.FileDescriptor) *fileSource {
+	names := make([]string, 0, len(files))
+	for name := range files {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return &fileSource{files: files, fileNames: names}
 }
 
 func (fs *fileSource) ListServices() ([]string, error) {
@@ -183,12 +323,27 @@ func (fs *fileSource) GetAllFiles() ([]*desc.FileDescriptor, error) {
 }
 
 func (fs *fileSource) FindSymbol(fullyQualifiedName string) (desc.Descriptor, error) {
-	for _, fd := range fs.files {
-		if dsc := fd.FindSymbol(fullyQualifiedName); dsc != nil {
-			return dsc, nil
+	matches := fs.findAllSymbols(fullyQualifiedName)
+	if len(matches) == 0 {
+		return nil, notFound("Symbol", fullyQualifiedName)
+	}
+	if len(matches) > 1 && fs.strict {
+		return nil, &AmbiguousSymbolError{Symbol: fullyQualifiedName, Files: fileNamesOf(matches)}
+	}
+	return matches[0], nil
+}
+
+// findAllSymbols returns the descriptors for the given symbol from every file
+// that defines it. The results are ordered by file name, so that resolution is
+// deterministic even when the symbol is ambiguous.
+func (fs *fileSource) findAllSymbols(fullyQualifiedName string) []desc.Descriptor {
+	var matches []desc.Descriptor
+	for _, name := range fs.fileNames {
+		if dsc := fs.files[name].FindSymbol(fullyQualifiedName); dsc != nil {
+			matches = append(matches, dsc)
 		}
 	}
-	return nil, notFound("Symbol", fullyQualifiedName)
+	return matches
 }
 
 func (fs *fileSource) AllExtensionsForType(typeName string) ([]*desc.FieldDescriptor, error) {
@@ -201,65 +356,459 @@ func (fs *fileSource) AllExtensionsForType(typeName string) ([]*desc.FieldDescri
 	return fs.er.AllExtensionsForType(typeName), nil
 }
 
+// AmbiguousSymbolError is returned from a strict DescriptorSource when the
+// requested symbol is defined in more than one file. See StrictSymbols.
+type AmbiguousSymbolError struct {
+	// Symbol is the fully-qualified name that was requested.
+	Symbol string
+	// Files are the names of all files that define the symbol.
+	Files []string
+}
+
+func (e *AmbiguousSymbolError) Error() string {
+	return fmt.Sprintf("symbol %s is ambiguous: defined in %s", e.Symbol, strings.Join(e.Files, ", "))
+}
+
+// StrictSymbols returns a DescriptorSource that is like the given one, except
+// that its FindSymbol method returns an *AmbiguousSymbolError when more than
+// one file defines the requested symbol. Without this, the definition from the
+// file whose name sorts first is returned. Only sources created from protoset
+// files, proto source files, or file descriptors can detect ambiguity; other
+// sources are returned unchanged.
+func StrictSymbols(source DescriptorSource) DescriptorSource {
+	fs, ok := source.(*fileSource)
+	if !ok {
+		return source
+	}
+	return &fileSource{files: fs.files, fileNames: fs.fileNames, strict: true}
+}
+
+// SymbolFiles returns the names of all files in the given source that define
+// the given fully-qualified symbol, sorted by name. This can be used to detect
+// when a symbol is ambiguous, which may happen when multiple descriptor sets
+// are combined. Only sources created from protoset files, proto source files,
+// or file descriptors can report this; for other sources it returns nil.
+func SymbolFiles(source DescriptorSource, fullyQualifiedName string) []string {
+	fs, ok := source.(*fileSource)
+	if !ok {
+		return nil
+	}
+	return fileNamesOf(fs.findAllSymbols(fullyQualifiedName))
+}
+
+func fileNamesOf(dscs []desc.Descriptor) []string {
+	if len(dscs) == 0 {
+		return nil
+	}
+	files := make([]string, len(dscs))
+	for i, d := range dscs {
+		files[i] = d.GetFile().GetName()
+	}
+	return files
+}
+
+// DescriptorSourceForFile returns a DescriptorSource that contains only the
+// named file from the given source, along with the file's transitive
+// dependencies. This can be used to restrict symbol resolution to a single
+// file (and its imports), to disambiguate symbols in a large source. An error
+// is returned if the given source does not contain the named file.
+func DescriptorSourceForFile(source DescriptorSource, fileName string) (DescriptorSource, error) {
+	return DescriptorSourceForFiles(source, fileName)
+}
+
+// DescriptorSourceForFiles is like DescriptorSourceForFile, except that the
+// returned source contains all of the named files and their transitive
+// dependencies. For a source backed by server reflection, only the named
+// files (and their dependencies) are requested from the server, which can
+// greatly reduce reflection traffic for servers with very large schemas.
+func DescriptorSourceForFiles(source DescriptorSource, fileNames ...string) (DescriptorSource, error) {
+	fds := make([]*desc.FileDescriptor, 0, len(fileNames))
+	if ss, ok := source.(serverSource); ok {
+		fds = fds[:len(fileNames)]
+		errs := make([]error, len(fileNames))
+		ss.forEach(len(fileNames), func(client *grpcreflect.Client, i int) {
+			fds[i], errs[i] = client.FileByFilename(fileNames[i])
+		})
+		for i, err := range errs {
+			if err != nil {
+				if isNotFoundError(err) {
+					return nil, notFound("File", fileNames[i])
+				}
+				return nil, ss.reflectionError(err)
+			}
+		}
+		if ss.pool != nil && len(fds) > 1 {
+			// files fetched by different clients have their own copies of
+			// any shared dependencies, so link them again into one graph
+			byName, err := desc.CreateFileDescriptorsFromSet(desc.ToFileDescriptorSet(fds...))
+			if err != nil {
+				return nil, err
+			}
+			for i := range fds {
+				fds[i] = byName[fds[i].GetName()]
+			}
+		}
+	} else {
+		files, err := GetAllFiles(source)
+		if err != nil {
+			return nil, err
+		}
+		byName := make(map[string]*desc.FileDescriptor, len(files))
+		for _, f := range files {
+			byName[f.GetName()] = f
+		}
+		for _, fileName := range fileNames {
+			fd := byName[fileName]
+			if fd == nil {
+				return nil, notFound("File", fileName)
+			}
+			fds = append(fds, fd)
+		}
+	}
+	return DescriptorSourceFromFileDescriptors(fds...)
+}
+
 // DescriptorSourceFromServer creates a DescriptorSource that uses the given gRPC reflection client
 // to interrogate a server for descriptor information. If the server does not support the reflection
-// API then the various DescriptorSource methods will return ErrReflectionNotSupported
-func DescriptorSourceFromServer(_ context.Context, refClient *grpcreflect.Client) DescriptorSource {
-	return serverSource{client: refClient}
+// API then the various DescriptorSource methods will return ErrReflectionNotSupported.
+// To support servers that expose either version of the reflection service, v1
+// or v1alpha, create the client with grpcreflect.NewClientAuto, which uses v1
+// and falls back to v1alpha if the server does not implement v1.
+//
+// The given context should be the one with which the reflection client was
+// created. If it has a deadline, requests that fail after the deadline has
+// passed return errors that match ErrReflectionDeadlineExceeded.
+func DescriptorSourceFromServer(ctx context.Context, refClient *grpcreflect.Client) DescriptorSource {
+	return serverSource{ctx: ctx, client: refClient, cache: newReflectionCache()}
+}
+
+// ServerSourceOptions are options for a DescriptorSource that is backed by
+// server reflection, created with DescriptorSourceFromServerWithOptions.
+type ServerSourceOptions struct {
+	// The maximum number of reflection requests to have in flight at once
+	// when many descriptors are needed at once, such as by GetAllFiles or
+	// DescriptorSourceForFiles. Since a reflection client sends one request
+	// at a time, on a single stream, concurrent requests use additional
+	// clients, created with NewClient. If less than two, or if NewClient is
+	// nil, requests are sent one at a time.
+	Concurrency int
+	// NewClient creates an additional reflection client. The new client
+	// should use the same connection, and a context with the same deadline
+	// and metadata, as the client given to DescriptorSourceFromServerWithOptions.
+	// The caller is responsible for calling Reset on each new client when the
+	// source is no longer needed. Calls to NewClient are never concurrent.
+	NewClient func() *grpcreflect.Client
+}
+
+// DescriptorSourceFromServerWithOptions is like DescriptorSourceFromServer,
+// except that it accepts options to send reflection requests concurrently.
+// Errors are handled for each request: if some requests fail, the others
+// still complete, and the first error, in the order the descriptors were
+// requested, is reported.
+func DescriptorSourceFromServerWithOptions(ctx context.Context, refClient *grpcreflect.Client, opts ServerSourceOptions) DescriptorSource {
+	ss := serverSource{ctx: ctx, client: refClient, cache: newReflectionCache()}
+	if opts.Concurrency > 1 && opts.NewClient != nil {
+		ss.pool = &reflectionClientPool{
+			idle:      []*grpcreflect.Client{refClient},
+			max:       opts.Concurrency,
+			newClient: opts.NewClient,
+		}
+	}
+	return ss
 }
 
 type serverSource struct {
+	// the context of the reflection clients, used to report errors after
+	// its deadline
+	ctx    context.Context
 	client *grpcreflect.Client
+	// if non-nil, used to send requests concurrently
+	pool *reflectionClientPool
+	// resolved symbols and extensions, shared by all clients in the pool
+	cache *reflectionCache
+}
+
+// reflectionCache remembers the results of reflection requests, so that
+// repeated lookups of the same symbol or extensions do not go back to the
+// server. The reflection client caches the files it has downloaded, but the
+// cache here is shared by all clients in a pool and also includes the
+// extension numbers for a type, which the client always asks the server for.
+// Only successful results are cached. Entries are never invalidated: a
+// source is expected to be used for the duration of a single invocation.
+type reflectionCache struct {
+	mu         sync.Mutex
+	symbols    map[string]desc.Descriptor
+	extensions map[string][]*desc.FieldDescriptor
+}
+
+func newReflectionCache() *reflectionCache {
+	return &reflectionCache{
+		symbols:    map[string]desc.Descriptor{},
+		extensions: map[string][]*desc.FieldDescriptor{},
+	}
+}
+
+func (c *reflectionCache) symbol(name string) desc.Descriptor {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.symbols[name]
+}
+
+func (c *reflectionCache) putSymbol(name string, d desc.Descriptor) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.symbols[name] = d
+}
+
+func (c *reflectionCache) extensionsFor(typeName string) ([]*desc.FieldDescriptor, bool) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	exts, ok := c.extensions[typeName]
+	return exts, ok
+}
+
+func (c *reflectionCache) putExtensions(typeName string, exts []*desc.FieldDescriptor) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.extensions[typeName] = exts
+}
+
+// reflectionClientPool is a set of reflection clients, for sending requests
+// concurrently. Clients are created as needed, up to a maximum.
+type reflectionClientPool struct {
+	mu        sync.Mutex
+	idle      []*grpcreflect.Client
+	max       int
+	newClient func() *grpcreflect.Client
+}
+
+// get returns an idle client, creating one if necessary. The caller must
+// return it with put. Since callers limit themselves to max concurrent
+// clients, no more than max clients are ever created.
+func (p *reflectionClientPool) get() *grpcreflect.Client {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	if n := len(p.idle); n > 0 {
+		c := p.idle[n-1]
+		p.idle = p.idle[:n-1]
+		return c
+	}
+	return p.newClient()
+}
+
+func (p *reflectionClientPool) put(c *grpcreflect.Client) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	p.idle = append(p.idle, c)
+}
+
+// forEach calls fn for each index in [0, n), passing a client with which to
+// send reflection requests. If the source has a pool of clients, calls are
+// concurrent, up to the pool's maximum; otherwise they are sequential and all
+// use the source's client.
+func (ss serverSource) forEach(n int, fn func(client *grpcreflect.Client, i int)) {
+	if ss.pool == nil || n < 2 {
+		for i := 0; i < n; i++ {
+			fn(ss.client, i)
+		}
+		return
+	}
+	workers := ss.pool.max
+	if workers > n {
+		workers = n
+	}
+	indexes := make(chan int)
+	var wg sync.WaitGroup
+	for w := 0; w < workers; w++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			client := ss.pool.get()
+			defer ss.pool.put(client)
+			for i := range indexes {
+				fn(client, i)
+			}
+		}()
+	}
+	for i := 0; i < n; i++ {
+		indexes <- i
+	}
+	close(indexes)
+	wg.Wait()
+}
+
+// findSymbols resolves all of the given symbols, concurrently if the source
+// has a pool of clients. The returned slices have an element for each symbol.
+func (ss serverSource) findSymbols(names []string) ([]desc.Descriptor, []error) {
+	ds := make([]desc.Descriptor, len(names))
+	errs := make([]error, len(names))
+	var missing []int
+	for i, name := range names {
+		if d := ss.cache.symbol(name); d != nil {
+			ds[i] = d
+		} else {
+			missing = append(missing, i)
+		}
+	}
+	ss.forEach(len(missing), func(client *grpcreflect.Client, j int) {
+		i := missing[j]
+		ds[i], errs[i] = ss.findSymbolWithClient(client, names[i])
+	})
+	return ds, errs
 }
 
 func (ss serverSource) ListServices() ([]string, error) {
 	svcs, err := ss.client.ListServices()
-	return svcs, reflectionSupport(err)
+	return svcs, ss.reflectionError(err)
 }
 
 func (ss serverSource) FindSymbol(fullyQualifiedName string) (desc.Descriptor, error) {
-	file, err := ss.client.FileContainingSymbol(fullyQualifiedName)
+	if d := ss.cache.symbol(fullyQualifiedName); d != nil {
+		return d, nil
+	}
+	return ss.findSymbolWithClient(ss.client, fullyQualifiedName)
+}
+
+func (ss serverSource) findSymbolWithClient(client *grpcreflect.Client, fullyQualifiedName string) (desc.Descriptor, error) {
+	file, err := client.FileContainingSymbol(fullyQualifiedName)
 	if err != nil {
-		return nil, reflectionSupport(err)
+		return nil, ss.reflectionError(err)
 	}
 	d := file.FindSymbol(fullyQualifiedName)
 	if d == nil {
 		return nil, notFound("Symbol", fullyQualifiedName)
 	}
+	ss.cache.putSymbol(fullyQualifiedName, d)
 	return d, nil
 }
 
 func (ss serverSource) AllExtensionsForType(typeName string) ([]*desc.FieldDescriptor, error) {
+	if exts, ok := ss.cache.extensionsFor(typeName); ok {
+		return exts, nil
+	}
 	var exts []*desc.FieldDescriptor
 	nums, err := ss.client.AllExtensionNumbersForType(typeName)
 	if err != nil {
-		return nil, reflectionSupport(err)
+		return nil, ss.reflectionError(err)
 	}
 	for _, fieldNum := range nums {
 		ext, err := ss.client.ResolveExtension(typeName, fieldNum)
 		if err != nil {
-			return nil, reflectionSupport(err)
+			return nil, ss.reflectionError(err)
 		}
 		exts = append(exts, ext)
 	}
+	ss.cache.putExtensions(typeName, exts)
 	return exts, nil
 }
 
+// reflectionError is like reflectionSupport, except that it also reports
+// errors that occur after the deadline of the source's context.
+func (ss serverSource) reflectionError(err error) error {
+	if err != nil && ss.ctx != nil && ss.ctx.Err() == context.DeadlineExceeded {
+		return reflectionDeadlineError{err: err}
+	}
+	return reflectionSupport(err)
+}
+
 func reflectionSupport(err error) error {
 	if err == nil {
 		return nil
 	}
-	if stat, ok := status.FromError(err); ok && stat.Code() == codes.Unimplemented {
-		return ErrReflectionNotSupported
+	if stat, ok := status.FromError(err); ok {
+		switch stat.Code() {
+		case codes.Unimplemented:
+			return ErrReflectionNotSupported
+		case codes.PermissionDenied, codes.Unauthenticated:
+			return reflectionAuthError{err: err}
+		}
 	}
 	return err
 }
 
+// reflectionAuthError wraps an error from a reflection request that the
+// server rejected for lack of authorization.
+type reflectionAuthError struct {
+	err error
+}
+
+func (e reflectionAuthError) Error() string {
+	return fmt.Sprintf("%v: %v", ErrReflectionNotAuthorized, e.err)
+}
+
+func (e reflectionAuthError) Is(target error) bool {
+	return target == ErrReflectionNotAuthorized
+}
+
+func (e reflectionAuthError) Unwrap() error {
+	return e.err
+}
+
+func (e reflectionAuthError) GRPCStatus() *status.Status {
+	return status.Convert(e.err)
+}
+
+// reflectionDeadlineError wraps an error from a reflection request that failed
+// after the deadline of the reflection client's context. Unlike
+// reflectionAuthError, it does not report the server's status directly, so
+// that status.FromError includes this error's message.
+type reflectionDeadlineError struct {
+	err error
+}
+
+func (e reflectionDeadlineError) Error() string {
+	return fmt.Sprintf("%v: %v", ErrReflectionDeadlineExceeded, e.err)
+}
+
+func (e reflectionDeadlineError) Is(target error) bool {
+	return target == ErrReflectionDeadlineExceeded
+}
+
+func (e reflectionDeadlineError) Unwrap() error {
+	return e.err
+}
+
 // WriteProtoset will use the given descriptor source to resolve all of the given
 // symbols and write a proto file descriptor set with their definitions to the
 // given output. The output will include descriptors for all files in which the
 // symbols are defined as well as their transitive dependencies.
 func WriteProtoset(out io.Writer, descSource DescriptorSource, symbols ...string) error {
+	return WriteProtosetWithOptions(out, descSource, ProtosetOptions{}, symbols...)
+}
+
+// ProtosetOptions are options that control how a protoset is written by
+// WriteProtosetWithOptions.
+type ProtosetOptions struct {
+	// If true, the files in the protoset are sorted by name and serialized
+	// deterministically, so the output is byte-for-byte identical for the same
+	// set of files, regardless of the order in which symbols are given. If
+	// false, files appear in the order that symbols are given, with each file
+	// after its dependencies.
+	SortFiles bool
+	// If true, a Buf image is written instead of a plain FileDescriptorSet.
+	// An image is compatible with a FileDescriptorSet, but each file also
+	// records whether it is an import, meaning it does not define any of the
+	// given symbols and is only included as a dependency. Since an image must
+	// list each file after its dependencies, files are not sorted by name
+	// even if SortFiles is true, but they are still serialized
+	// deterministically.
+	BufImage bool
+	// When writing a Buf image, the name of the module, in
+	// "remote/owner/repository" form, to record for the files that are not
+	// imports. If empty, no module information is recorded.
+	BufModule string
+	// If true, the source code info of each file, which holds the comments
+	// and source locations of its elements, is omitted. This makes the
+	// protoset much smaller, but descriptions of its elements, such as from
+	// the describe verb, no longer include comments. If false, source code
+	// info is written if the descriptor source has it, such as when it was
+	// built from proto source files.
+	StripSourceInfo bool
+}
+
+// WriteProtosetWithOptions is like WriteProtoset, except that the given
+// options control the layout of the output.
+func WriteProtosetWithOptions(out io.Writer, descSource DescriptorSource, opts ProtosetOptions, symbols ...string) error {
 	filenames, fds, err := getFileDescriptors(symbols, descSource)
 	if err != nil {
 		return err
@@ -271,8 +820,37 @@ func WriteProtoset(out io.Writer, descSource DescriptorSource, symbols ...string
 	for _, filename := range filenames {
 		allFilesSlice = addFilesToSet(allFilesSlice, expandedFiles, fds[filename])
 	}
+	if opts.StripSourceInfo {
+		for i, fd := range allFilesSlice {
+			if fd.SourceCodeInfo != nil {
+				// copy, since the descriptor's own proto must not be modified
+				fd = protov2.Clone(fd).(*descriptorpb.FileDescriptorProto)
+				fd.SourceCodeInfo = nil
+				allFilesSlice[i] = fd
+			}
+		}
+	}
+	if opts.BufImage {
+		targets := make(map[string]bool, len(filenames))
+		for _, filename := range filenames {
+			targets[filename] = true
+		}
+		b, err := marshalBufImage(allFilesSlice, targets, opts.BufModule, opts.SortFiles)
+		if err != nil {
+			return fmt.Errorf("failed to serialize buf image: %v", err)
+		}
+		if _, err := out.Write(b); err != nil {
+			return fmt.Errorf("failed to write buf image: %v", err)
+		}
+		return nil
+	}
+	if opts.SortFiles {
+		sort.Slice(allFilesSlice, func(i, j int) bool {
+			return allFilesSlice[i].GetName() < allFilesSlice[j].GetName()
+		})
+	}
 	// now we can serialize to file
-	b, err := proto.Marshal(&descriptorpb.FileDescriptorSet{File: allFilesSlice})
+	b, err := protov2.MarshalOptions{Deterministic: opts.SortFiles}.Marshal(&descriptorpb.FileDescriptorSet{File: allFilesSlice})
 	if err != nil {
 		return fmt.Errorf("failed to serialize file descriptor set: %v", err)
 	}
@@ -282,6 +860,65 @@ func WriteProtoset(out io.Writer, descSource DescriptorSource, symbols ...string
 	return nil
 }
 
+// Field numbers of the buf.alpha.image.v1 messages that are written by
+// marshalBufImage. An Image has the same layout as a FileDescriptorSet, and
+// an ImageFile has the same layout as a FileDescriptorProto plus one extra
+// field, so only that field needs to be encoded by hand.
+const (
+	bufImageFileField            = 1    // Image.file
+	bufImageFileExtensionField   = 8042 // ImageFile.buf_extension
+	bufExtensionIsImportField    = 1    // ImageFileExtension.is_import
+	bufExtensionModuleInfoField  = 2    // ImageFileExtension.module_info
+	bufModuleInfoNameField       = 1    // ModuleInfo.name
+	bufModuleNameRemoteField     = 1    // ModuleName.remote
+	bufModuleNameOwnerField      = 2    // ModuleName.owner
+	bufModuleNameRepositoryField = 3    // ModuleName.repository
+)
+
+// marshalBufImage serializes the given files, which must be in dependency
+// order, as a buf.alpha.image.v1.Image. Files whose names are not in targets
+// are marked as imports. If module is not empty, it is recorded as the module
+// of the target files.
+func marshalBufImage(files []*descriptorpb.FileDescriptorProto, targets map[string]bool, module string, deterministic bool) ([]byte, error) {
+	var moduleName []byte
+	if module != "" {
+		parts := strings.Split(module, "/")
+		if len(parts) != 3 || parts[0] == "" || parts[1] == "" || parts[2] == "" {
+			return nil, fmt.Errorf("module name %q should be in 'remote/owner/repository' form", module)
+		}
+		moduleName = protowire.AppendTag(moduleName, bufModuleNameRemoteField, protowire.BytesType)
+		moduleName = protowire.AppendString(moduleName, parts[0])
+		moduleName = protowire.AppendTag(moduleName, bufModuleNameOwnerField, protowire.BytesType)
+		moduleName = protowire.AppendString(moduleName, parts[1])
+		moduleName = protowire.AppendTag(moduleName, bufModuleNameRepositoryField, protowire.BytesType)
+		moduleName = protowire.AppendString(moduleName, parts[2])
+	}
+	var image []byte
+	for _, fd := range files {
+		b, err := protov2.MarshalOptions{Deterministic: deterministic}.Marshal(fd)
+		if err != nil {
+			return nil, err
+		}
+		isImport := !targets[fd.GetName()]
+		var ext []byte
+		ext = protowire.AppendTag(ext, bufExtensionIsImportField, protowire.VarintType)
+		ext = protowire.AppendVarint(ext, protowire.EncodeBool(isImport))
+		if !isImport && moduleName != nil {
+			var moduleInfo []byte
+			moduleInfo = protowire.AppendTag(moduleInfo, bufModuleInfoNameField, protowire.BytesType)
+			moduleInfo = protowire.AppendBytes(moduleInfo, moduleName)
+			ext = protowire.AppendTag(ext, bufExtensionModuleInfoField, protowire.BytesType)
+			ext = protowire.AppendBytes(ext, moduleInfo)
+		}
+		b = protowire.AppendTag(b, bufImageFileExtensionField, protowire.BytesType)
+		b = protowire.AppendBytes(b, ext)
+
+		image = protowire.AppendTag(image, bufImageFileField, protowire.BytesType)
+		image = protowire.AppendBytes(image, b)
+	}
+	return image, nil
+}
+
 func addFilesToSet(allFiles []*descriptorpb.FileDescriptorProto, expanded map[string]struct{}, fd *desc.FileDescriptor) []*descriptorpb.FileDescriptorProto {
 	if _, ok := expanded[fd.GetName()]; ok {
 		// already seen this one
@@ -2,10 +2,16 @@ package grpcurl
 
 import (
 	"bytes"
+	"errors"
 	"os"
+	"path/filepath"
+	"sort"
 	"testing"
 
 	"github.com/golang/protobuf/proto" //lint:ignore SA1019 we have to import this because it appears in exported API
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+	"google.golang.org/protobuf/encoding/protowire"
 	"google.golang.org/protobuf/types/descriptorpb"
 )
 
@@ -33,6 +39,45 @@ func TestWriteProtoset(t *testing.T) {
 	checkWriteProtoset(t, descSrc, mergedProtoset, "TestService", "testing.TestService")
 }
 
+func TestWriteProtosetSorted(t *testing.T) {
+	exampleProtoset, err := loadProtoset("./internal/testing/example.protoset")
+	if err != nil {
+		t.Fatalf("failed to load example.protoset: %v", err)
+	}
+	testProtoset, err := loadProtoset("./internal/testing/test.protoset")
+	if err != nil {
+		t.Fatalf("failed to load test.protoset: %v", err)
+	}
+	descSrc, err := DescriptorSourceFromFileDescriptorSet(&descriptorpb.FileDescriptorSet{
+		File: append(exampleProtoset.File, testProtoset.File...),
+	})
+	if err != nil {
+		t.Fatalf("failed to create descriptor source: %v", err)
+	}
+
+	opts := ProtosetOptions{SortFiles: true}
+	var buf1, buf2 bytes.Buffer
+	if err := WriteProtosetWithOptions(&buf1, descSrc, opts, "TestService", "testing.TestService"); err != nil {
+		t.Fatalf("failed to write protoset: %v", err)
+	}
+	if err := WriteProtosetWithOptions(&buf2, descSrc, opts, "testing.TestService", "TestService"); err != nil {
+		t.Fatalf("failed to write protoset: %v", err)
+	}
+	if !bytes.Equal(buf1.Bytes(), buf2.Bytes()) {
+		t.Error("sorted protosets differ when symbols are given in a different order")
+	}
+
+	var result descriptorpb.FileDescriptorSet
+	if err := proto.Unmarshal(buf1.Bytes(), &result); err != nil {
+		t.Fatalf("failed to unmarshal protoset: %v", err)
+	}
+	for i := 1; i < len(result.File); i++ {
+		if result.File[i-1].GetName() >= result.File[i].GetName() {
+			t.Errorf("files not sorted: %q appears before %q", result.File[i-1].GetName(), result.File[i].GetName())
+		}
+	}
+}
+
 func loadProtoset(path string) (*descriptorpb.FileDescriptorSet, error) {
 	b, err := os.ReadFile(path)
 	if err != nil {
@@ -60,3 +105,283 @@ func checkWriteProtoset(t *testing.T, descSrc DescriptorSource, protoset *descri
 		t.Fatalf("written protoset not equal to input:\nExpecting: %s\nActual: %s", protoset, &result)
 	}
 }
+
+func TestWriteProtosetStripSourceInfo(t *testing.T) {
+	descSrc, err := DescriptorSourceFromProtoFiles([]string{"internal/testing"}, "test.proto")
+	if err != nil {
+		t.Fatalf("failed to create descriptor source: %v", err)
+	}
+
+	var withInfo, withoutInfo bytes.Buffer
+	if err := WriteProtosetWithOptions(&withInfo, descSrc, ProtosetOptions{}, "testing.TestService"); err != nil {
+		t.Fatalf("failed to write protoset: %v", err)
+	}
+	if err := WriteProtosetWithOptions(&withoutInfo, descSrc, ProtosetOptions{StripSourceInfo: true}, "testing.TestService"); err != nil {
+		t.Fatalf("failed to write protoset: %v", err)
+	}
+	if withoutInfo.Len() >= withInfo.Len() {
+		t.Errorf("expecting protoset without source info to be smaller: %d bytes with, %d bytes without", withInfo.Len(), withoutInfo.Len())
+	}
+
+	for _, tc := range []struct {
+		name     string
+		data     []byte
+		expected bool
+	}{
+		{name: "with source info", data: withInfo.Bytes(), expected: true},
+		{name: "without source info", data: withoutInfo.Bytes(), expected: false},
+	} {
+		var fs descriptorpb.FileDescriptorSet
+		if err := proto.Unmarshal(tc.data, &fs); err != nil {
+			t.Fatalf("%s: failed to parse protoset: %v", tc.name, err)
+		}
+		for _, fd := range fs.File {
+			if fd.GetName() != "test.proto" {
+				continue
+			}
+			if hasInfo := fd.SourceCodeInfo != nil; hasInfo != tc.expected {
+				t.Errorf("%s: wrong presence of source code info: expecting %v, got %v", tc.name, tc.expected, hasInfo)
+			}
+		}
+	}
+
+	// the source's own descriptors are not modified
+	d, err := descSrc.FindSymbol("testing.TestService")
+	if err != nil {
+		t.Fatalf("failed to find service: %v", err)
+	}
+	if d.GetFile().AsFileDescriptorProto().SourceCodeInfo == nil {
+		t.Error("source code info was removed from the descriptor source")
+	}
+}
+
+func TestAmbiguousSymbols(t *testing.T) {
+	makeFile := func(name string) *descriptorpb.FileDescriptorProto {
+		return &descriptorpb.FileDescriptorProto{
+			Name:        proto.String(name),
+			Package:     proto.String("foo.bar"),
+			MessageType: []*descriptorpb.DescriptorProto{{Name: proto.String("Baz")}},
+		}
+	}
+	descSrc, err := DescriptorSourceFromFileDescriptorSet(&descriptorpb.FileDescriptorSet{
+		File: []*descriptorpb.FileDescriptorProto{makeFile("b.proto"), makeFile("a.proto")},
+	})
+	if err != nil {
+		t.Fatalf("failed to create descriptor source: %v", err)
+	}
+
+	files := SymbolFiles(descSrc, "foo.bar.Baz")
+	if len(files) != 2 || files[0] != "a.proto" || files[1] != "b.proto" {
+		t.Errorf("wrong files reported for ambiguous symbol: %v", files)
+	}
+	d, err := descSrc.FindSymbol("foo.bar.Baz")
+	if err != nil {
+		t.Fatalf("failed to find symbol: %v", err)
+	}
+	if d.GetFile().GetName() != "a.proto" {
+		t.Errorf("expecting symbol from a.proto, instead got it from %s", d.GetFile().GetName())
+	}
+
+	_, err = StrictSymbols(descSrc).FindSymbol("foo.bar.Baz")
+	if ambErr, ok := err.(*AmbiguousSymbolError); !ok {
+		t.Errorf("expecting *AmbiguousSymbolError, instead got %v", err)
+	} else if len(ambErr.Files) != 2 {
+		t.Errorf("wrong files in error: %v", ambErr.Files)
+	}
+}
+
+func TestDescriptorSourceForFile(t *testing.T) {
+	descSrc, err := DescriptorSourceFromProtoSets("./internal/testing/example.protoset")
+	if err != nil {
+		t.Fatalf("failed to create descriptor source: %v", err)
+	}
+
+	fileSrc, err := DescriptorSourceForFile(descSrc, "example.proto")
+	if err != nil {
+		t.Fatalf("failed to create file descriptor source: %v", err)
+	}
+	if _, err := fileSrc.FindSymbol("TestService"); err != nil {
+		t.Errorf("failed to find symbol in file: %v", err)
+	}
+	// dependencies are included
+	if _, err := fileSrc.FindSymbol("google.protobuf.Empty"); err != nil {
+		t.Errorf("failed to find symbol in imported file: %v", err)
+	}
+
+	fileSrc, err = DescriptorSourceForFile(descSrc, "google/protobuf/empty.proto")
+	if err != nil {
+		t.Fatalf("failed to create file descriptor source: %v", err)
+	}
+	if _, err := fileSrc.FindSymbol("TestService"); err == nil {
+		t.Error("expecting error finding symbol outside of file")
+	}
+
+	if _, err := DescriptorSourceForFile(descSrc, "does/not/exist.proto"); err == nil {
+		t.Error("expecting error for file not in descriptor source")
+	}
+}
+
+func TestDescriptorSourceFromProtoSetsOverride(t *testing.T) {
+	writeProtoset := func(name, msgName string) string {
+		fs := &descriptorpb.FileDescriptorSet{
+			File: []*descriptorpb.FileDescriptorProto{{
+				Name:        proto.String("foo.proto"),
+				Package:     proto.String("foo"),
+				MessageType: []*descriptorpb.DescriptorProto{{Name: proto.String(msgName)}},
+			}},
+		}
+		b, err := proto.Marshal(fs)
+		if err != nil {
+			t.Fatalf("failed to marshal protoset: %v", err)
+		}
+		path := filepath.Join(t.TempDir(), name)
+		if err := os.WriteFile(path, b, 0644); err != nil {
+			t.Fatalf("failed to write protoset: %v", err)
+		}
+		return path
+	}
+	base := writeProtoset("base.protoset", "Base")
+	baseCopy := writeProtoset("copy.protoset", "Base")
+	patch := writeProtoset("patch.protoset", "Patched")
+
+	// identical copies are not a conflict
+	if _, err := DescriptorSourceFromProtoSetsWithOptions(ProtoSetsOptions{}, base, baseCopy); err != nil {
+		t.Errorf("unexpected error for identical copies: %v", err)
+	}
+	if _, err := DescriptorSourceFromProtoSetsWithOptions(ProtoSetsOptions{}, base, patch); err == nil {
+		t.Error("expecting error for conflicting copies without override")
+	}
+
+	var overrides []string
+	descSrc, err := DescriptorSourceFromProtoSetsWithOptions(ProtoSetsOptions{
+		Override: true,
+		OnOverride: func(name, protoset, previous string) {
+			overrides = append(overrides, name+" "+filepath.Base(protoset)+" "+filepath.Base(previous))
+		},
+	}, base, patch)
+	if err != nil {
+		t.Fatalf("failed to create descriptor source: %v", err)
+	}
+	if len(overrides) != 1 || overrides[0] != "foo.proto patch.protoset base.protoset" {
+		t.Errorf("wrong overrides reported: %v", overrides)
+	}
+	if _, err := descSrc.FindSymbol("foo.Patched"); err != nil {
+		t.Errorf("failed to find symbol from overriding protoset: %v", err)
+	}
+	if _, err := descSrc.FindSymbol("foo.Base"); err == nil {
+		t.Error("expecting error finding symbol from overridden protoset")
+	}
+}
+
+func TestDescriptorSourceFromDelimitedProtoset(t *testing.T) {
+	protoset, err := loadProtoset("./internal/testing/test.protoset")
+	if err != nil {
+		t.Fatalf("failed to load protoset: %v", err)
+	}
+	var b []byte
+	for _, fd := range protoset.File {
+		fdBytes, err := proto.Marshal(fd)
+		if err != nil {
+			t.Fatalf("failed to marshal file descriptor: %v", err)
+		}
+		b = protowire.AppendVarint(b, uint64(len(fdBytes)))
+		b = append(b, fdBytes...)
+	}
+	path := filepath.Join(t.TempDir(), "delimited.protoset")
+	if err := os.WriteFile(path, b, 0644); err != nil {
+		t.Fatalf("failed to write protoset: %v", err)
+	}
+
+	descSrc, err := DescriptorSourceFromProtoSets(path)
+	if err != nil {
+		t.Fatalf("failed to create descriptor source: %v", err)
+	}
+	svcs, err := descSrc.ListServices()
+	if err != nil {
+		t.Fatalf("failed to list services: %v", err)
+	}
+	sort.Strings(svcs)
+	if len(svcs) != 2 || svcs[0] != "testing.TestService" || svcs[1] != "testing.UnimplementedService" {
+		t.Errorf("wrong services: %v", svcs)
+	}
+	if _, err := descSrc.FindSymbol("testing.TestService.UnaryCall"); err != nil {
+		t.Errorf("failed to find symbol: %v", err)
+	}
+
+	// a truncated stream is an error
+	if err := os.WriteFile(path, b[:len(b)-1], 0644); err != nil {
+		t.Fatalf("failed to write protoset: %v", err)
+	}
+	if _, err := DescriptorSourceFromProtoSets(path); err == nil {
+		t.Error("expecting error for truncated delimited protoset")
+	}
+}
+
+func TestWriteProtosetBufImage(t *testing.T) {
+	descSrc, err := DescriptorSourceFromProtoSets("./internal/testing/example.protoset")
+	if err != nil {
+		t.Fatalf("failed to create descriptor source: %v", err)
+	}
+	var buf bytes.Buffer
+	opts := ProtosetOptions{BufImage: true, BufModule: "buf.build/acme/example"}
+	if err := WriteProtosetWithOptions(&buf, descSrc, opts, "TestService"); err != nil {
+		t.Fatalf("failed to write buf image: %v", err)
+	}
+
+	// an image can be read as a FileDescriptorSet, with the buf extension in
+	// each file's unknown fields
+	var result descriptorpb.FileDescriptorSet
+	if err := proto.Unmarshal(buf.Bytes(), &result); err != nil {
+		t.Fatalf("failed to unmarshal buf image: %v", err)
+	}
+	if len(result.File) < 2 {
+		t.Fatalf("expecting example.proto and its imports, got %d files", len(result.File))
+	}
+	for i, fd := range result.File {
+		unknown := fd.ProtoReflect().GetUnknown()
+		num, typ, n := protowire.ConsumeTag(unknown)
+		if n < 0 || num != 8042 || typ != protowire.BytesType {
+			t.Fatalf("file %q does not have buf extension", fd.GetName())
+		}
+		ext, _ := protowire.ConsumeBytes(unknown[n:])
+		isTarget := fd.GetName() == "example.proto"
+		if isTarget != (i == len(result.File)-1) {
+			t.Errorf("file %q is out of dependency order", fd.GetName())
+		}
+		// is_import is always the first field
+		expectImport := byte(1)
+		if isTarget {
+			expectImport = 0
+		}
+		if len(ext) < 2 || ext[0] != 0x08 || ext[1] != expectImport {
+			t.Errorf("file %q has wrong is_import value", fd.GetName())
+		}
+		if hasModule := bytes.Contains(ext, []byte("buf.build")); hasModule != isTarget {
+			t.Errorf("file %q: expecting module info %v, got %v", fd.GetName(), isTarget, hasModule)
+		}
+	}
+
+	opts.BufModule = "acme/example"
+	if err := WriteProtosetWithOptions(&buf, descSrc, opts, "TestService"); err == nil {
+		t.Error("expecting error for invalid module name")
+	}
+}
+
+func TestReflectionSupportAuthErrors(t *testing.T) {
+	if err := reflectionSupport(status.Error(codes.Unimplemented, "nope")); err != ErrReflectionNotSupported {
+		t.Errorf("expecting ErrReflectionNotSupported, got %v", err)
+	}
+	for _, code := range []codes.Code{codes.PermissionDenied, codes.Unauthenticated} {
+		err := reflectionSupport(status.Error(code, "missing token"))
+		if !errors.Is(err, ErrReflectionNotAuthorized) {
+			t.Errorf("%v: expecting ErrReflectionNotAuthorized, got %v", code, err)
+		}
+		if stat := status.Convert(err); stat.Code() != code || stat.Message() != "missing token" {
+			t.Errorf("%v: server status not retained, got %v", code, stat)
+		}
+	}
+	err := reflectionSupport(status.Error(codes.Internal, "oops"))
+	if errors.Is(err, ErrReflectionNotAuthorized) || errors.Is(err, ErrReflectionNotSupported) {
+		t.Errorf("unexpected translation of other error: %v", err)
+	}
+}
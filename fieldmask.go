@@ -0,0 +1,128 @@
+package grpcurl
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/golang/protobuf/proto" //lint:ignore SA1019 we have to import this because it appears in exported API
+	"github.com/jhump/protoreflect/desc"
+	"github.com/jhump/protoreflect/dynamic"
+)
+
+// FieldMask selects fields of a message type, like a google.protobuf.FieldMask.
+// Applying it to a message clears all other fields.
+type FieldMask struct {
+	md   *desc.MessageDescriptor
+	tree fieldMaskTree
+}
+
+// fieldMaskTree is the set of fields selected from a message, keyed by field
+// number. An empty sub-tree selects the whole field. Otherwise, the field is
+// a message (or a repeated message) and the sub-tree selects its fields.
+type fieldMaskTree map[int32]fieldMaskTree
+
+// NewFieldMask returns a mask that selects the fields of the given message
+// type named by paths. Each path is a dot-separated sequence of field names,
+// which may be either the names in proto source or the JSON names. Every
+// element of a path but the last must be a message field, but not a map. If
+// such a field is repeated, the rest of the path applies to each element. A
+// path that is a prefix of another selects the whole field, overriding the
+// longer path.
+//
+// An error is returned if a path refers to an unknown field.
+func NewFieldMask(md *desc.MessageDescriptor, paths ...string) (*FieldMask, error) {
+	tree := fieldMaskTree{}
+	for _, path := range paths {
+		if err := tree.add(md, path); err != nil {
+			return nil, err
+		}
+	}
+	return &FieldMask{md: md, tree: tree}, nil
+}
+
+func (t fieldMaskTree) add(md *desc.MessageDescriptor, path string) error {
+	if path == "" {
+		return fmt.Errorf("empty field mask path")
+	}
+	names := strings.Split(path, ".")
+	for i, name := range names {
+		fd := md.FindFieldByName(name)
+		if fd == nil {
+			fd = md.FindFieldByJSONName(name)
+		}
+		if fd == nil {
+			return fmt.Errorf("invalid field mask path %q: message %s has no field named %q", path, md.GetFullyQualifiedName(), name)
+		}
+		sub, ok := t[fd.GetNumber()]
+		if i == len(names)-1 {
+			// a shorter path selects the whole field
+			t[fd.GetNumber()] = fieldMaskTree{}
+			return nil
+		}
+		if fd.GetMessageType() == nil || fd.IsMap() {
+			return fmt.Errorf("invalid field mask path %q: field %s is not a message", path, fd.GetFullyQualifiedName())
+		}
+		if ok && len(sub) == 0 {
+			// whole field already selected
+			return nil
+		}
+		if !ok {
+			sub = fieldMaskTree{}
+			t[fd.GetNumber()] = sub
+		}
+		t, md = sub, fd.GetMessageType()
+	}
+	return nil
+}
+
+// Apply clears the fields of msg that are not selected by the mask. The
+// message must be of the type with which the mask was created.
+func (m *FieldMask) Apply(msg proto.Message) error {
+	var md *desc.MessageDescriptor
+	if dm, ok := msg.(*dynamic.Message); ok {
+		md = dm.GetMessageDescriptor()
+	} else {
+		var err error
+		if md, err = desc.LoadMessageDescriptorForMessage(msg); err != nil {
+			return err
+		}
+	}
+	if md.GetFullyQualifiedName() != m.md.GetFullyQualifiedName() {
+		return fmt.Errorf("field mask for %s cannot be applied to message of type %s", m.md.GetFullyQualifiedName(), md.GetFullyQualifiedName())
+	}
+	return m.tree.apply(msg)
+}
+
+func (t fieldMaskTree) apply(msg proto.Message) error {
+	dm, isDynamic := msg.(*dynamic.Message)
+	if !isDynamic {
+		var err error
+		if dm, err = dynamic.AsDynamicMessage(msg); err != nil {
+			return err
+		}
+	}
+	for _, fd := range dm.GetKnownFields() {
+		sub, ok := t[fd.GetNumber()]
+		if !ok || fd.IsExtension() {
+			dm.ClearField(fd)
+			continue
+		}
+		if len(sub) == 0 || !dm.HasField(fd) {
+			continue
+		}
+		if fd.IsRepeated() {
+			for i := 0; i < dm.FieldLength(fd); i++ {
+				if err := sub.apply(dm.GetRepeatedField(fd, i).(proto.Message)); err != nil {
+					return err
+				}
+			}
+		} else if err := sub.apply(dm.GetField(fd).(proto.Message)); err != nil {
+			return err
+		}
+	}
+	if !isDynamic {
+		// msg is not a dynamic message, so copy the result back into it
+		return dm.ConvertTo(msg)
+	}
+	return nil
+}
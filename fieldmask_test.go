@@ -0,0 +1,147 @@
+package grpcurl_test
+
+import (
+	"context"
+	"strings"
+	"testing"
+
+	"github.com/golang/protobuf/jsonpb" //lint:ignore SA1019 we have to import this because it appears in exported API
+	"github.com/golang/protobuf/proto"  //lint:ignore SA1019 we have to import this because it appears in exported API
+	"github.com/jhump/protoreflect/desc"
+	"github.com/jhump/protoreflect/dynamic"
+	"google.golang.org/grpc/codes"
+
+	. "github.com/fullstorydev/grpcurl"
+	grpcurl_testing "github.com/fullstorydev/grpcurl/internal/testing"
+)
+
+func TestNewFieldMask(t *testing.T) {
+	md := findMessage(t, "testing.StreamingOutputCallResponse")
+	if _, err := NewFieldMask(md, "payload.type", "payload", "payload.body"); err != nil {
+		t.Errorf("unexpected error for valid paths: %v", err)
+	}
+
+	testCases := []struct {
+		path   string
+		errMsg string
+	}{
+		{path: "", errMsg: "empty field mask path"},
+		{path: "nope", errMsg: `message testing.StreamingOutputCallResponse has no field named "nope"`},
+		{path: "payload.nope", errMsg: `message testing.Payload has no field named "nope"`},
+		{path: "payload.body.size", errMsg: "field testing.Payload.body is not a message"},
+	}
+	for _, tc := range testCases {
+		_, err := NewFieldMask(md, tc.path)
+		if err == nil || !strings.Contains(err.Error(), tc.errMsg) {
+			t.Errorf("path %q: expecting error containing %q, got %v", tc.path, tc.errMsg, err)
+		}
+	}
+}
+
+func TestFieldMaskApply(t *testing.T) {
+	md := findMessage(t, "testing.SimpleRequest")
+	mask, err := NewFieldMask(md, "responseSize", "payload.body")
+	if err != nil {
+		t.Fatalf("failed to create field mask: %v", err)
+	}
+
+	// generated messages are masked, too
+	req := &grpcurl_testing.SimpleRequest{
+		ResponseType: grpcurl_testing.PayloadType_RANDOM,
+		ResponseSize: 10,
+		Payload:      &grpcurl_testing.Payload{Type: grpcurl_testing.PayloadType_UNCOMPRESSABLE, Body: []byte("abc")},
+		FillUsername: true,
+	}
+	if err := mask.Apply(req); err != nil {
+		t.Fatalf("failed to apply field mask: %v", err)
+	}
+	expected := &grpcurl_testing.SimpleRequest{
+		ResponseSize: 10,
+		Payload:      &grpcurl_testing.Payload{Body: []byte("abc")},
+	}
+	if !proto.Equal(req, expected) {
+		t.Errorf("wrong masked message: expecting %v, got %v", expected, req)
+	}
+
+	if err := mask.Apply(&grpcurl_testing.SimpleResponse{}); err == nil {
+		t.Error("expecting error applying field mask to message of wrong type")
+	}
+}
+
+func TestFieldMaskStreamingResponses(t *testing.T) {
+	md := findMessage(t, "testing.StreamingOutputCallResponse")
+	req := &grpcurl_testing.StreamingOutputCallRequest{
+		ResponseType:       grpcurl_testing.PayloadType_UNCOMPRESSABLE,
+		ResponseParameters: []*grpcurl_testing.ResponseParameters{{Size: 10}, {Size: 20}, {Size: 30}},
+	}
+	payload, err := (&jsonpb.Marshaler{}).MarshalToString(req)
+	if err != nil {
+		t.Fatalf("failed to construct request: %v", err)
+	}
+
+	testCases := []struct {
+		path    string
+		checkFn func(t *testing.T, i int, payload *dynamic.Message)
+	}{
+		{
+			path: "payload.type",
+			checkFn: func(t *testing.T, i int, payload *dynamic.Message) {
+				if body := payload.GetFieldByName("body").([]byte); len(body) != 0 {
+					t.Errorf("response %d: expecting body to be masked out, got %d bytes", i, len(body))
+				}
+				if typ := payload.GetFieldByName("type").(int32); typ != int32(grpcurl_testing.PayloadType_UNCOMPRESSABLE) {
+					t.Errorf("response %d: wrong payload type: %d", i, typ)
+				}
+			},
+		},
+		{
+			path: "payload.body",
+			checkFn: func(t *testing.T, i int, payload *dynamic.Message) {
+				if body := payload.GetFieldByName("body").([]byte); len(body) != (i+1)*10 {
+					t.Errorf("response %d: wrong body size: expecting %d, got %d", i, (i+1)*10, len(body))
+				}
+				if typ := payload.GetFieldByName("type").(int32); typ != 0 {
+					t.Errorf("response %d: expecting type to be masked out, got %d", i, typ)
+				}
+			},
+		},
+	}
+	for _, tc := range testCases {
+		t.Run(tc.path, func(t *testing.T) {
+			mask, err := NewFieldMask(md, tc.path)
+			if err != nil {
+				t.Fatalf("failed to create field mask: %v", err)
+			}
+			var out strings.Builder
+			var resps []proto.Message
+			h := &DefaultEventHandler{
+				Out: &out,
+				Formatter: func(m proto.Message) (string, error) {
+					resps = append(resps, proto.Clone(m))
+					return "", nil
+				},
+				ResponseFieldMask: mask,
+			}
+			rf := NewJSONRequestParser(strings.NewReader(payload), nil)
+			err = InvokeRPC(context.Background(), sourceProtoset, ccNoReflect, "testing.TestService/StreamingOutputCall", makeHeaders(codes.OK), h, rf.Next)
+			if err != nil {
+				t.Fatalf("unexpected error during RPC: %v", err)
+			}
+			if h.Status.Code() != codes.OK || len(resps) != 3 {
+				t.Fatalf("expecting three responses and OK status, got %d and %v", len(resps), h.Status)
+			}
+			for i, resp := range resps {
+				dm := resp.(*dynamic.Message)
+				tc.checkFn(t, i, dm.GetFieldByName("payload").(*dynamic.Message))
+			}
+		})
+	}
+}
+
+func findMessage(t *testing.T, name string) *desc.MessageDescriptor {
+	d, err := sourceProtoset.FindSymbol(name)
+	if err != nil {
+		t.Fatalf("failed to find %s: %v", name, err)
+	}
+	return d.(*desc.MessageDescriptor)
+}
@@ -5,11 +5,18 @@ import (
 	"bytes"
 	"encoding/base64"
 	"encoding/json"
+	"errors"
 	"fmt"
 	"io"
+	"math"
+	"os"
 	"reflect"
+	"sort"
+	"strconv"
 	"strings"
 	"sync"
+	"text/template"
+	"time"
 
 	"github.com/golang/protobuf/jsonpb" //lint:ignore SA1019 we have to import this because it appears in exported API
 	"github.com/golang/protobuf/proto"  //lint:ignore SA1019 we have to import this because it appears in exported API
@@ -18,6 +25,9 @@ import (
 	"google.golang.org/grpc/codes"
 	"google.golang.org/grpc/metadata"
 	"google.golang.org/grpc/status"
+	"google.golang.org/protobuf/types/descriptorpb"
+	"google.golang.org/protobuf/types/known/anypb"
+	"gopkg.in/yaml.v3"
 )
 
 // RequestParser processes input into messages.
@@ -33,9 +43,16 @@ type RequestParser interface {
 }
 
 type jsonRequestParser struct {
-	dec          *json.Decoder
-	unmarshaler  jsonpb.Unmarshaler
-	requestCount int
+	in             *bufio.Reader
+	dec            *json.Decoder
+	unmarshaler    jsonpb.Unmarshaler
+	bytesFromFiles bool
+	requestCount   int
+
+	// set after the first call to Next, once it is known whether the input
+	// is a JSON array of messages
+	started bool
+	inArray bool
 }
 
 // NewJSONRequestParser returns a RequestParser that reads data in JSON format
@@ -44,35 +61,196 @@ type jsonRequestParser struct {
 //
 // Input data that contains more than one message should just include all
 // messages concatenated (though whitespace is necessary to separate some kinds
-// of values in JSON).
+// of values in JSON). Alternatively, the input may be a single JSON array
+// whose elements are the messages, in which case the parser returns io.EOF
+// after the closing bracket. (The exception is a request of type
+// google.protobuf.ListValue or google.protobuf.Value, whose JSON form can
+// itself be an array.)
 //
 // If the given reader has no data, the returned parser will return io.EOF on
 // the very first call.
 func NewJSONRequestParser(in io.Reader, resolver jsonpb.AnyResolver) RequestParser {
-	return &jsonRequestParser{
-		dec:         json.NewDecoder(in),
-		unmarshaler: jsonpb.Unmarshaler{AnyResolver: resolver},
-	}
+	return newJSONRequestParserWithUnmarshaler(in, jsonpb.Unmarshaler{AnyResolver: resolver}, false)
 }
 
 // NewJSONRequestParserWithUnmarshaler is like NewJSONRequestParser but
 // accepts a protobuf jsonpb.Unmarshaler instead of jsonpb.AnyResolver.
 func NewJSONRequestParserWithUnmarshaler(in io.Reader, unmarshaler jsonpb.Unmarshaler) RequestParser {
+	return newJSONRequestParserWithUnmarshaler(in, unmarshaler, false)
+}
+
+func newJSONRequestParserWithUnmarshaler(in io.Reader, unmarshaler jsonpb.Unmarshaler, bytesFromFiles bool) *jsonRequestParser {
+	br := bufio.NewReader(in)
 	return &jsonRequestParser{
-		dec:         json.NewDecoder(in),
-		unmarshaler: unmarshaler,
+		in:             br,
+		dec:            json.NewDecoder(br),
+		unmarshaler:    unmarshaler,
+		bytesFromFiles: bytesFromFiles,
 	}
 }
 
 func (f *jsonRequestParser) Next(m proto.Message) error {
+	if !f.started {
+		f.started = true
+		if f.startsWithArray() && !jsonArrayIsMessage(m) {
+			if _, err := f.dec.Token(); err != nil {
+				return err
+			}
+			f.inArray = true
+		}
+	}
+	if f.inArray && !f.dec.More() {
+		// consume the closing bracket, so that a malformed array is reported
+		if _, err := f.dec.Token(); err != nil {
+			return err
+		}
+		f.inArray = false
+		return io.EOF
+	}
 	var msg json.RawMessage
 	if err := f.dec.Decode(&msg); err != nil {
 		return err
 	}
 	f.requestCount++
+	if f.bytesFromFiles {
+		var err error
+		if msg, err = loadBytesFromFiles(msg, m); err != nil {
+			return err
+		}
+	}
 	return f.unmarshaler.Unmarshal(bytes.NewReader(msg), m)
 }
 
+// loadBytesFromFiles examines the given JSON data, which is the representation
+// of the given message, and replaces the values of bytes fields that are of the
+// form "@path" with the base64-encoded contents of the named file.
+func loadBytesFromFiles(data json.RawMessage, m proto.Message) (json.RawMessage, error) {
+	md, err := desc.LoadMessageDescriptorForMessage(m)
+	if err != nil {
+		return nil, err
+	}
+	dec := json.NewDecoder(bytes.NewReader(data))
+	dec.UseNumber()
+	var val interface{}
+	if err := dec.Decode(&val); err != nil {
+		return nil, err
+	}
+	changed, err := loadBytesFromFilesInMessage(md, val)
+	if err != nil || !changed {
+		return data, err
+	}
+	return json.Marshal(val)
+}
+
+func loadBytesFromFilesInMessage(md *desc.MessageDescriptor, val interface{}) (bool, error) {
+	if md.GetFile().GetPackage() == "google.protobuf" {
+		// well-known types have special JSON representations; the only one
+		// that can contain bytes is handled by loadBytesFromFilesInValue
+		return false, nil
+	}
+	obj, ok := val.(map[string]interface{})
+	if !ok {
+		return false, nil
+	}
+	changed := false
+	for k, v := range obj {
+		fd := md.FindFieldByJSONName(k)
+		if fd == nil {
+			fd = md.FindFieldByName(k)
+		}
+		if fd == nil {
+			continue
+		}
+		if fd.IsMap() {
+			fd = fd.GetMapValueType()
+			entries, ok := v.(map[string]interface{})
+			if !ok {
+				continue
+			}
+			for ek, ev := range entries {
+				newVal, c, err := loadBytesFromFilesInValue(fd, ev)
+				if err != nil {
+					return false, err
+				}
+				entries[ek] = newVal
+				changed = changed || c
+			}
+		} else if fd.IsRepeated() {
+			elements, ok := v.([]interface{})
+			if !ok {
+				continue
+			}
+			for i, ev := range elements {
+				newVal, c, err := loadBytesFromFilesInValue(fd, ev)
+				if err != nil {
+					return false, err
+				}
+				elements[i] = newVal
+				changed = changed || c
+			}
+		} else {
+			newVal, c, err := loadBytesFromFilesInValue(fd, v)
+			if err != nil {
+				return false, err
+			}
+			obj[k] = newVal
+			changed = changed || c
+		}
+	}
+	return changed, nil
+}
+
+func loadBytesFromFilesInValue(fd *desc.FieldDescriptor, val interface{}) (interface{}, bool, error) {
+	isBytes := fd.GetType() == descriptorpb.FieldDescriptorProto_TYPE_BYTES ||
+		(fd.GetMessageType() != nil && fd.GetMessageType().GetFullyQualifiedName() == "google.protobuf.BytesValue")
+	if isBytes {
+		str, ok := val.(string)
+		if !ok || !strings.HasPrefix(str, "@") {
+			return val, false, nil
+		}
+		contents, err := os.ReadFile(str[1:])
+		if err != nil {
+			return nil, false, fmt.Errorf("could not load value for bytes field %s: %v", fd.GetFullyQualifiedName(), err)
+		}
+		return base64.StdEncoding.EncodeToString(contents), true, nil
+	}
+	if fd.GetMessageType() != nil {
+		changed, err := loadBytesFromFilesInMessage(fd.GetMessageType(), val)
+		return val, changed, err
+	}
+	return val, false, nil
+}
+
+// jsonArrayIsMessage returns true if a JSON array is a valid encoding of a
+// single message of the given type.
+func jsonArrayIsMessage(m proto.Message) bool {
+	switch proto.MessageName(m) {
+	case "google.protobuf.ListValue", "google.protobuf.Value":
+		return true
+	default:
+		return false
+	}
+}
+
+// startsWithArray returns true if the first non-whitespace character of the
+// input is '['. It must be called before anything is read by the decoder.
+func (f *jsonRequestParser) startsWithArray() bool {
+	for {
+		b, err := f.in.Peek(1)
+		if err != nil {
+			return false
+		}
+		switch b[0] {
+		case ' ', '\t', '\r', '\n':
+			_, _ = f.in.ReadByte()
+		case '[':
+			return true
+		default:
+			return false
+		}
+	}
+}
+
 func (f *jsonRequestParser) NumRequests() int {
 	return f.requestCount
 }
@@ -126,6 +304,101 @@ func (f *textRequestParser) NumRequests() int {
 	return f.requestCount
 }
 
+type yamlRequestParser struct {
+	dec            *yaml.Decoder
+	unmarshaler    jsonpb.Unmarshaler
+	bytesFromFiles bool
+	requestCount   int
+}
+
+// NewYAMLRequestParser returns a RequestParser that reads data in YAML format
+// from the given reader. Each YAML document is converted to JSON and then
+// parsed like the input of NewJSONRequestParser, so it must have the same
+// structure as the message's JSON form. The given resolver is used to assist
+// with decoding of google.protobuf.Any messages.
+//
+// Input data that contains more than one message should separate them with
+// YAML document markers ("---"). An empty document represents an empty
+// message. If the given reader has no data, the returned parser will return
+// io.EOF on the very first call.
+func NewYAMLRequestParser(in io.Reader, resolver jsonpb.AnyResolver) RequestParser {
+	return newYAMLRequestParser(in, jsonpb.Unmarshaler{AnyResolver: resolver}, false)
+}
+
+func newYAMLRequestParser(in io.Reader, unmarshaler jsonpb.Unmarshaler, bytesFromFiles bool) *yamlRequestParser {
+	return &yamlRequestParser{
+		dec:            yaml.NewDecoder(in),
+		unmarshaler:    unmarshaler,
+		bytesFromFiles: bytesFromFiles,
+	}
+}
+
+func (f *yamlRequestParser) Next(m proto.Message) error {
+	var doc interface{}
+	if err := f.dec.Decode(&doc); err != nil {
+		return err
+	}
+	f.requestCount++
+	if doc == nil {
+		// empty document, so leave the message empty
+		return nil
+	}
+	msg, err := json.Marshal(yamlToJSONValue(doc))
+	if err != nil {
+		return fmt.Errorf("could not convert YAML to JSON: %v", err)
+	}
+	if f.bytesFromFiles {
+		if msg, err = loadBytesFromFiles(msg, m); err != nil {
+			return err
+		}
+	}
+	return f.unmarshaler.Unmarshal(bytes.NewReader(msg), m)
+}
+
+// yamlToJSONValue converts a value decoded from YAML into one that can be
+// encoded as JSON: map keys, which YAML allows to be of any type, become
+// strings (as they are in the JSON form of proto maps), timestamps become
+// RFC 3339 strings, and non-finite floats become the strings used for them
+// in the JSON form of protos.
+func yamlToJSONValue(v interface{}) interface{} {
+	switch v := v.(type) {
+	case map[string]interface{}:
+		for k, val := range v {
+			v[k] = yamlToJSONValue(val)
+		}
+		return v
+	case map[interface{}]interface{}:
+		m := make(map[string]interface{}, len(v))
+		for k, val := range v {
+			m[fmt.Sprint(k)] = yamlToJSONValue(val)
+		}
+		return m
+	case []interface{}:
+		for i, val := range v {
+			v[i] = yamlToJSONValue(val)
+		}
+		return v
+	case time.Time:
+		return v.Format(time.RFC3339Nano)
+	case float64:
+		switch {
+		case math.IsInf(v, 1):
+			return "Infinity"
+		case math.IsInf(v, -1):
+			return "-Infinity"
+		case math.IsNaN(v):
+			return "NaN"
+		}
+		return v
+	default:
+		return v
+	}
+}
+
+func (f *yamlRequestParser) NumRequests() int {
+	return f.requestCount
+}
+
 // Formatter translates messages into string representations.
 type Formatter func(proto.Message) (string, error)
 
@@ -134,8 +407,13 @@ type Formatter func(proto.Message) (string, error)
 // is true. The given resolver is used to assist with encoding of
 // google.protobuf.Any messages.
 func NewJSONFormatter(emitDefaults bool, resolver jsonpb.AnyResolver) Formatter {
+	return newJSONFormatter(emitDefaults, false, false, resolver)
+}
+
+func newJSONFormatter(emitDefaults, origName, compact bool, resolver jsonpb.AnyResolver) Formatter {
 	marshaler := jsonpb.Marshaler{
 		EmitDefaults: emitDefaults,
+		OrigName:     origName,
 		AnyResolver:  resolver,
 	}
 	// Workaround for indentation issue in jsonpb with Any messages.
@@ -148,6 +426,10 @@ func NewJSONFormatter(emitDefaults bool, resolver jsonpb.AnyResolver) Formatter
 		if err != nil {
 			return "", err
 		}
+		if compact {
+			// without an indent, the marshaler emits a single line
+			return output, nil
+		}
 		var buf bytes.Buffer
 		if err := json.Indent(&buf, []byte(output), "", "  "); err != nil {
 			return "", err
@@ -157,6 +439,412 @@ func NewJSONFormatter(emitDefaults bool, resolver jsonpb.AnyResolver) Formatter
 	return formatter
 }
 
+// NewYAMLFormatter returns a formatter that returns YAML strings, with the
+// same structure and values as the JSON returned by NewJSONFormatter. The
+// YAML will include empty/default values if emitDefaults is true. The given
+// resolver is used to assist with encoding of google.protobuf.Any messages.
+//
+// When invoked to format multiple messages, all messages after the first one
+// are prefixed with a YAML document marker ("---"), so that the output is a
+// stream of YAML documents that can be parsed with NewYAMLRequestParser.
+func NewYAMLFormatter(emitDefaults bool, resolver jsonpb.AnyResolver) Formatter {
+	return newYAMLFormatter(emitDefaults, false, resolver)
+}
+
+func newYAMLFormatter(emitDefaults, origName bool, resolver jsonpb.AnyResolver) Formatter {
+	jsonFormatter := newJSONFormatter(emitDefaults, origName, true, resolver)
+	numFormatted := 0
+	return func(m proto.Message) (string, error) {
+		str, err := jsonFormatter(m)
+		if err != nil {
+			return "", err
+		}
+		// JSON is YAML, so it can be parsed into a YAML node, which keeps the
+		// order of the fields, and then re-encoded in block style
+		var node yaml.Node
+		if err := yaml.Unmarshal([]byte(str), &node); err != nil {
+			return "", err
+		}
+		clearYAMLStyle(&node)
+		var buf bytes.Buffer
+		if numFormatted > 0 {
+			buf.WriteString("---\n")
+		}
+		enc := yaml.NewEncoder(&buf)
+		enc.SetIndent(2)
+		if err := enc.Encode(&node); err != nil {
+			return "", err
+		}
+		if err := enc.Close(); err != nil {
+			return "", err
+		}
+		numFormatted++
+		return strings.TrimSuffix(buf.String(), "\n"), nil
+	}
+}
+
+// clearYAMLStyle resets the style of the given node and its descendants, so
+// that they are encoded in the default block style. Strings that would
+// otherwise be parsed as another type, like "true" or "123", are still quoted.
+func clearYAMLStyle(node *yaml.Node) {
+	node.Style = 0
+	for _, n := range node.Content {
+		clearYAMLStyle(n)
+	}
+}
+
+// NewFlatFormatter returns a formatter that flattens messages into lines of
+// "path=value" pairs, one per scalar value in the message. String values are
+// quoted, bytes values are base64-encoded, and enum values are shown by name.
+// Nested messages with no fields set are shown as "path={}". Unset fields are
+// omitted unless emitDefaults is true.
+func NewFlatFormatter(emitDefaults bool) Formatter {
+	return func(m proto.Message) (string, error) {
+		dm, err := dynamic.AsDynamicMessage(m)
+		if err != nil {
+			return "", err
+		}
+		var lines []string
+		flattenMessage(dm, "", emitDefaults, &lines)
+		return strings.Join(lines, "\n"), nil
+	}
+}
+
+func flattenMessage(dm *dynamic.Message, prefix string, emitDefaults bool, lines *[]string) {
+	start := len(*lines)
+	for _, fd := range dm.GetMessageDescriptor().GetFields() {
+		if !emitDefaults && !dm.HasField(fd) {
+			continue
+		}
+		path := fd.GetName()
+		if prefix != "" {
+			path = prefix + "." + path
+		}
+		val := dm.GetField(fd)
+		switch {
+		case fd.IsMap():
+			m := val.(map[interface{}]interface{})
+			keys := make([]string, 0, len(m))
+			vals := make(map[string]interface{}, len(m))
+			for k, v := range m {
+				ks := fmt.Sprintf("%v", k)
+				keys = append(keys, ks)
+				vals[ks] = v
+			}
+			sort.Strings(keys)
+			for _, k := range keys {
+				flattenValue(fd.GetMapValueType(), vals[k], fmt.Sprintf("%s[%s]", path, k), emitDefaults, lines)
+			}
+		case fd.IsRepeated():
+			for i, v := range val.([]interface{}) {
+				flattenValue(fd, v, fmt.Sprintf("%s[%d]", path, i), emitDefaults, lines)
+			}
+		default:
+			flattenValue(fd, val, path, emitDefaults, lines)
+		}
+	}
+	if len(*lines) == start && prefix != "" {
+		*lines = append(*lines, prefix+"={}")
+	}
+}
+
+func flattenValue(fd *desc.FieldDescriptor, val interface{}, path string, emitDefaults bool, lines *[]string) {
+	if fd.GetMessageType() != nil {
+		msg, _ := val.(proto.Message)
+		if msg == nil || reflect.ValueOf(msg).IsNil() {
+			// unset message field, only present when emitting defaults; its
+			// fields are not expanded, since a recursive type never ends
+			*lines = append(*lines, path+"={}")
+			return
+		}
+		dm, err := dynamic.AsDynamicMessage(msg)
+		if err != nil {
+			*lines = append(*lines, fmt.Sprintf("%s=<error: %v>", path, err))
+			return
+		}
+		flattenMessage(dm, path, emitDefaults, lines)
+		return
+	}
+	var str string
+	switch v := val.(type) {
+	case string:
+		str = strconv.Quote(v)
+	case []byte:
+		str = base64.StdEncoding.EncodeToString(v)
+	case int32:
+		if ed := fd.GetEnumType(); ed != nil {
+			if evd := ed.FindValueByNumber(v); evd != nil {
+				str = evd.GetName()
+				break
+			}
+		}
+		str = strconv.FormatInt(int64(v), 10)
+	default:
+		str = fmt.Sprintf("%v", v)
+	}
+	*lines = append(*lines, path+"="+str)
+}
+
+// NewFieldExtractor returns a formatter that, instead of formatting the whole
+// message, formats just the value at the given field path. The path is a
+// dot-separated list of field names (either the proto or JSON names may be
+// used). A repeated field in the path may be followed by an index in brackets,
+// such as "items[0]", and a map field may be followed by a key in brackets,
+// such as "labels[env]". Scalar values are formatted raw: strings without
+// quotes, bytes as base64, and enums by name. Message values are formatted
+// using the given formatter. If the path refers to a repeated or map field
+// without an index or key, each element is formatted on its own line, with
+// map elements in "key=value" form.
+//
+// If a message along the path is not present, or an index or key does not
+// exist, the returned formatter returns an error unless optional is true, in
+// which case it returns an empty string. An error is returned immediately if
+// the given path is not syntactically valid.
+func NewFieldExtractor(path string, optional bool, formatter Formatter) (Formatter, error) {
+	segments, err := parseFieldPath(path)
+	if err != nil {
+		return nil, err
+	}
+	return func(m proto.Message) (string, error) {
+		str, err := extractField(m, segments, formatter)
+		if err == errFieldNotPresent {
+			if optional {
+				return "", nil
+			}
+			return "", fmt.Errorf("field path %q is not present in message", path)
+		}
+		return str, err
+	}, nil
+}
+
+type fieldPathSegment struct {
+	name    string
+	indexes []string
+}
+
+var errFieldNotPresent = errors.New("field not present")
+
+func parseFieldPath(path string) ([]fieldPathSegment, error) {
+	if path == "" {
+		return nil, errors.New("field path is empty")
+	}
+	var segments []fieldPathSegment
+	for _, part := range strings.Split(path, ".") {
+		seg := fieldPathSegment{name: part}
+		if pos := strings.IndexByte(part, '['); pos >= 0 {
+			seg.name = part[:pos]
+			rest := part[pos:]
+			for rest != "" {
+				end := strings.IndexByte(rest, ']')
+				if rest[0] != '[' || end < 0 {
+					return nil, fmt.Errorf("field path %q has malformed index in %q", path, part)
+				}
+				seg.indexes = append(seg.indexes, rest[1:end])
+				rest = rest[end+1:]
+			}
+		}
+		if seg.name == "" {
+			return nil, fmt.Errorf("field path %q has an empty field name", path)
+		}
+		segments = append(segments, seg)
+	}
+	return segments, nil
+}
+
+func extractField(m proto.Message, segments []fieldPathSegment, formatter Formatter) (string, error) {
+	var fd *desc.FieldDescriptor
+	var val interface{}
+	// element is true when val is a single element of a repeated or map field
+	var element bool
+	for i, seg := range segments {
+		if i > 0 {
+			var ok bool
+			m, ok = val.(proto.Message)
+			if !ok || (fd.IsRepeated() && !element) {
+				return "", fmt.Errorf("cannot get field %q of non-message value", seg.name)
+			}
+		}
+		dm, err := dynamic.AsDynamicMessage(m)
+		if err != nil {
+			return "", err
+		}
+		md := dm.GetMessageDescriptor()
+		fd = md.FindFieldByName(seg.name)
+		if fd == nil {
+			fd = md.FindFieldByJSONName(seg.name)
+		}
+		if fd == nil {
+			return "", fmt.Errorf("message %s has no field named %q", md.GetFullyQualifiedName(), seg.name)
+		}
+		if fd.GetMessageType() != nil && !fd.IsRepeated() && !dm.HasField(fd) {
+			return "", errFieldNotPresent
+		}
+		val = dm.GetField(fd)
+		element = false
+		for _, idx := range seg.indexes {
+			if element {
+				return "", fmt.Errorf("field %s cannot be indexed more than once", fd.GetFullyQualifiedName())
+			}
+			if fd.IsMap() {
+				key, err := parseMapKey(fd.GetMapKeyType(), idx)
+				if err != nil {
+					return "", err
+				}
+				v, ok := val.(map[interface{}]interface{})[key]
+				if !ok {
+					return "", errFieldNotPresent
+				}
+				val, fd = v, fd.GetMapValueType()
+			} else if fd.IsRepeated() {
+				n, err := strconv.Atoi(idx)
+				if err != nil {
+					return "", fmt.Errorf("invalid index %q for repeated field %s", idx, fd.GetFullyQualifiedName())
+				}
+				elements := val.([]interface{})
+				if n < 0 || n >= len(elements) {
+					return "", errFieldNotPresent
+				}
+				val = elements[n]
+				element = true
+			} else {
+				return "", fmt.Errorf("field %s is not a repeated or map field", fd.GetFullyQualifiedName())
+			}
+		}
+	}
+	return formatExtractedValue(fd, val, element, formatter)
+}
+
+func parseMapKey(fd *desc.FieldDescriptor, s string) (interface{}, error) {
+	var key interface{}
+	var err error
+	switch fd.GetType() {
+	case descriptorpb.FieldDescriptorProto_TYPE_STRING:
+		key = s
+	case descriptorpb.FieldDescriptorProto_TYPE_BOOL:
+		key, err = strconv.ParseBool(s)
+	case descriptorpb.FieldDescriptorProto_TYPE_INT32,
+		descriptorpb.FieldDescriptorProto_TYPE_SINT32,
+		descriptorpb.FieldDescriptorProto_TYPE_SFIXED32:
+		var v int64
+		v, err = strconv.ParseInt(s, 10, 32)
+		key = int32(v)
+	case descriptorpb.FieldDescriptorProto_TYPE_INT64,
+		descriptorpb.FieldDescriptorProto_TYPE_SINT64,
+		descriptorpb.FieldDescriptorProto_TYPE_SFIXED64:
+		key, err = strconv.ParseInt(s, 10, 64)
+	case descriptorpb.FieldDescriptorProto_TYPE_UINT32,
+		descriptorpb.FieldDescriptorProto_TYPE_FIXED32:
+		var v uint64
+		v, err = strconv.ParseUint(s, 10, 32)
+		key = uint32(v)
+	case descriptorpb.FieldDescriptorProto_TYPE_UINT64,
+		descriptorpb.FieldDescriptorProto_TYPE_FIXED64:
+		key, err = strconv.ParseUint(s, 10, 64)
+	default:
+		return nil, fmt.Errorf("unsupported map key type %v", fd.GetType())
+	}
+	if err != nil {
+		return nil, fmt.Errorf("invalid key %q for map field: %v", s, err)
+	}
+	return key, nil
+}
+
+func formatExtractedValue(fd *desc.FieldDescriptor, val interface{}, element bool, formatter Formatter) (string, error) {
+	switch {
+	case element:
+		// formatted as single value below
+	case fd.IsMap():
+		m := val.(map[interface{}]interface{})
+		lines := make([]string, 0, len(m))
+		for k, v := range m {
+			str, err := formatExtractedValue(fd.GetMapValueType(), v, false, formatter)
+			if err != nil {
+				return "", err
+			}
+			lines = append(lines, fmt.Sprintf("%v=%s", k, str))
+		}
+		sort.Strings(lines)
+		return strings.Join(lines, "\n"), nil
+	case fd.IsRepeated():
+		elements := val.([]interface{})
+		lines := make([]string, len(elements))
+		for i, v := range elements {
+			str, err := formatExtractedValue(fd, v, true, formatter)
+			if err != nil {
+				return "", err
+			}
+			lines[i] = str
+		}
+		return strings.Join(lines, "\n"), nil
+	}
+	switch v := val.(type) {
+	case proto.Message:
+		return formatter(v)
+	case string:
+		return v, nil
+	case []byte:
+		return base64.StdEncoding.EncodeToString(v), nil
+	case int32:
+		if ed := fd.GetEnumType(); ed != nil {
+			if evd := ed.FindValueByNumber(v); evd != nil {
+				return evd.GetName(), nil
+			}
+		}
+		return strconv.FormatInt(int64(v), 10), nil
+	default:
+		return fmt.Sprintf("%v", v), nil
+	}
+}
+
+// NewTemplateFormatter returns a formatter that executes the given Go
+// template (see package text/template) for each message. The template is
+// applied to a map[string]interface{} holding the message's fields, keyed by
+// the names used in the proto source (such as "account_number"), so a
+// template like '{{.account_number}}: {{.balance_cents}}' prints two fields.
+// All fields are present in the map: unset fields have their default value,
+// except for fields with explicit presence (such as proto2 optional fields),
+// which are nil.
+// Nested messages are maps, repeated fields are slices, and other values use
+// their JSON representation. The given resolver is used to assist with
+// encoding of google.protobuf.Any messages.
+//
+// An error is returned immediately if the template cannot be parsed. If the
+// template refers to a field that does not exist, the returned formatter
+// returns an error that lists the available field names.
+func NewTemplateFormatter(tmpl string, resolver jsonpb.AnyResolver) (Formatter, error) {
+	t, err := template.New("response").Option("missingkey=error").Parse(tmpl)
+	if err != nil {
+		return nil, err
+	}
+	marshaler := jsonpb.Marshaler{
+		OrigName:     true,
+		EmitDefaults: true,
+		AnyResolver:  resolver,
+	}
+	return func(m proto.Message) (string, error) {
+		js, err := marshaler.MarshalToString(m)
+		if err != nil {
+			return "", err
+		}
+		dec := json.NewDecoder(strings.NewReader(js))
+		dec.UseNumber()
+		var fields map[string]interface{}
+		if err := dec.Decode(&fields); err != nil {
+			return "", err
+		}
+		var buf bytes.Buffer
+		if err := t.Execute(&buf, fields); err != nil {
+			names := make([]string, 0, len(fields))
+			for k := range fields {
+				names = append(names, k)
+			}
+			sort.Strings(names)
+			return "", fmt.Errorf("%v (available fields: %s)", err, strings.Join(names, ", "))
+		}
+		return buf.String(), nil
+	}, nil
+}
+
 // NewTextFormatter returns a formatter that returns strings in the protobuf
 // text format. If includeSeparator is true then, when invoked to format
 // multiple messages, all messages after the first one will be prefixed with the
@@ -212,7 +900,8 @@ func (tf *textFormatter) format(m proto.Message) (string, error) {
 	return str, nil
 }
 
-// Format of request data. The allowed values are 'json' or 'text'.
+// Format of request data. The allowed values are 'json', 'text', 'flat', or
+// 'yaml'.
 type Format string
 
 const (
@@ -227,6 +916,18 @@ const (
 	// If it does, it will be interpreted as a final, blank message after the
 	// separator.
 	FormatText = Format("text")
+
+	// FormatFlat specifies that response data is flattened into one line per
+	// scalar value, in "path=value" form, where path is the dotted path of
+	// field names leading to the value. Elements of repeated fields include
+	// their index in the path and map entries include their key, in brackets.
+	// Input data for this format is JSON, as with FormatJSON.
+	FormatFlat = Format("flat")
+
+	// FormatYAML specifies input data in YAML format, with the same structure
+	// as FormatJSON. Multiple request values must be separate YAML documents,
+	// separated by a "---" line. Response data is printed in YAML, too.
+	FormatYAML = Format("yaml")
 )
 
 // AnyResolverFromDescriptorSource returns an AnyResolver that will search for
@@ -380,15 +1081,36 @@ var _ proto.Message = (*unknownAny)(nil)
 // FormatOptions is a set of flags that are passed to a JSON or text formatter.
 type FormatOptions struct {
 	// EmitJSONDefaultFields flag, when true, includes empty/default values in the output.
-	// FormatJSON only flag.
+	// FormatJSON, FormatFlat, and FormatYAML only flag.
 	EmitJSONDefaultFields bool
 
+	// OrigName flag, when true, uses the original field names from the proto
+	// source as the keys in JSON output, instead of their lowerCamelCase JSON
+	// names. Request data may use either form, regardless of this flag.
+	// FormatJSON and FormatYAML only flag.
+	OrigName bool
+
+	// CompactJSON flag, when true, formats each message as JSON on a single
+	// line, with no indentation. Since DefaultEventHandler prints each
+	// response on its own line, the output of a streaming call is then
+	// newline-delimited JSON (NDJSON), suitable for tools like 'jq -c'.
+	// FormatJSON only flag.
+	CompactJSON bool
+
 	// AllowUnknownFields is an option for the parser. When true,
 	// it accepts input which includes unknown fields. These unknown fields
 	// are skipped instead of returning an error.
-	// FormatJSON only flag.
+	// FormatJSON and FormatYAML only flag.
 	AllowUnknownFields bool
 
+	// AllowBytesFromFiles is an option for the parser. When true, the value
+	// for a bytes field (or a google.protobuf.BytesValue field) may be given
+	// as a string in the form "@path", in which case the raw contents of the
+	// named file are used as the field's value. Since base64-encoded values
+	// never contain '@', no escaping is needed for ordinary values.
+	// FormatJSON and FormatYAML only flag.
+	AllowBytesFromFiles bool
+
 	// IncludeTextSeparator is true then, when invoked to format multiple messages,
 	// all messages after the first one will be prefixed with the
 	// ASCII 'Record Separator' character (0x1E).
@@ -408,15 +1130,26 @@ func RequestParserAndFormatter(format Format, descSource DescriptorSource, in io
 	switch format {
 	case FormatJSON:
 		resolver := AnyResolverFromDescriptorSource(descSource)
-		unmarshaler := jsonpb.Unmarshaler{AnyResolver: resolver, AllowUnknownFields: opts.AllowUnknownFields}
-		return NewJSONRequestParserWithUnmarshaler(in, unmarshaler), NewJSONFormatter(opts.EmitJSONDefaultFields, anyResolverWithFallback{AnyResolver: resolver}), nil
+		return newJSONRequestParser(in, resolver, opts), newJSONFormatter(opts.EmitJSONDefaultFields, opts.OrigName, opts.CompactJSON, anyResolverWithFallback{AnyResolver: resolver}), nil
 	case FormatText:
 		return NewTextRequestParser(in), NewTextFormatter(opts.IncludeTextSeparator), nil
+	case FormatFlat:
+		resolver := AnyResolverFromDescriptorSource(descSource)
+		return newJSONRequestParser(in, resolver, opts), NewFlatFormatter(opts.EmitJSONDefaultFields), nil
+	case FormatYAML:
+		resolver := AnyResolverFromDescriptorSource(descSource)
+		unmarshaler := jsonpb.Unmarshaler{AnyResolver: resolver, AllowUnknownFields: opts.AllowUnknownFields}
+		return newYAMLRequestParser(in, unmarshaler, opts.AllowBytesFromFiles), newYAMLFormatter(opts.EmitJSONDefaultFields, opts.OrigName, anyResolverWithFallback{AnyResolver: resolver}), nil
 	default:
 		return nil, nil, fmt.Errorf("unknown format: %s", format)
 	}
 }
 
+func newJSONRequestParser(in io.Reader, resolver jsonpb.AnyResolver, opts FormatOptions) RequestParser {
+	unmarshaler := jsonpb.Unmarshaler{AnyResolver: resolver, AllowUnknownFields: opts.AllowUnknownFields}
+	return newJSONRequestParserWithUnmarshaler(in, unmarshaler, opts.AllowBytesFromFiles)
+}
+
 // RequestParserAndFormatterFor returns a request parser and formatter for the
 // given format. The given descriptor source may be used for parsing message
 // data (if needed by the format). The flags emitJSONDefaultFields and
@@ -439,14 +1172,44 @@ type DefaultEventHandler struct {
 	Formatter Formatter
 	// 0 = default
 	// 1 = verbose
-	// 2 = very verbose
+	// 2 = very verbose: also shows the serialized size of each response
+	//     and the time elapsed between sending the request and receiving it
 	VerbosityLevel int
+	// If true, metadata printed in verbose mode is formatted as a JSON object
+	// (see MetadataToJSON) instead of as 'key: value' lines.
+	MetadataAsJSON bool
+	// If non-nil, each metadata value printed in verbose mode is replaced
+	// with the result of calling this function with its key and value, so
+	// that secrets can be kept out of logs. Values of binary headers are
+	// base64-encoded before they are passed to it. See RedactMetadata.
+	MetadataRedactor func(key, val string) string
+	// If true, each response message is preceded by a line with the time it
+	// was received and the time elapsed since the request headers were sent.
+	ReceiveTimestamps bool
+	// If true, the detail messages of a non-OK status, such as
+	// google.rpc.BadRequest or google.rpc.ErrorInfo, are printed using the
+	// Formatter when trailers are received, regardless of VerbosityLevel.
+	// Callers that print the whole status afterwards, with PrintStatus,
+	// should leave this false to avoid printing the details twice.
+	PrintStatusDetails bool
+	// If non-nil, the fields of each response message that are not selected
+	// by the mask are cleared before it is printed.
+	ResponseFieldMask *FieldMask
+	// If non-nil, formatted response messages are written to it instead of
+	// to Out, such as to pipe them through another program. All other
+	// output, including errors formatting responses, is still written to
+	// Out, but without the "Response contents:" heading in verbose mode.
+	ResponseOut io.Writer
 
 	// NumResponses is the number of responses that have been received.
 	NumResponses int
 	// Status is the status that was received at the end of an RPC. It is
 	// nil if the RPC is still in progress.
 	Status *status.Status
+
+	start time.Time
+	// if non-nil, used instead of time.Now, for testing
+	now func() time.Time
 }
 
 // NewDefaultEventHandler returns an InvocationEventHandler that logs events to
@@ -480,28 +1243,58 @@ func (h *DefaultEventHandler) OnResolveMethod(md *desc.MethodDescriptor) {
 	}
 }
 
+func (h *DefaultEventHandler) metadataString(md metadata.MD) string {
+	if h.MetadataAsJSON {
+		return metadataToJSON(md, h.MetadataRedactor)
+	}
+	return metadataToString(md, h.MetadataRedactor)
+}
+
+func (h *DefaultEventHandler) currentTime() time.Time {
+	if h.now != nil {
+		return h.now()
+	}
+	return time.Now()
+}
+
 func (h *DefaultEventHandler) OnSendHeaders(md metadata.MD) {
+	h.start = h.currentTime()
 	if h.VerbosityLevel > 0 {
-		fmt.Fprintf(h.Out, "\nRequest metadata to send:\n%s\n", MetadataToString(md))
+		fmt.Fprintf(h.Out, "\nRequest metadata to send:\n%s\n", h.metadataString(md))
 	}
 }
 
 func (h *DefaultEventHandler) OnReceiveHeaders(md metadata.MD) {
 	if h.VerbosityLevel > 0 {
-		fmt.Fprintf(h.Out, "\nResponse headers received:\n%s\n", MetadataToString(md))
+		fmt.Fprintf(h.Out, "\nResponse headers received:\n%s\n", h.metadataString(md))
 	}
 }
 
 func (h *DefaultEventHandler) OnReceiveResponse(resp proto.Message) {
 	h.NumResponses++
+	now := h.currentTime()
+	if h.ReceiveTimestamps {
+		fmt.Fprintf(h.Out, "Response %d received at %s (+%v)\n", h.NumResponses, now.Format(time.RFC3339Nano), now.Sub(h.start).Round(time.Microsecond))
+	}
 	if h.VerbosityLevel > 1 {
 		fmt.Fprintf(h.Out, "\nEstimated response size: %d bytes\n", proto.Size(resp))
+		if !h.start.IsZero() {
+			fmt.Fprintf(h.Out, "Elapsed time since request was sent: %v\n", now.Sub(h.start).Round(time.Microsecond))
+		}
 	}
-	if h.VerbosityLevel > 0 {
+	if h.VerbosityLevel > 0 && h.ResponseOut == nil {
 		fmt.Fprint(h.Out, "\nResponse contents:\n")
 	}
+	if h.ResponseFieldMask != nil {
+		if err := h.ResponseFieldMask.Apply(resp); err != nil {
+			fmt.Fprintf(h.Out, "Failed to apply field mask to response message %d: %v\n", h.NumResponses, err)
+			return
+		}
+	}
 	if respStr, err := h.Formatter(resp); err != nil {
 		fmt.Fprintf(h.Out, "Failed to format response message %d: %v\n", h.NumResponses, err)
+	} else if h.ResponseOut != nil {
+		fmt.Fprintln(h.ResponseOut, respStr)
 	} else {
 		fmt.Fprintln(h.Out, respStr)
 	}
@@ -510,7 +1303,13 @@ func (h *DefaultEventHandler) OnReceiveResponse(resp proto.Message) {
 func (h *DefaultEventHandler) OnReceiveTrailers(stat *status.Status, md metadata.MD) {
 	h.Status = stat
 	if h.VerbosityLevel > 0 {
-		fmt.Fprintf(h.Out, "\nResponse trailers received:\n%s\n", MetadataToString(md))
+		fmt.Fprintf(h.Out, "\nResponse trailers received:\n%s\n", h.metadataString(md))
+	}
+	if h.PrintStatusDetails && stat.Code() != codes.OK {
+		if statpb := stat.Proto(); len(statpb.Details) > 0 {
+			fmt.Fprintf(h.Out, "\nResponse status details:\n")
+			printStatusDetails(h.Out, statpb.Details, h.Formatter)
+		}
 	}
 }
 
@@ -527,26 +1326,31 @@ func PrintStatus(w io.Writer, stat *status.Status, formatter Formatter) {
 	}
 	fmt.Fprintf(w, "ERROR:\n  Code: %s\n  Message: %s\n", stat.Code().String(), stat.Message())
 
-	statpb := stat.Proto()
-	if len(statpb.Details) > 0 {
+	if statpb := stat.Proto(); len(statpb.Details) > 0 {
 		fmt.Fprintf(w, "  Details:\n")
-		for i, det := range statpb.Details {
-			prefix := fmt.Sprintf("  %d)", i+1)
-			fmt.Fprintf(w, "%s\t", prefix)
-			prefix = strings.Repeat(" ", len(prefix)) + "\t"
+		printStatusDetails(w, statpb.Details, formatter)
+	}
+}
 
-			output, err := formatter(det)
-			if err != nil {
-				fmt.Fprintf(w, "Error parsing detail message: %v\n", err)
-			} else {
-				lines := strings.Split(output, "\n")
-				for i, line := range lines {
-					if i == 0 {
-						// first line is already indented
-						fmt.Fprintf(w, "%s\n", line)
-					} else {
-						fmt.Fprintf(w, "%s%s\n", prefix, line)
-					}
+// printStatusDetails prints each of the detail messages in the given status,
+// numbered and indented, using the given formatter.
+func printStatusDetails(w io.Writer, details []*anypb.Any, formatter Formatter) {
+	for i, det := range details {
+		prefix := fmt.Sprintf("  %d)", i+1)
+		fmt.Fprintf(w, "%s\t", prefix)
+		prefix = strings.Repeat(" ", len(prefix)) + "\t"
+
+		output, err := formatter(det)
+		if err != nil {
+			fmt.Fprintf(w, "Error parsing detail message: %v\n", err)
+		} else {
+			lines := strings.Split(output, "\n")
+			for i, line := range lines {
+				if i == 0 {
+					// first line is already indented
+					fmt.Fprintf(w, "%s\n", line)
+				} else {
+					fmt.Fprintf(w, "%s%s\n", prefix, line)
 				}
 			}
 		}
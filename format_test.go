@@ -2,15 +2,23 @@ package grpcurl
 
 import (
 	"bytes"
+	"encoding/json"
 	"fmt"
 	"io"
+	"os"
 	"strings"
 	"testing"
+	"time"
 
 	"github.com/golang/protobuf/jsonpb" //lint:ignore SA1019 we have to import this because it appears in exported API
 	"github.com/golang/protobuf/proto"  //lint:ignore SA1019 we have to import this because it appears in exported API
 	"github.com/jhump/protoreflect/desc"
+	"github.com/jhump/protoreflect/desc/protoparse"
+	"github.com/jhump/protoreflect/dynamic"
+	"google.golang.org/grpc/codes"
 	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/status"
+	"google.golang.org/protobuf/types/descriptorpb"
 	"google.golang.org/protobuf/types/known/structpb"
 )
 
@@ -65,6 +73,26 @@ func TestRequestParser(t *testing.T) {
 			input:          messageAsText + string(textSeparatorChar) + messageAsText + string(textSeparatorChar) + messageAsText,
 			expectedOutput: []proto.Message{msg, msg, msg},
 		},
+		{
+			format: FormatYAML,
+			input:  "",
+		},
+		{
+			format:         FormatYAML,
+			input:          messageAsYAML,
+			expectedOutput: []proto.Message{msg},
+		},
+		{
+			format:         FormatYAML,
+			input:          messageAsYAML + "---\n" + messageAsYAML + "---\n" + messageAsYAML,
+			expectedOutput: []proto.Message{msg, msg, msg},
+		},
+		{
+			// an empty document is an empty message
+			format:         FormatYAML,
+			input:          messageAsYAML + "---\n---\n" + messageAsYAML,
+			expectedOutput: []proto.Message{msg, &structpb.Value{}, msg},
+		},
 	}
 
 	for i, tc := range testCases {
@@ -94,6 +122,192 @@ func TestRequestParser(t *testing.T) {
 	}
 }
 
+func TestJSONFormatterOrigName(t *testing.T) {
+	source, err := DescriptorSourceFromProtoSets("internal/testing/test.protoset")
+	if err != nil {
+		t.Fatalf("failed to create descriptor source: %v", err)
+	}
+	dsc, err := source.FindSymbol("testing.StreamingInputCallResponse")
+	if err != nil {
+		t.Fatalf("failed to find message: %v", err)
+	}
+	md := dsc.(*desc.MessageDescriptor)
+
+	for _, origName := range []bool{false, true} {
+		// either form of field name is accepted on input
+		input := `{"aggregatedPayloadSize": 123} {"aggregated_payload_size": 123}`
+		rf, formatter, err := RequestParserAndFormatter(FormatJSON, source, strings.NewReader(input), FormatOptions{OrigName: origName})
+		if err != nil {
+			t.Fatalf("failed to create parser and formatter: %v", err)
+		}
+		expected := `"aggregatedPayloadSize": 123`
+		if origName {
+			expected = `"aggregated_payload_size": 123`
+		}
+		for i := 0; i < 2; i++ {
+			msg := dynamic.NewMessage(md)
+			if err := rf.Next(msg); err != nil {
+				t.Fatalf("origName=%v, msg %d: failed to parse: %v", origName, i, err)
+			}
+			output, err := formatter(msg)
+			if err != nil {
+				t.Fatalf("origName=%v, msg %d: failed to format: %v", origName, i, err)
+			}
+			if !strings.Contains(output, expected) {
+				t.Errorf("origName=%v, msg %d: expecting output to contain %s, got:\n%s", origName, i, expected, output)
+			}
+		}
+	}
+}
+
+func TestJSONFormatterCompact(t *testing.T) {
+	msg, err := makeProto()
+	if err != nil {
+		t.Fatalf("failed to create message: %v", err)
+	}
+	_, formatter, err := RequestParserAndFormatter(FormatJSON, nil, nil, FormatOptions{CompactJSON: true})
+	if err != nil {
+		t.Fatalf("failed to create formatter: %v", err)
+	}
+	output, err := formatter(msg)
+	if err != nil {
+		t.Fatalf("failed to format: %v", err)
+	}
+	if strings.ContainsAny(output, "\r\n") {
+		t.Errorf("compact output should be a single line, got:\n%s", output)
+	}
+	// same content as the indented form
+	var want, got bytes.Buffer
+	if err := json.Compact(&want, []byte(messageAsJSON)); err != nil {
+		t.Fatalf("failed to compact expected output: %v", err)
+	}
+	if err := json.Compact(&got, []byte(output)); err != nil {
+		t.Fatalf("compact output is not valid JSON: %v", err)
+	}
+	if want.String() != got.String() {
+		t.Errorf("compact output has wrong content; want:\n%s\ngot:\n%s", want.String(), output)
+	}
+}
+
+func TestYAMLFormatter(t *testing.T) {
+	msg, err := makeProto()
+	if err != nil {
+		t.Fatalf("failed to create message: %v", err)
+	}
+	_, formatter, err := RequestParserAndFormatter(FormatYAML, nil, nil, FormatOptions{})
+	if err != nil {
+		t.Fatalf("failed to create formatter: %v", err)
+	}
+	for i, expected := range []string{messageAsYAML, "---\n" + messageAsYAML} {
+		output, err := formatter(msg)
+		if err != nil {
+			t.Fatalf("msg %d: failed to format: %v", i, err)
+		}
+		if output+"\n" != expected {
+			t.Errorf("msg %d: incorrect output;\nexpecting:\n%s\ngot:\n%s", i, expected, output)
+		}
+	}
+}
+
+func TestYAMLRoundTrip(t *testing.T) {
+	source, err := DescriptorSourceFromProtoSets("internal/testing/test.protoset")
+	if err != nil {
+		t.Fatalf("failed to create descriptor source: %v", err)
+	}
+	dsc, err := source.FindSymbol("testing.StreamingOutputCallRequest")
+	if err != nil {
+		t.Fatalf("failed to find message: %v", err)
+	}
+	md := dsc.(*desc.MessageDescriptor)
+	msg := dynamic.NewMessage(md)
+	err = jsonpb.UnmarshalString(`{
+		"responseType": "RANDOM",
+		"responseParameters": [{"size": 10, "intervalUs": 100}, {"size": 20}],
+		"payload": {"body": "AAEC/w=="}
+	}`, msg)
+	if err != nil {
+		t.Fatalf("failed to create message: %v", err)
+	}
+
+	// format each message as a separate document, then parse the stream
+	_, formatter, err := RequestParserAndFormatter(FormatYAML, source, nil, FormatOptions{})
+	if err != nil {
+		t.Fatalf("failed to create formatter: %v", err)
+	}
+	var docs []string
+	for i := 0; i < 2; i++ {
+		output, err := formatter(msg)
+		if err != nil {
+			t.Fatalf("failed to format: %v", err)
+		}
+		docs = append(docs, output)
+	}
+	expected := `responseType: RANDOM
+responseParameters:
+  - size: 10
+    intervalUs: 100
+  - size: 20
+payload:
+  body: AAEC/w==`
+	if docs[0] != expected {
+		t.Errorf("incorrect output;\nexpecting:\n%s\ngot:\n%s", expected, docs[0])
+	}
+
+	rf, _, err := RequestParserAndFormatter(FormatYAML, source, strings.NewReader(strings.Join(docs, "\n")), FormatOptions{})
+	if err != nil {
+		t.Fatalf("failed to create parser: %v", err)
+	}
+	for i := 0; ; i++ {
+		parsed := dynamic.NewMessage(md)
+		err := rf.Next(parsed)
+		if err == io.EOF {
+			if i != 2 {
+				t.Errorf("expecting 2 messages, got %d", i)
+			}
+			break
+		} else if err != nil {
+			t.Fatalf("msg %d: failed to parse: %v", i, err)
+		}
+		if !dynamic.Equal(parsed, msg) {
+			t.Errorf("msg %d: incorrect message;\nexpecting:\n%v\ngot:\n%v", i, msg, parsed)
+		}
+	}
+}
+
+func TestJSONRequestParserArray(t *testing.T) {
+	input := "\n[" + messageAsJSON + ", " + messageAsJSON + "]\n"
+	rp := NewJSONRequestParser(strings.NewReader(input), nil)
+	for i := 0; i < 2; i++ {
+		var req structpb.Struct
+		if err := rp.Next(&req); err != nil {
+			t.Fatalf("msg %d: unexpected error: %v", i, err)
+		}
+		if !req.Fields["baz"].GetBoolValue() {
+			t.Errorf("msg %d: incorrect message: %v", i, &req)
+		}
+	}
+	var req structpb.Struct
+	if err := rp.Next(&req); err != io.EOF {
+		t.Errorf("expecting io.EOF after array, got %v", err)
+	}
+	if rp.NumRequests() != 2 {
+		t.Errorf("parser reported wrong number of requests: expecting 2, got %d", rp.NumRequests())
+	}
+
+	// an array is a single message when the request type is ListValue
+	rp = NewJSONRequestParser(strings.NewReader(`[1, "two"]`), nil)
+	var list structpb.ListValue
+	if err := rp.Next(&list); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if len(list.Values) != 2 {
+		t.Errorf("incorrect list value: %v", &list)
+	}
+	if err := rp.Next(&list); err != io.EOF {
+		t.Errorf("expecting io.EOF, got %v", err)
+	}
+}
+
 // Handler prints response data (and headers/trailers in verbose mode).
 // This verifies that we get the right output in both JSON and proto text modes.
 func TestHandler(t *testing.T) {
@@ -135,10 +349,16 @@ func TestHandler(t *testing.T) {
 				}
 
 				var buf bytes.Buffer
+				clock := time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
 				h := &DefaultEventHandler{
 					Out:            &buf,
 					Formatter:      formatter,
 					VerbosityLevel: verbosityLevel,
+					// each call to now advances the clock by 1.5ms
+					now: func() time.Time {
+						clock = clock.Add(1500 * time.Microsecond)
+						return clock
+					},
 				}
 
 				h.OnResolveMethod(md)
@@ -155,7 +375,7 @@ func TestHandler(t *testing.T) {
 				}
 				for i := 0; i < numMessages; i++ {
 					if verbosityLevel > 1 {
-						expectedOutput += verboseResponseSize
+						expectedOutput += fmt.Sprintf(verboseResponseSize, time.Duration(i+1)*1500*time.Microsecond)
 					}
 					if verbose {
 						expectedOutput += verboseResponseHeader
@@ -238,6 +458,7 @@ c: 3
 `
 	verboseResponseSize = `
 Estimated response size: 100 bytes
+Elapsed time since request was sent: %v
 `
 	verboseResponseHeader = `
 Response contents:
@@ -305,5 +526,286 @@ Response contents:
     >
   >
 >
+`
+	messageAsYAML = `bar:
+  a: 1
+  b: 2
+baz: true
+foo:
+  - abc
+  - def
+  - ghi
+"null": null
 `
 )
+
+func TestHandlerReceiveTimestamps(t *testing.T) {
+	msg, err := makeProto()
+	if err != nil {
+		t.Fatalf("failed to create message: %v", err)
+	}
+	var buf bytes.Buffer
+	h := &DefaultEventHandler{
+		Out:               &buf,
+		Formatter:         NewJSONFormatter(false, nil),
+		ReceiveTimestamps: true,
+	}
+	h.OnSendHeaders(nil)
+	h.OnReceiveResponse(msg)
+	h.OnReceiveResponse(msg)
+	var stamps []string
+	for _, line := range strings.Split(buf.String(), "\n") {
+		if strings.HasPrefix(line, "Response ") {
+			stamps = append(stamps, line)
+		}
+	}
+	if len(stamps) != 2 || !strings.HasPrefix(stamps[0], "Response 1 received at ") || !strings.HasPrefix(stamps[1], "Response 2 received at ") {
+		t.Errorf("wrong timestamp lines in output: %q", buf.String())
+	}
+}
+
+func TestHandlerMetadataRedactor(t *testing.T) {
+	reqHeaders := metadata.Pairs("authorization", "Bearer secret", "foo", "123")
+	respHeaders := metadata.Pairs("token-bin", "\x01\x02", "bar", "abc")
+	for _, asJSON := range []bool{false, true} {
+		var buf bytes.Buffer
+		h := &DefaultEventHandler{
+			Out:              &buf,
+			Formatter:        NewJSONFormatter(false, nil),
+			VerbosityLevel:   1,
+			MetadataAsJSON:   asJSON,
+			MetadataRedactor: RedactMetadata,
+		}
+		h.OnSendHeaders(reqHeaders)
+		h.OnReceiveHeaders(respHeaders)
+		h.OnReceiveTrailers(nil, metadata.Pairs("authorization", "Basic c2VjcmV0"))
+		expected := `
+Request metadata to send:
+authorization: ****
+foo: 123
+
+Response headers received:
+bar: abc
+token-bin: ****
+
+Response trailers received:
+authorization: ****
+`
+		if asJSON {
+			expected = `
+Request metadata to send:
+{"authorization":["****"],"foo":["123"]}
+
+Response headers received:
+{"bar":["abc"],"token-bin":["****"]}
+
+Response trailers received:
+{"authorization":["****"]}
+`
+		}
+		if buf.String() != expected {
+			t.Errorf("wrong output with MetadataAsJSON=%v: expected %q, got %q", asJSON, expected, buf.String())
+		}
+	}
+}
+
+func TestHandlerStatusDetails(t *testing.T) {
+	stat, err := status.New(codes.InvalidArgument, "bad request").WithDetails(structpb.NewStringValue("field foo is required"))
+	if err != nil {
+		t.Fatalf("failed to create status: %v", err)
+	}
+	for _, printDetails := range []bool{false, true} {
+		var buf bytes.Buffer
+		h := &DefaultEventHandler{
+			Out:                &buf,
+			Formatter:          NewJSONFormatter(false, nil),
+			PrintStatusDetails: printDetails,
+		}
+		h.OnReceiveTrailers(stat, nil)
+		expected := ""
+		if printDetails {
+			expected = "\nResponse status details:\n  1)\t{\n    \t  \"@type\": \"type.googleapis.com/google.protobuf.Value\",\n    \t  \"value\": \"field foo is required\"\n    \t}\n"
+		}
+		if buf.String() != expected {
+			t.Errorf("wrong output with PrintStatusDetails=%v: expected %q, got %q", printDetails, expected, buf.String())
+		}
+	}
+}
+
+func TestFlatFormatter(t *testing.T) {
+	msg, err := makeProto()
+	if err != nil {
+		t.Fatalf("failed to create message: %v", err)
+	}
+	out, err := NewFlatFormatter(false)(msg)
+	if err != nil {
+		t.Fatalf("failed to format message: %v", err)
+	}
+	expected := `struct_value.fields[bar].struct_value.fields[a].number_value=1
+struct_value.fields[bar].struct_value.fields[b].number_value=2
+struct_value.fields[baz].bool_value=true
+struct_value.fields[foo].list_value.values[0].string_value="abc"
+struct_value.fields[foo].list_value.values[1].string_value="def"
+struct_value.fields[foo].list_value.values[2].string_value="ghi"
+struct_value.fields[null].null_value=NULL_VALUE`
+	if out != expected {
+		t.Errorf("Incorrect output. Expected:\n%s\nGot:\n%s", expected, out)
+	}
+}
+
+func TestFlatFormatterEmitDefaults(t *testing.T) {
+	fds, err := (&protoparse.Parser{
+		Accessor: protoparse.FileContentsFromMap(map[string]string{
+			"node.proto": `syntax = "proto3"; message Node { string name = 1; Node child = 2; }`,
+		}),
+	}).ParseFiles("node.proto")
+	if err != nil {
+		t.Fatalf("failed to parse proto: %v", err)
+	}
+	md := fds[0].FindMessage("Node")
+	child := dynamic.NewMessage(md)
+	child.SetFieldByName("name", "leaf")
+	msg := dynamic.NewMessage(md)
+	msg.SetFieldByName("child", child)
+
+	// the unset child of a recursive message is not expanded
+	out, err := NewFlatFormatter(true)(msg)
+	if err != nil {
+		t.Fatalf("failed to format message: %v", err)
+	}
+	expected := `name=""
+child.name="leaf"
+child.child={}`
+	if out != expected {
+		t.Errorf("Incorrect output. Expected:\n%s\nGot:\n%s", expected, out)
+	}
+}
+
+func TestFieldExtractor(t *testing.T) {
+	msg, err := makeProto()
+	if err != nil {
+		t.Fatalf("failed to create message: %v", err)
+	}
+	testCases := []struct {
+		path     string
+		expected string
+	}{
+		{path: "struct_value.fields[baz].bool_value", expected: "true"},
+		{path: "structValue.fields[foo].listValue.values[1].stringValue", expected: "def"},
+		{path: "struct_value.fields[null].null_value", expected: "NULL_VALUE"},
+		{path: "struct_value.fields[bar].struct_value", expected: "{\n  \"a\": 1,\n  \"b\": 2\n}"},
+		{path: "struct_value.fields[foo].list_value.values", expected: "\"abc\"\n\"def\"\n\"ghi\""},
+	}
+	for _, tc := range testCases {
+		extractor, err := NewFieldExtractor(tc.path, false, NewJSONFormatter(false, nil))
+		if err != nil {
+			t.Fatalf("failed to create extractor for %q: %v", tc.path, err)
+		}
+		out, err := extractor(msg)
+		if err != nil {
+			t.Errorf("failed to extract %q: %v", tc.path, err)
+		} else if out != tc.expected {
+			t.Errorf("wrong value for %q: expected %q, got %q", tc.path, tc.expected, out)
+		}
+	}
+
+	missing := "struct_value.fields[nope].bool_value"
+	extractor, err := NewFieldExtractor(missing, false, NewJSONFormatter(false, nil))
+	if err != nil {
+		t.Fatalf("failed to create extractor for %q: %v", missing, err)
+	}
+	if _, err := extractor(msg); err == nil {
+		t.Errorf("expected error extracting %q", missing)
+	}
+	extractor, err = NewFieldExtractor(missing, true, NewJSONFormatter(false, nil))
+	if err != nil {
+		t.Fatalf("failed to create extractor for %q: %v", missing, err)
+	}
+	if out, err := extractor(msg); err != nil || out != "" {
+		t.Errorf("expected empty result for optional %q, got %q, %v", missing, out, err)
+	}
+
+	if _, err := NewFieldExtractor("struct_value.fields[foo", false, NewJSONFormatter(false, nil)); err == nil {
+		t.Error("expected error for malformed path")
+	}
+}
+
+func TestTemplateFormatter(t *testing.T) {
+	msg := &descriptorpb.FieldDescriptorProto{
+		Name:     proto.String("foo"),
+		Number:   proto.Int32(3),
+		TypeName: proto.String(".foo.Bar"),
+		Label:    descriptorpb.FieldDescriptorProto_LABEL_REPEATED.Enum(),
+	}
+	formatter, err := NewTemplateFormatter(`{{.name}}={{.number}} {{.type_name}} {{.label}}`, nil)
+	if err != nil {
+		t.Fatalf("failed to create template formatter: %v", err)
+	}
+	out, err := formatter(msg)
+	if err != nil {
+		t.Fatalf("failed to format message: %v", err)
+	}
+	if expected := "foo=3 .foo.Bar LABEL_REPEATED"; out != expected {
+		t.Errorf("wrong output: expected %q, got %q", expected, out)
+	}
+
+	formatter, err = NewTemplateFormatter(`{{.nope}}`, nil)
+	if err != nil {
+		t.Fatalf("failed to create template formatter: %v", err)
+	}
+	if _, err := formatter(msg); err == nil {
+		t.Error("expected error for unknown field")
+	} else if !strings.Contains(err.Error(), "available fields: default_value, extendee, json_name, label, name, number") {
+		t.Errorf("error does not list available fields: %v", err)
+	}
+
+	if _, err := NewTemplateFormatter(`{{.name`, nil); err == nil {
+		t.Error("expected error for malformed template")
+	}
+}
+
+func TestRequestParserBytesFromFiles(t *testing.T) {
+	source, err := DescriptorSourceFromProtoSets("internal/testing/test.protoset")
+	if err != nil {
+		t.Fatalf("failed to create descriptor source: %v", err)
+	}
+	d, err := source.FindSymbol("testing.SimpleRequest")
+	if err != nil {
+		t.Fatalf("failed to find message 'testing.SimpleRequest': %v", err)
+	}
+	md := d.(*desc.MessageDescriptor)
+
+	f, err := os.CreateTemp(t.TempDir(), "payload")
+	if err != nil {
+		t.Fatalf("failed to create temp file: %v", err)
+	}
+	if _, err := f.WriteString("hello, world"); err != nil {
+		t.Fatalf("failed to write temp file: %v", err)
+	}
+	if err := f.Close(); err != nil {
+		t.Fatalf("failed to close temp file: %v", err)
+	}
+
+	input := fmt.Sprintf(`{"payload": {"body": %q}, "fill_username": true}`, "@"+f.Name())
+	rf, _, err := RequestParserAndFormatter(FormatJSON, source, strings.NewReader(input), FormatOptions{AllowBytesFromFiles: true})
+	if err != nil {
+		t.Fatalf("failed to create parser: %v", err)
+	}
+	msg := dynamic.NewMessage(md)
+	if err := rf.Next(msg); err != nil {
+		t.Fatalf("failed to parse request: %v", err)
+	}
+	body := msg.GetFieldByName("payload").(*dynamic.Message).GetFieldByName("body").([]byte)
+	if string(body) != "hello, world" {
+		t.Errorf("wrong contents for bytes field: %q", body)
+	}
+
+	// without the option, the value is treated as (invalid) base64
+	rf, _, err = RequestParserAndFormatter(FormatJSON, source, strings.NewReader(input), FormatOptions{})
+	if err != nil {
+		t.Fatalf("failed to create parser: %v", err)
+	}
+	if err := rf.Next(dynamic.NewMessage(md)); err == nil {
+		t.Error("expecting error parsing request without AllowBytesFromFiles")
+	}
+}
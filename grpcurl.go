@@ -9,16 +9,20 @@ package grpcurl
 import (
 	"bytes"
 	"context"
+	"crypto/sha256"
 	"crypto/tls"
 	"crypto/x509"
 	"encoding/base64"
+	"encoding/json"
 	"errors"
 	"fmt"
+	"math/rand"
 	"net"
 	"os"
 	"regexp"
 	"sort"
 	"strings"
+	"time"
 
 	"github.com/golang/protobuf/proto" //lint:ignore SA1019 we have to import this because it appears in exported API
 	"github.com/jhump/protoreflect/desc"
@@ -33,8 +37,11 @@ import (
 	protov2 "google.golang.org/protobuf/proto"
 	"google.golang.org/protobuf/types/descriptorpb"
 	"google.golang.org/protobuf/types/known/anypb"
+	"google.golang.org/protobuf/types/known/durationpb"
 	"google.golang.org/protobuf/types/known/emptypb"
+	"google.golang.org/protobuf/types/known/fieldmaskpb"
 	"google.golang.org/protobuf/types/known/structpb"
+	"google.golang.org/protobuf/types/known/timestamppb"
 )
 
 // ListServices uses the given descriptor source to return a sorted list of fully-qualified
@@ -71,12 +78,22 @@ func GetAllFiles(source DescriptorSource) ([]*desc.FileDescriptor, error) {
 		if err != nil {
 			firstError = err
 		} else {
+			var ds []desc.Descriptor
+			var errs []error
+			if ss, ok := source.(serverSource); ok {
+				// may resolve the services concurrently
+				ds, errs = ss.findSymbols(svcNames)
+			} else {
+				ds, errs = make([]desc.Descriptor, len(svcNames)), make([]error, len(svcNames))
+				for i, name := range svcNames {
+					ds[i], errs[i] = source.FindSymbol(name)
+				}
+			}
 			allFiles := map[string]*desc.FileDescriptor{}
-			for _, name := range svcNames {
-				d, err := source.FindSymbol(name)
-				if err != nil {
+			for i, d := range ds {
+				if errs[i] != nil {
 					if firstError == nil {
-						firstError = err
+						firstError = errs[i]
 					}
 				} else {
 					addAllFilesToSet(d.GetFile(), allFiles)
@@ -95,6 +112,53 @@ func GetAllFiles(source DescriptorSource) ([]*desc.FileDescriptor, error) {
 	return files, firstError
 }
 
+// ListAllExtensions uses the given descriptor source to find all extensions
+// that it defines. The result is keyed by the fully-qualified name of the
+// extended message type, and the extensions for each type are sorted by field
+// number. For a source backed by server reflection, only extensions defined in
+// files reachable from the exposed services can be found, since reflection
+// provides no way to enumerate all files.
+func ListAllExtensions(source DescriptorSource) (map[string][]*desc.FieldDescriptor, error) {
+	files, err := GetAllFiles(source)
+	if err != nil {
+		return nil, err
+	}
+	exts := map[string][]*desc.FieldDescriptor{}
+	seen := map[string]bool{}
+	for _, fd := range files {
+		for _, ext := range fd.GetExtensions() {
+			addExtension(exts, seen, ext)
+		}
+		for _, md := range fd.GetMessageTypes() {
+			addNestedExtensions(exts, seen, md)
+		}
+	}
+	for _, list := range exts {
+		sort.Slice(list, func(i, j int) bool {
+			return list[i].GetNumber() < list[j].GetNumber()
+		})
+	}
+	return exts, nil
+}
+
+func addNestedExtensions(exts map[string][]*desc.FieldDescriptor, seen map[string]bool, md *desc.MessageDescriptor) {
+	for _, ext := range md.GetNestedExtensions() {
+		addExtension(exts, seen, ext)
+	}
+	for _, nested := range md.GetNestedMessageTypes() {
+		addNestedExtensions(exts, seen, nested)
+	}
+}
+
+func addExtension(exts map[string][]*desc.FieldDescriptor, seen map[string]bool, ext *desc.FieldDescriptor) {
+	if seen[ext.GetFullyQualifiedName()] {
+		return
+	}
+	seen[ext.GetFullyQualifiedName()] = true
+	extendee := ext.GetOwner().GetFullyQualifiedName()
+	exts[extendee] = append(exts[extendee], ext)
+}
+
 type filesByName []*desc.FileDescriptor
 
 func (f filesByName) Len() int {
@@ -219,6 +283,10 @@ func decode(val string) (string, error) {
 // MetadataToString returns a string representation of the given metadata, for
 // displaying to users.
 func MetadataToString(md metadata.MD) string {
+	return metadataToString(md, nil)
+}
+
+func metadataToString(md metadata.MD, redact func(key, val string) string) string {
 	if len(md) == 0 {
 		return "(empty)"
 	}
@@ -241,15 +309,66 @@ func MetadataToString(md metadata.MD) string {
 			}
 			b.WriteString(k)
 			b.WriteString(": ")
-			if strings.HasSuffix(k, "-bin") {
-				v = base64.StdEncoding.EncodeToString([]byte(v))
-			}
-			b.WriteString(v)
+			b.WriteString(metadataValueToString(k, v, redact))
 		}
 	}
 	return b.String()
 }
 
+// MetadataToJSON returns a JSON representation of the given metadata, for
+// machine parsing. The result is an object whose keys are the metadata keys,
+// in sorted order, and whose values are arrays of the values for each key.
+// Like MetadataToString, values for binary headers (keys that end in "-bin")
+// are base64-encoded.
+func MetadataToJSON(md metadata.MD) string {
+	return metadataToJSON(md, nil)
+}
+
+func metadataToJSON(md metadata.MD, redact func(key, val string) string) string {
+	m := make(map[string][]string, len(md))
+	for k, vs := range md {
+		if strings.HasSuffix(k, "-bin") || redact != nil {
+			display := make([]string, len(vs))
+			for i, v := range vs {
+				display[i] = metadataValueToString(k, v, redact)
+			}
+			vs = display
+		} else if vs == nil {
+			vs = []string{}
+		}
+		m[k] = vs
+	}
+	// encoding/json emits map keys in sorted order, and a map of strings
+	// can't fail to marshal
+	b, _ := json.Marshal(m)
+	return string(b)
+}
+
+// metadataValueToString returns the given metadata value as it is displayed:
+// base64-encoded for binary headers and then, if redact is non-nil, passed
+// through it.
+func metadataValueToString(key, val string, redact func(key, val string) string) string {
+	if strings.HasSuffix(key, "-bin") {
+		val = base64.StdEncoding.EncodeToString([]byte(val))
+	}
+	if redact != nil {
+		val = redact(key, val)
+	}
+	return val
+}
+
+// RedactMetadata is a metadata redactor, for use with
+// DefaultEventHandler.MetadataRedactor, that masks the values of the
+// "authorization" header and of binary headers (keys that end in "-bin"),
+// which often carry credentials. Other values are returned unchanged.
+func RedactMetadata(key, val string) string {
+	key = strings.ToLower(key)
+	if key == "authorization" || strings.HasSuffix(key, "-bin") {
+		return "****"
+	}
+	return val
+}
+
 var printer = &protoprint.Printer{
 	Compact:                  true,
 	OmitComments:             protoprint.CommentsNonDoc,
@@ -273,6 +392,19 @@ func GetDescriptorText(dsc desc.Descriptor, _ DescriptorSource) (string, error)
 	return txt, nil
 }
 
+// GetFileText returns the proto source of the entire file that defines the
+// given symbol, including its imports and comments (if the descriptor source
+// includes source code info). Unlike GetDescriptorText, which shows a single
+// element, this shows the element in the context of its file.
+func GetFileText(descSource DescriptorSource, symbol string) (string, error) {
+	dsc, err := descSource.FindSymbol(symbol)
+	if err != nil {
+		return "", err
+	}
+	var pr protoprint.Printer
+	return pr.PrintProtoToString(dsc.GetFile())
+}
+
 // EnsureExtensions uses the given descriptor source to download extensions for
 // the given message. It returns a copy of the given message, but as a dynamic
 // message that knows about all extensions known to the given descriptor source.
@@ -398,14 +530,35 @@ func fullyConvertToDynamic(msgFact *dynamic.MessageFactory, msg proto.Message) (
 // are not empty, so they will render with a single element (to show the types
 // and optionally nested fields). It also ensures that nested messages are not
 // nil by setting them to a message that is also fleshed out as a template
-// message.
+// message. Fields in proto2 messages that declare an explicit default value
+// are set to that default.
 func MakeTemplate(md *desc.MessageDescriptor) proto.Message {
-	return makeTemplate(md, nil)
+	return makeTemplate(md, nil, nil, "")
+}
+
+// MakeTemplateWithAnyTypes is like MakeTemplate, except that fields of type
+// google.protobuf.Any can be given a concrete message type. The given map is
+// keyed by the path to an Any field: field names separated by dots, starting
+// from the given message, such as "details" or "result.payload". For each Any
+// field whose path is in the map, the template includes a value of the mapped
+// type, which is itself fleshed out as a template, instead of a placeholder.
+// To render such a template as JSON, the formatter must be able to resolve the
+// concrete types, such as with AnyResolverFromDescriptorSource.
+func MakeTemplateWithAnyTypes(md *desc.MessageDescriptor, anyTypes map[string]*desc.MessageDescriptor) proto.Message {
+	return makeTemplate(md, nil, anyTypes, "")
 }
 
-func makeTemplate(md *desc.MessageDescriptor, path []*desc.MessageDescriptor) proto.Message {
+func makeTemplate(md *desc.MessageDescriptor, path []*desc.MessageDescriptor, anyTypes map[string]*desc.MessageDescriptor, fieldPath string) proto.Message {
 	switch md.GetFullyQualifiedName() {
 	case "google.protobuf.Any":
+		if concrete := anyTypes[fieldPath]; concrete != nil {
+			if b, err := proto.Marshal(makeTemplate(concrete, path, anyTypes, fieldPath)); err == nil {
+				return &anypb.Any{
+					TypeUrl: "type.googleapis.com/" + concrete.GetFullyQualifiedName(),
+					Value:   b,
+				}
+			}
+		}
 		// empty type URL is not allowed by JSON representation
 		// so we must give it a dummy type
 		var anyVal anypb.Any
@@ -463,6 +616,10 @@ func makeTemplate(md *desc.MessageDescriptor, path []*desc.MessageDescriptor) pr
 	// that also has non-nil message and non-empty repeated fields
 
 	for _, fd := range dm.GetMessageDescriptor().GetFields() {
+		childPath := fd.GetName()
+		if fieldPath != "" {
+			childPath = fieldPath + "." + childPath
+		}
 		if fd.IsRepeated() {
 			switch fd.GetType() {
 			case descriptorpb.FieldDescriptorProto_TYPE_FIXED32,
@@ -501,22 +658,162 @@ func makeTemplate(md *desc.MessageDescriptor, path []*desc.MessageDescriptor) pr
 
 			case descriptorpb.FieldDescriptorProto_TYPE_MESSAGE,
 				descriptorpb.FieldDescriptorProto_TYPE_GROUP:
-				dm.AddRepeatedField(fd, makeTemplate(fd.GetMessageType(), path))
+				dm.AddRepeatedField(fd, makeTemplate(fd.GetMessageType(), path, anyTypes, childPath))
 			}
 		} else if fd.GetMessageType() != nil {
-			dm.SetField(fd, makeTemplate(fd.GetMessageType(), path))
+			dm.SetField(fd, makeTemplate(fd.GetMessageType(), path, anyTypes, childPath))
+		} else if fd.AsFieldDescriptorProto().DefaultValue != nil {
+			// proto2 fields can declare an explicit default; set it so the
+			// template shows that value instead of the zero value
+			dm.SetField(fd, fd.GetDefaultValue())
 		}
 	}
 	return dm
 }
 
+// MakeRandomMessage returns a message instance for the given descriptor whose
+// fields are all populated with random, but valid, values. Repeated and map
+// fields have between one and three elements, enum fields use one of the
+// enum's defined values, and exactly one field of each one-of is set. Nested
+// messages are populated recursively, except when the message is a recursive
+// structure, in which case the nested message that would cause a cycle is
+// left empty. Well-known types are populated so they have a valid JSON form.
+// The given source of randomness is used to produce all values, so the same
+// seed will produce the same message.
+func MakeRandomMessage(md *desc.MessageDescriptor, rnd *rand.Rand) proto.Message {
+	return makeRandomMessage(md, rnd, nil)
+}
+
+// range of seconds for google.protobuf.Timestamp values that can be
+// represented in JSON: years 0001 through 9999
+const (
+	minTimestampSeconds = -62135596800
+	maxTimestampSeconds = 253402300799
+)
+
+func makeRandomMessage(md *desc.MessageDescriptor, rnd *rand.Rand, path []*desc.MessageDescriptor) proto.Message {
+	switch md.GetFullyQualifiedName() {
+	case "google.protobuf.Any", "google.protobuf.Value", "google.protobuf.ListValue", "google.protobuf.Struct":
+		// the JSON forms for these are very constrained, so we don't randomize them
+		return makeTemplate(md, nil, nil, "")
+	case "google.protobuf.Timestamp":
+		secs := minTimestampSeconds + rnd.Int63n(maxTimestampSeconds-minTimestampSeconds+1)
+		return &timestamppb.Timestamp{Seconds: secs, Nanos: rnd.Int31n(1e9)}
+	case "google.protobuf.Duration":
+		return durationpb.New(time.Duration(rnd.Int63()))
+	case "google.protobuf.FieldMask":
+		// paths must be snake-case field names to be valid in JSON
+		return &fieldmaskpb.FieldMask{Paths: []string{randomString(rnd, "abcdefghijklmnopqrstuvwxyz")}}
+	}
+
+	dm := dynamic.NewMessage(md)
+
+	// if the message is a recursive structure, we don't want to blow the stack
+	for _, seen := range path {
+		if seen == md {
+			// already visited this type; avoid infinite recursion
+			return dm
+		}
+	}
+	path = append(path, md)
+
+	// only one field in each one-of can be set
+	chosen := map[*desc.OneOfDescriptor]*desc.FieldDescriptor{}
+	for _, ood := range md.GetOneOfs() {
+		choices := ood.GetChoices()
+		chosen[ood] = choices[rnd.Intn(len(choices))]
+	}
+
+	for _, fd := range md.GetFields() {
+		if ood := fd.GetOneOf(); ood != nil && chosen[ood] != fd {
+			continue
+		}
+		switch {
+		case fd.IsMap():
+			for i, n := 0, 1+rnd.Intn(3); i < n; i++ {
+				dm.PutMapField(fd, randomValue(fd.GetMapKeyType(), rnd, path), randomValue(fd.GetMapValueType(), rnd, path))
+			}
+		case fd.IsRepeated():
+			for i, n := 0, 1+rnd.Intn(3); i < n; i++ {
+				dm.AddRepeatedField(fd, randomValue(fd, rnd, path))
+			}
+		default:
+			dm.SetField(fd, randomValue(fd, rnd, path))
+		}
+	}
+	return dm
+}
+
+const randomStringChars = "abcdefghijklmnopqrstuvwxyzABCDEFGHIJKLMNOPQRSTUVWXYZ0123456789"
+
+func randomString(rnd *rand.Rand, chars string) string {
+	b := make([]byte, 1+rnd.Intn(16))
+	for i := range b {
+		b[i] = chars[rnd.Intn(len(chars))]
+	}
+	return string(b)
+}
+
+func randomValue(fd *desc.FieldDescriptor, rnd *rand.Rand, path []*desc.MessageDescriptor) interface{} {
+	switch fd.GetType() {
+	case descriptorpb.FieldDescriptorProto_TYPE_FIXED32,
+		descriptorpb.FieldDescriptorProto_TYPE_UINT32:
+		return rnd.Uint32()
+
+	case descriptorpb.FieldDescriptorProto_TYPE_SFIXED32,
+		descriptorpb.FieldDescriptorProto_TYPE_SINT32,
+		descriptorpb.FieldDescriptorProto_TYPE_INT32:
+		return int32(rnd.Uint32())
+
+	case descriptorpb.FieldDescriptorProto_TYPE_ENUM:
+		vals := fd.GetEnumType().GetValues()
+		return vals[rnd.Intn(len(vals))].GetNumber()
+
+	case descriptorpb.FieldDescriptorProto_TYPE_FIXED64,
+		descriptorpb.FieldDescriptorProto_TYPE_UINT64:
+		return rnd.Uint64()
+
+	case descriptorpb.FieldDescriptorProto_TYPE_SFIXED64,
+		descriptorpb.FieldDescriptorProto_TYPE_SINT64,
+		descriptorpb.FieldDescriptorProto_TYPE_INT64:
+		return int64(rnd.Uint64())
+
+	case descriptorpb.FieldDescriptorProto_TYPE_STRING:
+		return randomString(rnd, randomStringChars)
+
+	case descriptorpb.FieldDescriptorProto_TYPE_BYTES:
+		b := make([]byte, 1+rnd.Intn(16))
+		rnd.Read(b)
+		return b
+
+	case descriptorpb.FieldDescriptorProto_TYPE_BOOL:
+		return rnd.Intn(2) == 1
+
+	case descriptorpb.FieldDescriptorProto_TYPE_FLOAT:
+		return float32((rnd.Float64()*2 - 1) * 1e6)
+
+	case descriptorpb.FieldDescriptorProto_TYPE_DOUBLE:
+		return (rnd.Float64()*2 - 1) * 1e6
+
+	default: // message or group
+		return makeRandomMessage(fd.GetMessageType(), rnd, path)
+	}
+}
+
 // ClientTransportCredentials is a helper function that constructs a TLS config with
 // the given properties (see ClientTLSConfig) and then constructs and returns gRPC
 // transport credentials using that config.
 //
 // Deprecated: Use grpcurl.ClientTLSConfig and credentials.NewTLS instead.
 func ClientTransportCredentials(insecureSkipVerify bool, cacertFile, clientCertFile, clientKeyFile string) (credentials.TransportCredentials, error) {
-	tlsConf, err := ClientTLSConfig(insecureSkipVerify, cacertFile, clientCertFile, clientKeyFile)
+	return ClientTransportCredentialsWithCAs(insecureSkipVerify, caFiles(cacertFile), clientCertFile, clientKeyFile)
+}
+
+// ClientTransportCredentialsWithCAs is like ClientTransportCredentials, except
+// that any number of files with trusted root certificates may be given (see
+// ClientTLSConfigWithCAs).
+func ClientTransportCredentialsWithCAs(insecureSkipVerify bool, cacertFiles []string, clientCertFile, clientKeyFile string) (credentials.TransportCredentials, error) {
+	tlsConf, err := ClientTLSConfigWithCAs(insecureSkipVerify, cacertFiles, clientCertFile, clientKeyFile)
 	if err != nil {
 		return nil, err
 	}
@@ -529,6 +826,15 @@ func ClientTransportCredentials(insecureSkipVerify bool, cacertFile, clientCertF
 // verify the server certs. If clientCertFile is blank, the client will not use a client
 // certificate. If clientCertFile is not blank then clientKeyFile must not be blank.
 func ClientTLSConfig(insecureSkipVerify bool, cacertFile, clientCertFile, clientKeyFile string) (*tls.Config, error) {
+	return ClientTLSConfigWithCAs(insecureSkipVerify, caFiles(cacertFile), clientCertFile, clientKeyFile)
+}
+
+// ClientTLSConfigWithCAs is like ClientTLSConfig, except that any number of
+// files with trusted root certificates may be given. The certificates in all
+// of them are added to a single pool, so a server certificate is trusted if
+// it was issued by any of them. If cacertFiles is empty, only standard trusted
+// certs are used to verify the server certs.
+func ClientTLSConfigWithCAs(insecureSkipVerify bool, cacertFiles []string, clientCertFile, clientKeyFile string) (*tls.Config, error) {
 	var tlsConf tls.Config
 
 	if clientCertFile != "" {
@@ -542,17 +848,19 @@ func ClientTLSConfig(insecureSkipVerify bool, cacertFile, clientCertFile, client
 
 	if insecureSkipVerify {
 		tlsConf.InsecureSkipVerify = true
-	} else if cacertFile != "" {
-		// Create a certificate pool from the certificate authority
+	} else if len(cacertFiles) > 0 {
+		// Create a certificate pool from the certificate authorities
 		certPool := x509.NewCertPool()
-		ca, err := os.ReadFile(cacertFile)
-		if err != nil {
-			return nil, fmt.Errorf("could not read ca certificate: %v", err)
-		}
+		for _, cacertFile := range cacertFiles {
+			ca, err := os.ReadFile(cacertFile)
+			if err != nil {
+				return nil, fmt.Errorf("could not read ca certificate %s: %v", cacertFile, err)
+			}
 
-		// Append the certificates from the CA
-		if ok := certPool.AppendCertsFromPEM(ca); !ok {
-			return nil, errors.New("failed to append ca certs")
+			// Append the certificates from the CA
+			if ok := certPool.AppendCertsFromPEM(ca); !ok {
+				return nil, fmt.Errorf("failed to append ca certs from %s", cacertFile)
+			}
 		}
 
 		tlsConf.RootCAs = certPool
@@ -561,6 +869,53 @@ func ClientTLSConfig(insecureSkipVerify bool, cacertFile, clientCertFile, client
 	return &tlsConf, nil
 }
 
+// caFiles returns the given CA file as a slice, which is empty if the file
+// name is blank.
+func caFiles(cacertFile string) []string {
+	if cacertFile == "" {
+		return nil
+	}
+	return []string{cacertFile}
+}
+
+// CertificatePinVerifier returns a function that is suitable for use as the
+// VerifyPeerCertificate field of a tls.Config. It verifies that the SHA-256
+// hash of the leaf certificate's SubjectPublicKeyInfo matches one of the given
+// pins, each of which is the base64-encoding of such a hash. If the config's
+// InsecureSkipVerify field is true, this check is the only verification that
+// is performed on the server's certificate; otherwise it is performed in
+// addition to the normal verification against trusted roots.
+func CertificatePinVerifier(pins []string) (func(rawCerts [][]byte, verifiedChains [][]*x509.Certificate) error, error) {
+	if len(pins) == 0 {
+		return nil, errors.New("no certificate pins given")
+	}
+	hashes := make(map[string]bool, len(pins))
+	for _, pin := range pins {
+		h, err := decode(pin)
+		if err != nil {
+			return nil, fmt.Errorf("certificate pin %q is not valid base64: %v", pin, err)
+		}
+		if len(h) != sha256.Size {
+			return nil, fmt.Errorf("certificate pin %q has wrong length: expecting %d bytes, got %d", pin, sha256.Size, len(h))
+		}
+		hashes[h] = true
+	}
+	return func(rawCerts [][]byte, _ [][]*x509.Certificate) error {
+		if len(rawCerts) == 0 {
+			return errors.New("server presented no certificate")
+		}
+		leaf, err := x509.ParseCertificate(rawCerts[0])
+		if err != nil {
+			return fmt.Errorf("could not parse server certificate: %v", err)
+		}
+		h := sha256.Sum256(leaf.RawSubjectPublicKeyInfo)
+		if !hashes[string(h[:])] {
+			return fmt.Errorf("server certificate does not match any pin: its pin is %s", base64.StdEncoding.EncodeToString(h[:]))
+		}
+		return nil
+	}, nil
+}
+
 // ServerTransportCredentials builds transport credentials for a gRPC server using the
 // given properties. If cacertFile is blank, the server will not request client certs
 // unless requireClientCerts is true. When requireClientCerts is false and cacertFile is
@@ -609,6 +964,11 @@ func ServerTransportCredentials(cacertFile, serverCertFile, serverKeyFile string
 // BlockingDial is a helper method to dial the given address, using optional TLS credentials,
 // and blocking until the returned connection is ready. If the given credentials are nil, the
 // connection will be insecure (plain-text).
+//
+// To connect through an HTTP CONNECT proxy, include a grpc.WithContextDialer
+// option with a dialer from ProxyDialer. Otherwise, gRPC's default proxy
+// handling applies, which uses the HTTPS_PROXY and NO_PROXY environment
+// variables.
 func BlockingDial(ctx context.Context, network, address string, creds credentials.TransportCredentials, opts ...grpc.DialOption) (*grpc.ClientConn, error) {
 	if creds == nil {
 		creds = insecure.NewCredentials()
@@ -678,6 +1038,22 @@ func BlockingDial(ctx context.Context, network, address string, creds credential
 	}
 }
 
+// BlockingDialContextDialer is like BlockingDial, except that the given dialer
+// is used to establish the connection, instead of dialing a network address.
+// This allows callers to supply their own transport, such as a tunnel or an
+// in-memory pipe, while still using the given credentials, which are applied
+// to the connection that the dialer returns. The given address is passed to
+// the dialer and is also the default authority, which is the server name that
+// is verified when the credentials use TLS.
+func BlockingDialContextDialer(ctx context.Context, address string, creds credentials.TransportCredentials, dialer func(ctx context.Context, addr string) (net.Conn, error), opts ...grpc.DialOption) (*grpc.ClientConn, error) {
+	// We put the dialer *after* the explicitly provided options, so that it
+	// is not overridden by one of them.
+	dialOpts := make([]grpc.DialOption, 0, len(opts)+1)
+	dialOpts = append(dialOpts, opts...)
+	dialOpts = append(dialOpts, grpc.WithContextDialer(dialer))
+	return BlockingDial(ctx, "", address, creds, dialOpts...)
+}
+
 // errSignalingCreds is a wrapper around a TransportCredentials value, but
 // it will use the writeResult function to notify on error.
 type errSignalingCreds struct {
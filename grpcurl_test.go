@@ -3,25 +3,35 @@ package grpcurl_test
 import (
 	"context"
 	"encoding/json"
+	"errors"
 	"fmt"
 	"io"
+	"io/fs"
+	"math/rand"
 	"net"
 	"os"
+	"path/filepath"
 	"reflect"
 	"strings"
+	"sync"
 	"testing"
 	"time"
 
 	"github.com/golang/protobuf/jsonpb" //lint:ignore SA1019 we have to import this because it appears in exported API
 	"github.com/golang/protobuf/proto"  //lint:ignore SA1019 we have to import this because it appears in exported API
 	"github.com/jhump/protoreflect/desc"
+	"github.com/jhump/protoreflect/desc/protoparse"
 	"github.com/jhump/protoreflect/grpcreflect"
 	"google.golang.org/grpc"
 	"google.golang.org/grpc/codes"
 	"google.golang.org/grpc/credentials/insecure"
+	"google.golang.org/grpc/encoding/gzip"
 	"google.golang.org/grpc/metadata"
 	"google.golang.org/grpc/reflection"
+	reflectpb "google.golang.org/grpc/reflection/grpc_reflection_v1alpha"
+	"google.golang.org/grpc/stats"
 	"google.golang.org/grpc/status"
+	"google.golang.org/protobuf/reflect/protodesc"
 
 	. "github.com/fullstorydev/grpcurl"
 	grpcurl_testing "github.com/fullstorydev/grpcurl/internal/testing"
@@ -139,6 +149,65 @@ func TestServerDoesNotSupportReflection(t *testing.T) {
 	}
 }
 
+func TestReflectionVersions(t *testing.T) {
+	testCases := []struct {
+		name     string
+		register func(*grpc.Server)
+		expected string
+	}{
+		{
+			name:     "v1 only",
+			register: func(s *grpc.Server) { reflection.RegisterV1(s) },
+			expected: "grpc.reflection.v1.ServerReflection",
+		},
+		{
+			name: "v1alpha only",
+			register: func(s *grpc.Server) {
+				reflectpb.RegisterServerReflectionServer(s, reflection.NewServer(reflection.ServerOptions{Services: s}))
+			},
+			expected: "grpc.reflection.v1alpha.ServerReflection",
+		},
+	}
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			svr := grpc.NewServer()
+			grpcurl_testing.RegisterTestServiceServer(svr, grpcurl_testing.TestServer{})
+			tc.register(svr)
+			l, err := net.Listen("tcp", "127.0.0.1:0")
+			if err != nil {
+				t.Fatalf("failed to listen: %v", err)
+			}
+			go svr.Serve(l)
+			defer svr.Stop()
+
+			cc, err := grpc.Dial(l.Addr().String(), grpc.WithTransportCredentials(insecure.NewCredentials()))
+			if err != nil {
+				t.Fatalf("failed to dial: %v", err)
+			}
+			defer cc.Close()
+			refClient := grpcreflect.NewClientAuto(context.Background(), cc)
+			defer refClient.Reset()
+			refSource := DescriptorSourceFromServer(context.Background(), refClient)
+
+			svcs, err := ListServices(refSource)
+			if err != nil {
+				t.Fatalf("failed to list services: %v", err)
+			}
+			expected := []string{tc.expected, "testing.TestService"}
+			if !reflect.DeepEqual(svcs, expected) {
+				t.Errorf("wrong services: wanted %v, got %v", expected, svcs)
+			}
+			d, err := refSource.FindSymbol("testing.TestService.UnaryCall")
+			if err != nil {
+				t.Fatalf("failed to describe method: %v", err)
+			}
+			if _, ok := d.(*desc.MethodDescriptor); !ok {
+				t.Errorf("expecting method descriptor, got %T", d)
+			}
+		})
+	}
+}
+
 func TestProtosetWithImports(t *testing.T) {
 	sourceProtoset, err := DescriptorSourceFromProtoSets("internal/testing/example.protoset")
 	if err != nil {
@@ -383,6 +452,518 @@ func TestMakeTemplateKnownTypes(t *testing.T) {
 	}
 }
 
+func TestDescriptorSourceForFilesReflection(t *testing.T) {
+	d, err := sourceReflect.FindSymbol("testing.TestService")
+	if err != nil {
+		t.Fatalf("failed to find service: %v", err)
+	}
+	fileName := d.GetFile().GetName()
+	source, err := DescriptorSourceForFiles(sourceReflect, fileName)
+	if err != nil {
+		t.Fatalf("failed to create descriptor source for %q: %v", fileName, err)
+	}
+	svcs, err := ListServices(source)
+	if err != nil {
+		t.Fatalf("failed to list services: %v", err)
+	}
+	// reflection service is not included, since it's defined in another file
+	expected := []string{"testing.TestService", "testing.UnimplementedService"}
+	if !reflect.DeepEqual(expected, svcs) {
+		t.Errorf("ListServices returned wrong results: wanted %v, got %v", expected, svcs)
+	}
+	if _, err := DescriptorSourceForFiles(sourceReflect, fileName, "does/not/exist.proto"); err == nil {
+		t.Error("expecting error for file not known to server")
+	}
+}
+
+func TestReflectionConcurrency(t *testing.T) {
+	refClient := grpcreflect.NewClientAuto(context.Background(), ccReflect)
+	defer refClient.Reset()
+	var extraClients []*grpcreflect.Client
+	defer func() {
+		for _, c := range extraClients {
+			c.Reset()
+		}
+	}()
+	source := DescriptorSourceFromServerWithOptions(context.Background(), refClient, ServerSourceOptions{
+		Concurrency: 2,
+		NewClient: func() *grpcreflect.Client {
+			c := grpcreflect.NewClientAuto(context.Background(), ccReflect)
+			extraClients = append(extraClients, c)
+			return c
+		},
+	})
+
+	files, err := GetAllFiles(source)
+	if err != nil {
+		t.Fatalf("failed to get all files: %v", err)
+	}
+	expected := []string{
+		"grpc/reflection/v1/reflection.proto", "grpc/reflection/v1alpha/reflection.proto", "test.proto",
+	}
+	if names := fileNames(files); !reflect.DeepEqual(expected, names) {
+		t.Errorf("GetAllFiles returned wrong results: wanted %v, got %v", expected, names)
+	}
+	if len(extraClients) > 1 {
+		t.Errorf("expecting at most one additional client, got %d", len(extraClients))
+	}
+
+	// errors are reported per file, in the order requested
+	_, err = DescriptorSourceForFiles(source, "test.proto", "does/not/exist.proto", "also/missing.proto")
+	if err == nil || !strings.Contains(err.Error(), "does/not/exist.proto") {
+		t.Errorf("expecting error for first missing file, got %v", err)
+	}
+}
+
+func TestReflectionConcurrencySharedDependency(t *testing.T) {
+	// two files that import the same dependency, served from their own registry
+	fds, err := (&protoparse.Parser{
+		Accessor: protoparse.FileContentsFromMap(map[string]string{
+			"a.proto": `syntax = "proto3"; import "google/protobuf/empty.proto"; package a; service A { rpc Get (google.protobuf.Empty) returns (google.protobuf.Empty); }`,
+			"b.proto": `syntax = "proto3"; import "google/protobuf/empty.proto"; package b; service B { rpc Get (google.protobuf.Empty) returns (google.protobuf.Empty); }`,
+		}),
+	}).ParseFiles("a.proto", "b.proto")
+	if err != nil {
+		t.Fatalf("failed to parse protos: %v", err)
+	}
+	files, err := protodesc.NewFiles(desc.ToFileDescriptorSet(fds...))
+	if err != nil {
+		t.Fatalf("failed to create registry: %v", err)
+	}
+	svr := grpc.NewServer()
+	reflectpb.RegisterServerReflectionServer(svr, reflection.NewServer(reflection.ServerOptions{Services: svr, DescriptorResolver: files}))
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("failed to listen: %v", err)
+	}
+	go svr.Serve(l)
+	defer svr.Stop()
+	cc, err := grpc.Dial(l.Addr().String(), grpc.WithTransportCredentials(insecure.NewCredentials()))
+	if err != nil {
+		t.Fatalf("failed to dial: %v", err)
+	}
+	defer cc.Close()
+
+	refClient := grpcreflect.NewClientAuto(context.Background(), cc)
+	defer refClient.Reset()
+	var extraClients []*grpcreflect.Client
+	defer func() {
+		for _, c := range extraClients {
+			c.Reset()
+		}
+	}()
+	source := DescriptorSourceFromServerWithOptions(context.Background(), refClient, ServerSourceOptions{
+		Concurrency: 2,
+		NewClient: func() *grpcreflect.Client {
+			c := grpcreflect.NewClientAuto(context.Background(), cc)
+			extraClients = append(extraClients, c)
+			return c
+		},
+	})
+
+	// each file is fetched by a different client, so each has its own copy
+	// of the shared dependency
+	source, err = DescriptorSourceForFiles(source, "a.proto", "b.proto")
+	if err != nil {
+		t.Fatalf("failed to create descriptor source: %v", err)
+	}
+	svcs, err := ListServices(source)
+	if err != nil {
+		t.Fatalf("failed to list services: %v", err)
+	}
+	if expected := []string{"a.A", "b.B"}; !reflect.DeepEqual(expected, svcs) {
+		t.Errorf("ListServices returned wrong results: wanted %v, got %v", expected, svcs)
+	}
+}
+
+func TestReflectionCache(t *testing.T) {
+	// count the reflection requests that the server receives, by kind
+	var mu sync.Mutex
+	counts := map[string]int{}
+	countRequests := func(srv interface{}, ss grpc.ServerStream, info *grpc.StreamServerInfo, handler grpc.StreamHandler) error {
+		return handler(srv, &countingStream{ServerStream: ss, count: func(kind string) {
+			mu.Lock()
+			counts[kind]++
+			mu.Unlock()
+		}})
+	}
+	svr := grpc.NewServer(grpc.StreamInterceptor(countRequests))
+	grpcurl_testing.RegisterTestServiceServer(svr, grpcurl_testing.TestServer{})
+	reflection.Register(svr)
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("failed to listen: %v", err)
+	}
+	go svr.Serve(l)
+	defer svr.Stop()
+	cc, err := grpc.Dial(l.Addr().String(), grpc.WithTransportCredentials(insecure.NewCredentials()))
+	if err != nil {
+		t.Fatalf("failed to dial: %v", err)
+	}
+	defer cc.Close()
+
+	var clients []*grpcreflect.Client
+	defer func() {
+		for _, c := range clients {
+			c.Reset()
+		}
+	}()
+	newClient := func() *grpcreflect.Client {
+		c := grpcreflect.NewClientAuto(context.Background(), cc)
+		clients = append(clients, c)
+		return c
+	}
+	source := DescriptorSourceFromServerWithOptions(context.Background(), newClient(), ServerSourceOptions{
+		Concurrency: 2,
+		NewClient:   newClient,
+	})
+
+	for i := 0; i < 3; i++ {
+		if _, err := GetAllFiles(source); err != nil {
+			t.Fatalf("failed to get all files: %v", err)
+		}
+		if _, err := source.FindSymbol("testing.TestService"); err != nil {
+			t.Fatalf("failed to find symbol: %v", err)
+		}
+		if _, err := source.AllExtensionsForType("testing.SimpleRequest"); err != nil {
+			t.Fatalf("failed to get extensions: %v", err)
+		}
+	}
+
+	mu.Lock()
+	defer mu.Unlock()
+	// one request for each of the three services, no matter how many clients
+	// are in the pool or how many times they are resolved
+	if counts["symbol"] != 3 {
+		t.Errorf("expecting 3 requests for files containing symbols, got %d", counts["symbol"])
+	}
+	if counts["extensions"] != 1 {
+		t.Errorf("expecting 1 request for extension numbers, got %d", counts["extensions"])
+	}
+}
+
+// countingStream reports each reflection request received on a stream.
+func TestReflectionDeadline(t *testing.T) {
+	// a server whose reflection service is slow to respond
+	slowReflection := func(srv interface{}, ss grpc.ServerStream, info *grpc.StreamServerInfo, handler grpc.StreamHandler) error {
+		if strings.HasPrefix(info.FullMethod, "/grpc.reflection.") {
+			select {
+			case <-time.After(time.Second):
+			case <-ss.Context().Done():
+				return ss.Context().Err()
+			}
+		}
+		return handler(srv, ss)
+	}
+	svr := grpc.NewServer(grpc.StreamInterceptor(slowReflection))
+	grpcurl_testing.RegisterTestServiceServer(svr, grpcurl_testing.TestServer{})
+	reflection.Register(svr)
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("failed to listen: %v", err)
+	}
+	go svr.Serve(l)
+	defer svr.Stop()
+	cc, err := grpc.Dial(l.Addr().String(), grpc.WithTransportCredentials(insecure.NewCredentials()))
+	if err != nil {
+		t.Fatalf("failed to dial: %v", err)
+	}
+	defer cc.Close()
+
+	refCtx, cancel := context.WithTimeout(context.Background(), 100*time.Millisecond)
+	defer cancel()
+	refClient := grpcreflect.NewClientAuto(refCtx, cc)
+	defer refClient.Reset()
+	source := DescriptorSourceFromServer(refCtx, refClient)
+
+	_, err = source.FindSymbol("testing.TestService")
+	if !errors.Is(err, ErrReflectionDeadlineExceeded) {
+		t.Fatalf("expecting reflection deadline error, got %v", err)
+	}
+	h := &handler{reqMessages: []string{payload1}}
+	err = InvokeRPC(context.Background(), source, cc, "testing.TestService/UnaryCall", nil, h, h.supplyRequest)
+	if err == nil || !strings.Contains(err.Error(), ErrReflectionDeadlineExceeded.Error()) {
+		t.Errorf("expecting error about reflection deadline, got %v", err)
+	}
+
+	// the RPC itself is not subject to the reflection deadline
+	h = &handler{reqMessages: []string{payload1}}
+	err = InvokeRPC(context.Background(), sourceProtoset, cc, "testing.TestService/UnaryCall", makeHeaders(codes.OK), h, h.supplyRequest)
+	if err != nil {
+		t.Fatalf("unexpected error during RPC: %v", err)
+	}
+	h.check(t, "testing.TestService.UnaryCall", codes.OK, 1, 1)
+}
+
+type countingStream struct {
+	grpc.ServerStream
+	count func(kind string)
+}
+
+func (s *countingStream) RecvMsg(m interface{}) error {
+	if err := s.ServerStream.RecvMsg(m); err != nil {
+		return err
+	}
+	// both versions of the reflection request message have these methods
+	if req, ok := m.(interface{ GetFileContainingSymbol() string }); ok && req.GetFileContainingSymbol() != "" {
+		s.count("symbol")
+	}
+	if req, ok := m.(interface{ GetAllExtensionNumbersOfType() string }); ok && req.GetAllExtensionNumbersOfType() != "" {
+		s.count("extensions")
+	}
+	return nil
+}
+
+func TestWriteProtoFilesReflection(t *testing.T) {
+	outDir := t.TempDir()
+	if err := WriteProtoFiles(outDir, sourceReflect, "testing.TestService", "grpc.reflection.v1.ServerReflection"); err != nil {
+		t.Fatalf("failed to write proto files: %v", err)
+	}
+	var written []string
+	err := filepath.WalkDir(outDir, func(path string, d fs.DirEntry, err error) error {
+		if err != nil || d.IsDir() {
+			return err
+		}
+		rel, err := filepath.Rel(outDir, path)
+		written = append(written, filepath.ToSlash(rel))
+		return err
+	})
+	if err != nil {
+		t.Fatalf("failed to list written files: %v", err)
+	}
+	expected := []string{"grpc/reflection/v1/reflection.proto", "test.proto"}
+	if !reflect.DeepEqual(written, expected) {
+		t.Errorf("wrong files written: wanted %v, got %v", expected, written)
+	}
+
+	// the reconstructed sources should be usable
+	fds, err := (&protoparse.Parser{ImportPaths: []string{outDir}}).ParseFiles("test.proto")
+	if err != nil {
+		t.Fatalf("failed to parse written proto file: %v", err)
+	}
+	if fds[0].FindService("testing.TestService") == nil {
+		t.Error("written proto file does not define testing.TestService")
+	}
+}
+
+func TestMetadataFromHeaders(t *testing.T) {
+	md := MetadataFromHeaders([]string{
+		"Foo: abc",
+		"trace-bin: AQL/",   // standard base64
+		"trace-bin: AQL_",   // URL-safe base64
+		"other-bin: AQI",    // unpadded base64
+		"raw-bin: not b64!", // not base64, so used as is
+		"literal: ${HOME}",  // only ExpandHeaders expands variables
+		"empty",
+	})
+	expected := metadata.MD{
+		"foo":       []string{"abc"},
+		"trace-bin": []string{"\x01\x02\xff", "\x01\x02\xff"},
+		"other-bin": []string{"\x01\x02"},
+		"raw-bin":   []string{"not b64!"},
+		"literal":   []string{"${HOME}"},
+		"empty":     []string{""},
+	}
+	if !reflect.DeepEqual(md, expected) {
+		t.Errorf("wrong metadata: wanted %q, got %q", expected, md)
+	}
+}
+
+func TestMetadataToJSON(t *testing.T) {
+	md := metadata.Pairs("foo", "abc", "bar-bin", "\x01\x02", "foo", "def")
+	expected := `{"bar-bin":["AQI="],"foo":["abc","def"]}`
+	if out := MetadataToJSON(md); out != expected {
+		t.Errorf("wrong JSON for metadata: wanted %s, got %s", expected, out)
+	}
+	if out := MetadataToJSON(nil); out != "{}" {
+		t.Errorf("wrong JSON for empty metadata: wanted {}, got %s", out)
+	}
+}
+
+func TestMakeTemplateWithAnyTypes(t *testing.T) {
+	p := protoparse.Parser{
+		Accessor: protoparse.FileContentsFromMap(map[string]string{
+			"test.proto": `
+				syntax = "proto3";
+				package test;
+				import "google/protobuf/any.proto";
+				message Foo {
+					google.protobuf.Any detail = 1;
+					google.protobuf.Any other = 2;
+				}
+				message Bar {
+					string name = 1;
+					repeated int32 ids = 2;
+				}`,
+		}),
+	}
+	fds, err := p.ParseFiles("test.proto")
+	if err != nil {
+		t.Fatalf("failed to parse proto: %v", err)
+	}
+	source, err := DescriptorSourceFromFileDescriptors(fds...)
+	if err != nil {
+		t.Fatalf("failed to create descriptor source: %v", err)
+	}
+	message := MakeTemplateWithAnyTypes(fds[0].FindMessage("test.Foo"), map[string]*desc.MessageDescriptor{
+		"detail": fds[0].FindMessage("test.Bar"),
+	})
+
+	jsm := jsonpb.Marshaler{EmitDefaults: true, AnyResolver: AnyResolverFromDescriptorSource(source)}
+	out, err := jsm.MarshalToString(message)
+	if err != nil {
+		t.Fatalf("failed to marshal to JSON: %v", err)
+	}
+	expected := `{"detail":{"@type":"type.googleapis.com/test.Bar","ids":[0],"name":""},"other":{"@type":"type.googleapis.com/google.protobuf.Empty","value":{}}}`
+	if out != expected {
+		t.Errorf("template message is not as expected; want:\n%s\ngot:\n%s", expected, out)
+	}
+}
+
+func TestListAllExtensions(t *testing.T) {
+	p := protoparse.Parser{
+		Accessor: protoparse.FileContentsFromMap(map[string]string{
+			"test.proto": `
+				syntax = "proto2";
+				package test;
+				message Foo {
+					optional int32 num = 1;
+					extensions 100 to 200;
+				}
+				message Bar {
+					extend Foo { optional string nested = 150; }
+				}
+				extend Foo { optional bool flag = 101; }`,
+		}),
+	}
+	fds, err := p.ParseFiles("test.proto")
+	if err != nil {
+		t.Fatalf("failed to parse proto: %v", err)
+	}
+	source, err := DescriptorSourceFromFileDescriptors(fds...)
+	if err != nil {
+		t.Fatalf("failed to create descriptor source: %v", err)
+	}
+	exts, err := ListAllExtensions(source)
+	if err != nil {
+		t.Fatalf("failed to list extensions: %v", err)
+	}
+	if len(exts) != 1 {
+		t.Fatalf("expected extensions for 1 type, got %d", len(exts))
+	}
+	var names []string
+	for _, ext := range exts["test.Foo"] {
+		names = append(names, fmt.Sprintf("%s=%d", ext.GetFullyQualifiedName(), ext.GetNumber()))
+	}
+	expected := []string{"test.flag=101", "test.Bar.nested=150"}
+	if !reflect.DeepEqual(names, expected) {
+		t.Errorf("wrong extensions: wanted %v, got %v", expected, names)
+	}
+}
+
+func TestGetFileText(t *testing.T) {
+	const fileText = `syntax = "proto3";
+
+package test;
+
+import "google/protobuf/empty.proto";
+
+// Widgets are things.
+message Widget {
+  // The widget's name.
+  string name = 1;
+}
+
+service WidgetService {
+  // Gets a widget.
+  rpc GetWidget ( google.protobuf.Empty ) returns ( Widget );
+}
+`
+	p := protoparse.Parser{
+		Accessor:              protoparse.FileContentsFromMap(map[string]string{"widget.proto": fileText}),
+		IncludeSourceCodeInfo: true,
+	}
+	fds, err := p.ParseFiles("widget.proto")
+	if err != nil {
+		t.Fatalf("failed to parse proto: %v", err)
+	}
+	source, err := DescriptorSourceFromFileDescriptors(fds...)
+	if err != nil {
+		t.Fatalf("failed to create descriptor source: %v", err)
+	}
+	for _, symbol := range []string{"test.Widget", "test.WidgetService.GetWidget"} {
+		txt, err := GetFileText(source, symbol)
+		if err != nil {
+			t.Fatalf("%s: failed to get file text: %v", symbol, err)
+		}
+		if txt != fileText {
+			t.Errorf("%s: file text is not as expected; want:\n%s\ngot:\n%s", symbol, fileText, txt)
+		}
+	}
+	if _, err := GetFileText(source, "test.DoesNotExist"); err == nil {
+		t.Error("expecting error for unknown symbol")
+	}
+}
+
+func TestMakeTemplateProto2Defaults(t *testing.T) {
+	p := protoparse.Parser{
+		Accessor: protoparse.FileContentsFromMap(map[string]string{
+			"test.proto": `
+				syntax = "proto2";
+				package test;
+				enum Color { RED = 0; GREEN = 1; }
+				message Foo {
+					optional int32 num = 1 [default = 42];
+					optional string str = 2 [default = "abc"];
+					optional Color color = 3 [default = GREEN];
+					optional bool flag = 4;
+				}`,
+		}),
+	}
+	fds, err := p.ParseFiles("test.proto")
+	if err != nil {
+		t.Fatalf("failed to parse proto: %v", err)
+	}
+	message := MakeTemplate(fds[0].FindMessage("test.Foo"))
+
+	jsm := jsonpb.Marshaler{EmitDefaults: true}
+	out, err := jsm.MarshalToString(message)
+	if err != nil {
+		t.Fatalf("failed to marshal to JSON: %v", err)
+	}
+	expected := `{"num":42,"str":"abc","color":"GREEN","flag":false}`
+	if out != expected {
+		t.Errorf("template message is not as expected; want:\n%s\ngot:\n%s", expected, out)
+	}
+}
+
+func TestMakeRandomMessage(t *testing.T) {
+	for _, msg := range []proto.Message{(*jsonpbtest.KnownTypes)(nil), (*grpcurl_testing.SimpleRequest)(nil)} {
+		descriptor, err := desc.LoadMessageDescriptorForMessage(msg)
+		if err != nil {
+			t.Fatalf("failed to load descriptor: %v", err)
+		}
+		name := descriptor.GetFullyQualifiedName()
+
+		// the same seed must produce the same message, and it must have a valid JSON form
+		jsm := jsonpb.Marshaler{}
+		out1, err := jsm.MarshalToString(MakeRandomMessage(descriptor, rand.New(rand.NewSource(123))))
+		if err != nil {
+			t.Fatalf("%s: failed to marshal to JSON: %v", name, err)
+		}
+		out2, err := jsm.MarshalToString(MakeRandomMessage(descriptor, rand.New(rand.NewSource(123))))
+		if err != nil {
+			t.Fatalf("%s: failed to marshal to JSON: %v", name, err)
+		}
+		if out1 != out2 {
+			t.Errorf("%s: same seed produced different messages:\n%s\n%s", name, out1, out2)
+		}
+		if out1 == "{}" {
+			t.Errorf("%s: random message has no fields set", name)
+		}
+	}
+}
+
 func TestDescribe(t *testing.T) {
 	for _, ds := range descSources {
 		t.Run(ds.name, func(t *testing.T) {
@@ -471,6 +1052,76 @@ func getCC(includeRefl bool) *grpc.ClientConn {
 	}
 }
 
+func TestDescribeStructured(t *testing.T) {
+	dsc, err := sourceProtoset.FindSymbol("testing.StreamingOutputCallResponse")
+	if err != nil {
+		t.Fatalf("failed to find message: %v", err)
+	}
+	structured, err := DescribeStructured(dsc)
+	if err != nil {
+		t.Fatalf("failed to describe message: %v", err)
+	}
+	b, err := json.Marshal(structured)
+	if err != nil {
+		t.Fatalf("failed to marshal description: %v", err)
+	}
+	expected := `{"name":"StreamingOutputCallResponse","fullName":"testing.StreamingOutputCallResponse","fields":[` +
+		`{"name":"payload","number":1,"jsonName":"payload","type":"message","typeName":"testing.Payload"}]}`
+	if string(b) != expected {
+		t.Errorf("wrong description:\nexpected: %s\ngot: %s", expected, b)
+	}
+
+	// repeated fields, oneofs, defaults, and nested types
+	fds, err := (&protoparse.Parser{
+		Accessor: protoparse.FileContentsFromMap(map[string]string{
+			"test.proto": `
+				syntax = "proto2";
+				package test;
+				message Foo {
+					enum Kind { A = 0; B = 1; }
+					message Bar { optional string s = 1; }
+					optional int32 num = 1 [default = 42];
+					repeated Bar bars = 2;
+					oneof choice {
+						Kind kind = 3;
+						string name = 4;
+					}
+				}`,
+		}),
+	}).ParseFiles("test.proto")
+	if err != nil {
+		t.Fatalf("failed to parse proto: %v", err)
+	}
+	structured, err = DescribeStructured(fds[0].FindMessage("test.Foo"))
+	if err != nil {
+		t.Fatalf("failed to describe message: %v", err)
+	}
+	msg := structured.(*StructuredMessage)
+	fields := make([]string, len(msg.Fields))
+	for i, f := range msg.Fields {
+		fields[i] = fmt.Sprintf("%s=%d %s %s repeated=%v oneof=%q default=%q", f.Name, f.Number, f.Type, f.TypeName, f.Repeated, f.Oneof, f.Default)
+	}
+	expectedFields := []string{
+		`num=1 int32  repeated=false oneof="" default="42"`,
+		`bars=2 message test.Foo.Bar repeated=true oneof="" default=""`,
+		`kind=3 enum test.Foo.Kind repeated=false oneof="choice" default=""`,
+		`name=4 string  repeated=false oneof="choice" default=""`,
+	}
+	if !reflect.DeepEqual(fields, expectedFields) {
+		t.Errorf("wrong fields:\nexpected: %v\ngot: %v", expectedFields, fields)
+	}
+	if !reflect.DeepEqual(msg.Oneofs, []string{"choice"}) {
+		t.Errorf("wrong oneofs: %v", msg.Oneofs)
+	}
+	if len(msg.Messages) != 1 || msg.Messages[0].FullName != "test.Foo.Bar" || len(msg.Enums) != 1 || len(msg.Enums[0].Values) != 2 {
+		t.Errorf("wrong nested types: %+v, %+v", msg.Messages, msg.Enums)
+	}
+
+	if _, err := DescribeStructured(fds[0].FindSymbol("test.Foo.num")); err == nil {
+		t.Error("expecting error describing a field")
+	}
+}
+
 func TestUnary(t *testing.T) {
 	for _, ds := range descSources {
 		t.Run(ds.name, func(t *testing.T) {
@@ -503,6 +1154,149 @@ func doTestUnary(t *testing.T, cc *grpc.ClientConn, source DescriptorSource) {
 	h.check(t, "testing.TestService.UnaryCall", codes.NotFound, 1, 0)
 }
 
+func TestInvokeRPCWithCompression(t *testing.T) {
+	var rec compressionRecorder
+	svr := grpc.NewServer(grpc.StatsHandler(&rec))
+	grpcurl_testing.RegisterTestServiceServer(svr, grpcurl_testing.TestServer{})
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("failed to listen: %v", err)
+	}
+	go svr.Serve(l)
+	defer svr.Stop()
+	cc, err := grpc.Dial(l.Addr().String(), grpc.WithTransportCredentials(insecure.NewCredentials()))
+	if err != nil {
+		t.Fatalf("failed to dial: %v", err)
+	}
+	defer cc.Close()
+	h := &handler{reqMessages: []string{payload1}}
+	err = InvokeRPCWithCallOptions(context.Background(), sourceProtoset, cc, "testing.TestService/UnaryCall", makeHeaders(codes.OK), h, h.supplyRequest, grpc.UseCompressor(gzip.Name))
+	if err != nil {
+		t.Fatalf("unexpected error during RPC: %v", err)
+	}
+	if h.check(t, "testing.TestService.UnaryCall", codes.OK, 1, 1) {
+		if h.respMessages[0] != payload1 {
+			t.Errorf("unexpected response from RPC: expecting %s; got %s", payload1, h.respMessages[0])
+		}
+	}
+	req := &grpcurl_testing.StreamingOutputCallRequest{
+		ResponseParameters: []*grpcurl_testing.ResponseParameters{{Size: 10}, {Size: 20}},
+	}
+	payload, err := (&jsonpb.Marshaler{}).MarshalToString(req)
+	if err != nil {
+		t.Fatalf("failed to construct request: %v", err)
+	}
+	h = &handler{reqMessages: []string{payload}}
+	err = InvokeRPCWithCallOptions(context.Background(), sourceProtoset, cc, "testing.TestService/StreamingOutputCall", makeHeaders(codes.OK), h, h.supplyRequest, grpc.UseCompressor(gzip.Name))
+	if err != nil {
+		t.Fatalf("unexpected error during RPC: %v", err)
+	}
+	h.check(t, "testing.TestService.StreamingOutputCall", codes.OK, 1, 2)
+	if got := rec.get(); !reflect.DeepEqual(got, []string{"gzip", "gzip"}) {
+		t.Errorf("expecting both requests to be compressed with gzip, got %v", got)
+	}
+}
+
+func TestChannelWithRPCPath(t *testing.T) {
+	// a stub server that accepts any path, like a gateway would
+	var mu sync.Mutex
+	var paths []string
+	svr := grpc.NewServer(grpc.UnknownServiceHandler(func(_ interface{}, stream grpc.ServerStream) error {
+		path, _ := grpc.Method(stream.Context())
+		mu.Lock()
+		paths = append(paths, path)
+		mu.Unlock()
+		var req grpcurl_testing.SimpleRequest
+		if err := stream.RecvMsg(&req); err != nil {
+			return err
+		}
+		return stream.SendMsg(&grpcurl_testing.SimpleResponse{Username: "stub"})
+	}))
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("failed to listen: %v", err)
+	}
+	go svr.Serve(l)
+	defer svr.Stop()
+	cc, err := grpc.Dial(l.Addr().String(), grpc.WithTransportCredentials(insecure.NewCredentials()))
+	if err != nil {
+		t.Fatalf("failed to dial: %v", err)
+	}
+	defer cc.Close()
+
+	ch := ChannelWithRPCPath(cc, "/gateway/v1/call")
+	for _, method := range []string{"testing.TestService/UnaryCall", "testing.TestService/StreamingOutputCall"} {
+		h := &handler{}
+		if err := InvokeRPC(context.Background(), sourceProtoset, ch, method, nil, h, h.supplyRequest); err != nil {
+			t.Fatalf("unexpected error during RPC: %v", err)
+		}
+		if h.respStatus.Code() != codes.OK || len(h.respMessages) != 1 {
+			t.Errorf("%s: expecting one response and OK status, got %d and %v", method, len(h.respMessages), h.respStatus)
+		}
+	}
+	mu.Lock()
+	defer mu.Unlock()
+	if !reflect.DeepEqual(paths, []string{"/gateway/v1/call", "/gateway/v1/call"}) {
+		t.Errorf("wrong paths received by server: %v", paths)
+	}
+}
+
+// compressionRecorder is a server stats handler that records the compression
+// of each incoming request.
+type compressionRecorder struct {
+	mu          sync.Mutex
+	compression []string
+}
+
+func (r *compressionRecorder) get() []string {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	return r.compression
+}
+
+func (r *compressionRecorder) TagRPC(ctx context.Context, _ *stats.RPCTagInfo) context.Context {
+	return ctx
+}
+
+func (r *compressionRecorder) HandleRPC(_ context.Context, s stats.RPCStats) {
+	if in, ok := s.(*stats.InHeader); ok {
+		r.mu.Lock()
+		r.compression = append(r.compression, in.Compression)
+		r.mu.Unlock()
+	}
+}
+
+func (r *compressionRecorder) TagConn(ctx context.Context, _ *stats.ConnTagInfo) context.Context {
+	return ctx
+}
+
+func (r *compressionRecorder) HandleConn(context.Context, stats.ConnStats) {}
+
+func TestInvokeRPCParallel(t *testing.T) {
+	for _, code := range []codes.Code{codes.OK, codes.NotFound} {
+		rf := NewJSONRequestParser(strings.NewReader(payload1), nil)
+		res, err := InvokeRPCParallel(context.Background(), sourceProtoset, ccNoReflect, "testing.TestService/UnaryCall", makeHeaders(code), 4, 25, rf.Next)
+		if err != nil {
+			t.Fatalf("unexpected error during RPCs: %v", err)
+		}
+		if res.Total() != 25 || res.Codes[code] != 25 {
+			t.Errorf("expecting 25 calls with code %v, got %d total: %v", code, res.Total(), res.Codes)
+		}
+		if res.Percentile(0) != res.Latencies[0] || res.Percentile(100) != res.Latencies[24] {
+			t.Errorf("wrong min or max latency")
+		}
+		if res.Percentile(50) != res.Latencies[12] {
+			t.Errorf("wrong median latency: expecting %v, got %v", res.Latencies[12], res.Percentile(50))
+		}
+	}
+
+	rf := NewJSONRequestParser(strings.NewReader(""), nil)
+	_, err := InvokeRPCParallel(context.Background(), sourceProtoset, ccNoReflect, "testing.TestService/StreamingOutputCall", nil, 4, 25, rf.Next)
+	if err == nil || !strings.Contains(err.Error(), "streaming") {
+		t.Errorf("expecting error for streaming method, got %v", err)
+	}
+}
+
 func TestClientStream(t *testing.T) {
 	for _, ds := range descSources {
 		t.Run(ds.name, func(t *testing.T) {
@@ -757,6 +1551,16 @@ func (h *handler) getRequestData() ([]byte, error) {
 	return []byte(h.reqMessages[h.reqMessagesCount-1]), nil
 }
 
+// supplyRequest is a RequestSupplier that parses the data returned by
+// getRequestData, for use with InvokeRPC and its variants.
+func (h *handler) supplyRequest(m proto.Message) error {
+	data, err := h.getRequestData()
+	if err != nil {
+		return err
+	}
+	return jsonpb.UnmarshalString(string(data), m)
+}
+
 func (h *handler) OnResolveMethod(md *desc.MethodDescriptor) {
 	h.methodCount++
 	h.method = md
@@ -19,6 +19,9 @@ import (
 	"google.golang.org/grpc/codes"
 	"google.golang.org/grpc/metadata"
 	"google.golang.org/grpc/status"
+
+	// Register gzip compressor so it can be used with InvokeRPCWithCallOptions
+	_ "google.golang.org/grpc/encoding/gzip"
 )
 
 // InvocationEventHandler is a bag of callbacks for handling events that occur in the course
@@ -87,11 +90,82 @@ type RequestSupplier func(proto.Message) error
 func InvokeRPC(ctx context.Context, source DescriptorSource, ch grpcdynamic.Channel, methodName string,
 	headers []string, handler InvocationEventHandler, requestData RequestSupplier) error {
 
+	return InvokeRPCWithCallOptions(ctx, source, ch, methodName, headers, handler, requestData)
+}
+
+// InvokeRPCWithCallOptions is like InvokeRPC, except that the given call
+// options are used when invoking the method. For example, to send compressed
+// request messages, use grpc.UseCompressor with the name of a registered
+// compressor, such as gzip.Name. (The gzip compressor is always registered,
+// since this package imports it.) Compressed responses are decompressed
+// automatically, regardless of the options given.
+func InvokeRPCWithCallOptions(ctx context.Context, source DescriptorSource, ch grpcdynamic.Channel, methodName string,
+	headers []string, handler InvocationEventHandler, requestData RequestSupplier, opts ...grpc.CallOption) error {
+
 	md := MetadataFromHeaders(headers)
 
+	mtd, err := resolveMethod(source, methodName)
+	if err != nil {
+		return err
+	}
+
+	handler.OnResolveMethod(mtd)
+
+	msgFactory, err := messageFactoryForMethod(source, mtd)
+	if err != nil {
+		return err
+	}
+	req := msgFactory.NewMessage(mtd.GetInputType())
+
+	handler.OnSendHeaders(md)
+	ctx = metadata.NewOutgoingContext(ctx, md)
+
+	stub := grpcdynamic.NewStubWithMessageFactory(ch, msgFactory)
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+
+	if mtd.IsClientStreaming() && mtd.IsServerStreaming() {
+		return invokeBidi(ctx, stub, mtd, handler, requestData, req, opts)
+	} else if mtd.IsClientStreaming() {
+		return invokeClientStream(ctx, stub, mtd, handler, requestData, req, opts)
+	} else if mtd.IsServerStreaming() {
+		return invokeServerStream(ctx, stub, mtd, handler, requestData, req, opts)
+	} else {
+		return invokeUnary(ctx, stub, mtd, handler, requestData, req, opts)
+	}
+}
+
+// ChannelWithRPCPath returns a channel that sends every RPC to the given
+// HTTP/2 path, such as "/gateway/svc/Method", instead of the path derived
+// from the name of the method being invoked. The path must start with a slash.
+// The method's descriptor is still used to encode requests and to decode
+// responses.
+//
+// This is for interop with gateways and proxies that expose methods under
+// rewritten paths. Use it only for invocations, not for reflection.
+func ChannelWithRPCPath(ch grpcdynamic.Channel, path string) grpcdynamic.Channel {
+	return &rpcPathChannel{Channel: ch, path: path}
+}
+
+type rpcPathChannel struct {
+	grpcdynamic.Channel
+	path string
+}
+
+func (c *rpcPathChannel) Invoke(ctx context.Context, _ string, args, reply interface{}, opts ...grpc.CallOption) error {
+	return c.Channel.Invoke(ctx, c.path, args, reply, opts...)
+}
+
+func (c *rpcPathChannel) NewStream(ctx context.Context, sd *grpc.StreamDesc, _ string, opts ...grpc.CallOption) (grpc.ClientStream, error) {
+	return c.Channel.NewStream(ctx, sd, c.path, opts...)
+}
+
+// resolveMethod uses the given descriptor source to find the method with the
+// given name, which is in 'service/method' or 'service.method' form.
+func resolveMethod(source DescriptorSource, methodName string) (*desc.MethodDescriptor, error) {
 	svc, mth := parseSymbol(methodName)
 	if svc == "" || mth == "" {
-		return fmt.Errorf("given method name %q is not in expected format: 'service/method' or 'service.method'", methodName)
+		return nil, fmt.Errorf("given method name %q is not in expected format: 'service/method' or 'service.method'", methodName)
 	}
 
 	dsc, err := source.FindSymbol(svc)
@@ -100,58 +174,43 @@ func InvokeRPC(ctx context.Context, source DescriptorSource, ch grpcdynamic.Chan
 		errStatus, hasStatus := status.FromError(err)
 		switch {
 		case hasStatus && isNotFoundError(err):
-			return status.Errorf(errStatus.Code(), "target server does not expose service %q: %s", svc, errStatus.Message())
+			return nil, status.Errorf(errStatus.Code(), "target server does not expose service %q: %s", svc, errStatus.Message())
 		case hasStatus:
-			return status.Errorf(errStatus.Code(), "failed to query for service descriptor %q: %s", svc, errStatus.Message())
+			return nil, status.Errorf(errStatus.Code(), "failed to query for service descriptor %q: %s", svc, errStatus.Message())
 		case isNotFoundError(err):
-			return fmt.Errorf("target server does not expose service %q", svc)
+			return nil, fmt.Errorf("target server does not expose service %q", svc)
 		}
-		return fmt.Errorf("failed to query for service descriptor %q: %v", svc, err)
+		return nil, fmt.Errorf("failed to query for service descriptor %q: %v", svc, err)
 	}
 	sd, ok := dsc.(*desc.ServiceDescriptor)
 	if !ok {
-		return fmt.Errorf("target server does not expose service %q", svc)
+		return nil, fmt.Errorf("target server does not expose service %q", svc)
 	}
 	mtd := sd.FindMethodByName(mth)
 	if mtd == nil {
-		return fmt.Errorf("service %q does not include a method named %q", svc, mth)
+		return nil, fmt.Errorf("service %q does not include a method named %q", svc, mth)
 	}
+	return mtd, nil
+}
 
-	handler.OnResolveMethod(mtd)
-
-	// we also download any applicable extensions so we can provide full support for parsing user-provided data
+// messageFactoryForMethod returns a factory for the request and response
+// messages of the given method. It knows about all extensions of those
+// messages in the given descriptor source, so we can provide full support
+// for parsing user-provided data.
+func messageFactoryForMethod(source DescriptorSource, mtd *desc.MethodDescriptor) (*dynamic.MessageFactory, error) {
 	var ext dynamic.ExtensionRegistry
 	alreadyFetched := map[string]bool{}
-	if err = fetchAllExtensions(source, &ext, mtd.GetInputType(), alreadyFetched); err != nil {
-		return fmt.Errorf("error resolving server extensions for message %s: %v", mtd.GetInputType().GetFullyQualifiedName(), err)
-	}
-	if err = fetchAllExtensions(source, &ext, mtd.GetOutputType(), alreadyFetched); err != nil {
-		return fmt.Errorf("error resolving server extensions for message %s: %v", mtd.GetOutputType().GetFullyQualifiedName(), err)
+	if err := fetchAllExtensions(source, &ext, mtd.GetInputType(), alreadyFetched); err != nil {
+		return nil, fmt.Errorf("error resolving server extensions for message %s: %v", mtd.GetInputType().GetFullyQualifiedName(), err)
 	}
-
-	msgFactory := dynamic.NewMessageFactoryWithExtensionRegistry(&ext)
-	req := msgFactory.NewMessage(mtd.GetInputType())
-
-	handler.OnSendHeaders(md)
-	ctx = metadata.NewOutgoingContext(ctx, md)
-
-	stub := grpcdynamic.NewStubWithMessageFactory(ch, msgFactory)
-	ctx, cancel := context.WithCancel(ctx)
-	defer cancel()
-
-	if mtd.IsClientStreaming() && mtd.IsServerStreaming() {
-		return invokeBidi(ctx, stub, mtd, handler, requestData, req)
-	} else if mtd.IsClientStreaming() {
-		return invokeClientStream(ctx, stub, mtd, handler, requestData, req)
-	} else if mtd.IsServerStreaming() {
-		return invokeServerStream(ctx, stub, mtd, handler, requestData, req)
-	} else {
-		return invokeUnary(ctx, stub, mtd, handler, requestData, req)
+	if err := fetchAllExtensions(source, &ext, mtd.GetOutputType(), alreadyFetched); err != nil {
+		return nil, fmt.Errorf("error resolving server extensions for message %s: %v", mtd.GetOutputType().GetFullyQualifiedName(), err)
 	}
+	return dynamic.NewMessageFactoryWithExtensionRegistry(&ext), nil
 }
 
 func invokeUnary(ctx context.Context, stub grpcdynamic.Stub, md *desc.MethodDescriptor, handler InvocationEventHandler,
-	requestData RequestSupplier, req proto.Message) error {
+	requestData RequestSupplier, req proto.Message, opts []grpc.CallOption) error {
 
 	err := requestData(req)
 	if err != nil && err != io.EOF {
@@ -170,7 +229,8 @@ func invokeUnary(ctx context.Context, stub grpcdynamic.Stub, md *desc.MethodDesc
 	// Now we can actually invoke the RPC!
 	var respHeaders metadata.MD
 	var respTrailers metadata.MD
-	resp, err := stub.InvokeRpc(ctx, md, req, grpc.Trailer(&respTrailers), grpc.Header(&respHeaders))
+	callOpts := append([]grpc.CallOption{grpc.Trailer(&respTrailers), grpc.Header(&respHeaders)}, opts...)
+	resp, err := stub.InvokeRpc(ctx, md, req, callOpts...)
 
 	stat, ok := status.FromError(err)
 	if !ok {
@@ -191,10 +251,10 @@ func invokeUnary(ctx context.Context, stub grpcdynamic.Stub, md *desc.MethodDesc
 }
 
 func invokeClientStream(ctx context.Context, stub grpcdynamic.Stub, md *desc.MethodDescriptor, handler InvocationEventHandler,
-	requestData RequestSupplier, req proto.Message) error {
+	requestData RequestSupplier, req proto.Message, opts []grpc.CallOption) error {
 
 	// invoke the RPC!
-	str, err := stub.InvokeRpcClientStream(ctx, md)
+	str, err := stub.InvokeRpcClientStream(ctx, md, opts...)
 
 	// Upload each request message in the stream
 	var resp proto.Message
@@ -245,7 +305,7 @@ func invokeClientStream(ctx context.Context, stub grpcdynamic.Stub, md *desc.Met
 }
 
 func invokeServerStream(ctx context.Context, stub grpcdynamic.Stub, md *desc.MethodDescriptor, handler InvocationEventHandler,
-	requestData RequestSupplier, req proto.Message) error {
+	requestData RequestSupplier, req proto.Message, opts []grpc.CallOption) error {
 
 	err := requestData(req)
 	if err != nil && err != io.EOF {
@@ -262,7 +322,7 @@ func invokeServerStream(ctx context.Context, stub grpcdynamic.Stub, md *desc.Met
 	}
 
 	// Now we can actually invoke the RPC!
-	str, err := stub.InvokeRpcServerStream(ctx, md, req)
+	str, err := stub.InvokeRpcServerStream(ctx, md, req, opts...)
 
 	if str != nil {
 		if respHeaders, err := str.Header(); err == nil {
@@ -298,13 +358,13 @@ func invokeServerStream(ctx context.Context, stub grpcdynamic.Stub, md *desc.Met
 }
 
 func invokeBidi(ctx context.Context, stub grpcdynamic.Stub, md *desc.MethodDescriptor, handler InvocationEventHandler,
-	requestData RequestSupplier, req proto.Message) error {
+	requestData RequestSupplier, req proto.Message, opts []grpc.CallOption) error {
 
 	ctx, cancel := context.WithCancel(ctx)
 	defer cancel()
 
 	// invoke the RPC!
-	str, err := stub.InvokeRpcBidiStream(ctx, md)
+	str, err := stub.InvokeRpcBidiStream(ctx, md, opts...)
 
 	var wg sync.WaitGroup
 	var sendErr atomic.Value
@@ -0,0 +1,147 @@
+package grpcurl
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"math"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/jhump/protoreflect/dynamic/grpcdynamic"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/status"
+)
+
+// ParallelResult summarizes the outcome of the calls made by
+// InvokeRPCParallel.
+type ParallelResult struct {
+	// The number of calls that completed with each status code. Calls that
+	// fail without a status from the server, such as when the connection
+	// cannot be established, are counted according to the status code that
+	// gRPC reports for them, usually Unavailable or Unknown.
+	Codes map[codes.Code]int
+	// The latency of every call, sorted from fastest to slowest.
+	Latencies []time.Duration
+	// The wall-clock time taken to make all of the calls.
+	Elapsed time.Duration
+}
+
+// Total returns the number of calls that were made.
+func (r *ParallelResult) Total() int {
+	return len(r.Latencies)
+}
+
+// Failed returns the number of calls that did not complete with an OK status.
+func (r *ParallelResult) Failed() int {
+	return r.Total() - r.Codes[codes.OK]
+}
+
+// Percentile returns the call latency at the given percentile, which must be
+// between 0 and 100. For example, Percentile(50) is the median latency and
+// Percentile(100) is the maximum. It returns zero if no calls were made.
+func (r *ParallelResult) Percentile(p float64) time.Duration {
+	if len(r.Latencies) == 0 {
+		return 0
+	}
+	// nearest-rank method
+	rank := int(math.Ceil(p / 100 * float64(len(r.Latencies))))
+	if rank < 1 {
+		rank = 1
+	} else if rank > len(r.Latencies) {
+		rank = len(r.Latencies)
+	}
+	return r.Latencies[rank-1]
+}
+
+// InvokeRPCParallel uses the given gRPC channel to invoke the given unary method
+// n times, with at most concurrency calls in flight at once. It is meant for
+// simple load testing. The method is resolved, and the request message is
+// populated, just once; every call then sends the same request message with
+// the given headers. An error is returned if the method is not unary or if the
+// request message cannot be populated. Errors from the calls themselves do not
+// stop the remaining calls: they are instead summarized in the result, along
+// with the latency of each call.
+//
+// As with InvokeRPC, if the requestData function returns io.EOF on the first
+// call, an empty request message is sent. It is an error for the requestData
+// function to provide more than one message.
+func InvokeRPCParallel(ctx context.Context, source DescriptorSource, ch grpcdynamic.Channel, methodName string,
+	headers []string, concurrency, n int, requestData RequestSupplier) (*ParallelResult, error) {
+
+	if concurrency < 1 {
+		return nil, fmt.Errorf("concurrency must be at least 1, got %d", concurrency)
+	}
+	if n < 0 {
+		return nil, fmt.Errorf("number of calls must not be negative, got %d", n)
+	}
+
+	mtd, err := resolveMethod(source, methodName)
+	if err != nil {
+		return nil, err
+	}
+	if mtd.IsClientStreaming() || mtd.IsServerStreaming() {
+		return nil, fmt.Errorf("method %q is a streaming RPC; only unary RPCs can be invoked in parallel", mtd.GetFullyQualifiedName())
+	}
+	msgFactory, err := messageFactoryForMethod(source, mtd)
+	if err != nil {
+		return nil, err
+	}
+
+	req := msgFactory.NewMessage(mtd.GetInputType())
+	err = requestData(req)
+	if err != nil && err != io.EOF {
+		return nil, fmt.Errorf("error getting request data: %v", err)
+	}
+	if err != io.EOF {
+		// verify there is no second message, which is a usage error
+		err := requestData(msgFactory.NewMessage(mtd.GetInputType()))
+		if err == nil {
+			return nil, fmt.Errorf("method %q is a unary RPC, but request data contained more than 1 message", mtd.GetFullyQualifiedName())
+		} else if err != io.EOF {
+			return nil, fmt.Errorf("error getting request data: %v", err)
+		}
+	}
+
+	ctx = metadata.NewOutgoingContext(ctx, MetadataFromHeaders(headers))
+	stub := grpcdynamic.NewStubWithMessageFactory(ch, msgFactory)
+
+	result := &ParallelResult{
+		Codes:     map[codes.Code]int{},
+		Latencies: make([]time.Duration, 0, n),
+	}
+	var mu sync.Mutex
+	calls := make(chan struct{})
+	var wg sync.WaitGroup
+	start := time.Now()
+	for i := 0; i < concurrency && i < n; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for range calls {
+				callStart := time.Now()
+				_, err := stub.InvokeRpc(ctx, mtd, req)
+				latency := time.Since(callStart)
+				code := status.Code(err)
+
+				mu.Lock()
+				result.Codes[code]++
+				result.Latencies = append(result.Latencies, latency)
+				mu.Unlock()
+			}
+		}()
+	}
+	for i := 0; i < n; i++ {
+		calls <- struct{}{}
+	}
+	close(calls)
+	wg.Wait()
+	result.Elapsed = time.Since(start)
+
+	sort.Slice(result.Latencies, func(i, j int) bool {
+		return result.Latencies[i] < result.Latencies[j]
+	})
+	return result, nil
+}
@@ -0,0 +1,95 @@
+package grpcurl
+
+import (
+	"bufio"
+	"context"
+	"encoding/base64"
+	"fmt"
+	"net"
+	"net/http"
+	"net/url"
+	"time"
+)
+
+// ProxyDialer returns a function that connects to an address through the
+// given HTTP proxy, using a CONNECT request to open a tunnel. TLS and HTTP/2
+// then run over the tunnel, so both plaintext and TLS connections work. If the
+// proxy URL includes a user name and password, they are sent as basic
+// credentials. The proxy URL must have the "http" scheme.
+//
+// To dial through a proxy, pass the function to BlockingDial (or grpc.Dial)
+// with grpc.WithContextDialer. Note that gRPC does not use its own proxy
+// support, based on the HTTPS_PROXY environment variable, when a dialer is
+// given, so the given proxy replaces any configured in the environment.
+func ProxyDialer(proxy *url.URL) func(ctx context.Context, address string) (net.Conn, error) {
+	return func(ctx context.Context, address string) (net.Conn, error) {
+		if proxy.Scheme != "http" {
+			return nil, fmt.Errorf("unsupported proxy scheme %q: only http proxies are supported", proxy.Scheme)
+		}
+		proxyAddr := proxy.Host
+		if proxy.Port() == "" {
+			proxyAddr = net.JoinHostPort(proxy.Hostname(), "80")
+		}
+		var d net.Dialer
+		conn, err := d.DialContext(ctx, "tcp", proxyAddr)
+		if err != nil {
+			return nil, fmt.Errorf("failed to connect to proxy %s: %w", proxyAddr, err)
+		}
+		tunnel, err := proxyConnect(ctx, conn, proxy, address)
+		if err != nil {
+			_ = conn.Close()
+			return nil, err
+		}
+		return tunnel, nil
+	}
+}
+
+// proxyConnect sends a CONNECT request for the given address over the given
+// connection to a proxy and returns the tunnel once the proxy accepts it.
+func proxyConnect(ctx context.Context, conn net.Conn, proxy *url.URL, address string) (net.Conn, error) {
+	if deadline, ok := ctx.Deadline(); ok {
+		_ = conn.SetDeadline(deadline)
+		defer func() {
+			_ = conn.SetDeadline(time.Time{})
+		}()
+	}
+	req := &http.Request{
+		Method: http.MethodConnect,
+		URL:    &url.URL{Host: address},
+		Host:   address,
+		Header: http.Header{},
+	}
+	if user := proxy.User; user != nil {
+		password, _ := user.Password()
+		auth := base64.StdEncoding.EncodeToString([]byte(user.Username() + ":" + password))
+		req.Header.Set("Proxy-Authorization", "Basic "+auth)
+	}
+	if err := req.Write(conn); err != nil {
+		return nil, fmt.Errorf("failed to send CONNECT request to proxy: %w", err)
+	}
+	br := bufio.NewReader(conn)
+	resp, err := http.ReadResponse(br, req)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read CONNECT response from proxy: %w", err)
+	}
+	_ = resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("proxy refused CONNECT to %s: %s", address, resp.Status)
+	}
+	if br.Buffered() > 0 {
+		// the server may have already sent data through the tunnel
+		return &bufferedConn{Conn: conn, r: br}, nil
+	}
+	return conn, nil
+}
+
+// bufferedConn is a connection whose first bytes have already been read into
+// a buffer.
+type bufferedConn struct {
+	net.Conn
+	r *bufio.Reader
+}
+
+func (c *bufferedConn) Read(p []byte) (int, error) {
+	return c.r.Read(p)
+}
@@ -0,0 +1,241 @@
+package grpcurl_test
+
+import (
+	"bufio"
+	"context"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"net/url"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/credentials"
+
+	. "github.com/fullstorydev/grpcurl"
+	grpcurl_testing "github.com/fullstorydev/grpcurl/internal/testing"
+)
+
+// connectProxy is a fake HTTP proxy that supports CONNECT tunnels.
+type connectProxy struct {
+	l net.Listener
+	// if non-empty, the required Proxy-Authorization header
+	auth string
+
+	mu      sync.Mutex
+	targets []string
+}
+
+func newConnectProxy(t *testing.T, auth string) *connectProxy {
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("failed to listen: %v", err)
+	}
+	p := &connectProxy{l: l, auth: auth}
+	go func() {
+		for {
+			conn, err := l.Accept()
+			if err != nil {
+				return
+			}
+			go p.handle(conn)
+		}
+	}()
+	t.Cleanup(func() {
+		_ = l.Close()
+	})
+	return p
+}
+
+func (p *connectProxy) handle(conn net.Conn) {
+	defer conn.Close()
+	br := bufio.NewReader(conn)
+	req, err := http.ReadRequest(br)
+	if err != nil {
+		return
+	}
+	if req.Method != http.MethodConnect {
+		_, _ = io.WriteString(conn, "HTTP/1.1 405 Method Not Allowed\r\n\r\n")
+		return
+	}
+	if p.auth != "" && req.Header.Get("Proxy-Authorization") != p.auth {
+		_, _ = io.WriteString(conn, "HTTP/1.1 407 Proxy Authentication Required\r\n\r\n")
+		return
+	}
+	p.mu.Lock()
+	p.targets = append(p.targets, req.Host)
+	p.mu.Unlock()
+	target, err := net.Dial("tcp", req.Host)
+	if err != nil {
+		_, _ = io.WriteString(conn, "HTTP/1.1 502 Bad Gateway\r\n\r\n")
+		return
+	}
+	defer target.Close()
+	if _, err := io.WriteString(conn, "HTTP/1.1 200 Connection Established\r\n\r\n"); err != nil {
+		return
+	}
+	go func() {
+		_, _ = io.Copy(target, br)
+		_ = target.Close()
+	}()
+	_, _ = io.Copy(conn, target)
+}
+
+func (p *connectProxy) url(userInfo string) *url.URL {
+	u, _ := url.Parse(fmt.Sprintf("http://%s%s", userInfo, p.l.Addr()))
+	return u
+}
+
+func (p *connectProxy) tunnels() []string {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	return append([]string(nil), p.targets...)
+}
+
+func TestProxyDialer(t *testing.T) {
+	serverCreds, err := ServerTransportCredentials("", "internal/testing/tls/server.crt", "internal/testing/tls/server.key", false)
+	if err != nil {
+		t.Fatalf("failed to create server creds: %v", err)
+	}
+	clientCreds, err := ClientTransportCredentials(false, "internal/testing/tls/ca.crt", "", "")
+	if err != nil {
+		t.Fatalf("failed to create client creds: %v", err)
+	}
+	testCases := []struct {
+		name        string
+		serverCreds credentials.TransportCredentials
+		clientCreds credentials.TransportCredentials
+	}{
+		{name: "plaintext"},
+		{name: "tls", serverCreds: serverCreds, clientCreds: clientCreds},
+	}
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			var svrOpts []grpc.ServerOption
+			if tc.serverCreds != nil {
+				svrOpts = append(svrOpts, grpc.Creds(tc.serverCreds))
+			}
+			svr := grpc.NewServer(svrOpts...)
+			grpcurl_testing.RegisterTestServiceServer(svr, grpcurl_testing.TestServer{})
+			l, err := net.Listen("tcp", "127.0.0.1:0")
+			if err != nil {
+				t.Fatalf("failed to listen: %v", err)
+			}
+			go svr.Serve(l)
+			defer svr.Stop()
+
+			proxy := newConnectProxy(t, "Basic dXNlcjpwYXNz") // user:pass
+			ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+			defer cancel()
+			cc, err := BlockingDial(ctx, "tcp", l.Addr().String(), tc.clientCreds,
+				grpc.WithContextDialer(ProxyDialer(proxy.url("user:pass@"))))
+			if err != nil {
+				t.Fatalf("failed to dial through proxy: %v", err)
+			}
+			defer cc.Close()
+			simpleTest(t, cc)
+			if tunnels := proxy.tunnels(); len(tunnels) != 1 || tunnels[0] != l.Addr().String() {
+				t.Errorf("expecting one tunnel to %s, got %v", l.Addr(), tunnels)
+			}
+
+			// wrong credentials
+			dial := ProxyDialer(proxy.url("user:wrong@"))
+			if _, err := dial(ctx, l.Addr().String()); err == nil || !strings.Contains(err.Error(), "407") {
+				t.Errorf("expecting proxy authentication error, got %v", err)
+			}
+		})
+	}
+}
+
+// pipeListener is a net.Listener whose connections are in-memory pipes,
+// created by its dial method.
+type pipeListener struct {
+	conns  chan net.Conn
+	closed chan struct{}
+	once   sync.Once
+}
+
+func newPipeListener() *pipeListener {
+	return &pipeListener{conns: make(chan net.Conn), closed: make(chan struct{})}
+}
+
+func (l *pipeListener) Accept() (net.Conn, error) {
+	select {
+	case c := <-l.conns:
+		return c, nil
+	case <-l.closed:
+		return nil, net.ErrClosed
+	}
+}
+
+func (l *pipeListener) Close() error {
+	l.once.Do(func() { close(l.closed) })
+	return nil
+}
+
+func (l *pipeListener) Addr() net.Addr {
+	return pipeAddr{}
+}
+
+func (l *pipeListener) dial(ctx context.Context, _ string) (net.Conn, error) {
+	client, server := net.Pipe()
+	select {
+	case l.conns <- server:
+		return client, nil
+	case <-l.closed:
+		return nil, net.ErrClosed
+	case <-ctx.Done():
+		return nil, ctx.Err()
+	}
+}
+
+type pipeAddr struct{}
+
+func (pipeAddr) Network() string { return "pipe" }
+func (pipeAddr) String() string  { return "pipe" }
+
+func TestBlockingDialContextDialer(t *testing.T) {
+	serverCreds, err := ServerTransportCredentials("", "internal/testing/tls/server.crt", "internal/testing/tls/server.key", false)
+	if err != nil {
+		t.Fatalf("failed to create server creds: %v", err)
+	}
+	clientCreds, err := ClientTransportCredentials(false, "internal/testing/tls/ca.crt", "", "")
+	if err != nil {
+		t.Fatalf("failed to create client creds: %v", err)
+	}
+	testCases := []struct {
+		name        string
+		serverCreds credentials.TransportCredentials
+		clientCreds credentials.TransportCredentials
+	}{
+		{name: "plaintext"},
+		{name: "tls", serverCreds: serverCreds, clientCreds: clientCreds},
+	}
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			var svrOpts []grpc.ServerOption
+			if tc.serverCreds != nil {
+				svrOpts = append(svrOpts, grpc.Creds(tc.serverCreds))
+			}
+			svr := grpc.NewServer(svrOpts...)
+			grpcurl_testing.RegisterTestServiceServer(svr, grpcurl_testing.TestServer{})
+			l := newPipeListener()
+			go svr.Serve(l)
+			defer svr.Stop()
+
+			ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+			defer cancel()
+			// the address is the server name in the server's certificate
+			cc, err := BlockingDialContextDialer(ctx, "localhost", tc.clientCreds, l.dial)
+			if err != nil {
+				t.Fatalf("failed to dial over pipe: %v", err)
+			}
+			defer cc.Close()
+			simpleTest(t, cc)
+		})
+	}
+}
@@ -0,0 +1,124 @@
+package grpcurl
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/jhump/protoreflect/desc"
+)
+
+// StructuredMessage describes a message type, as returned by
+// DescribeStructured. It is meant to be serialized, for example as JSON, by
+// tools that consume the schema programmatically.
+type StructuredMessage struct {
+	Name     string            `json:"name"`
+	FullName string            `json:"fullName"`
+	Fields   []StructuredField `json:"fields"`
+	// Oneofs are the names of the message's oneofs, in declaration order.
+	Oneofs []string `json:"oneofs,omitempty"`
+	// Messages and Enums are the types declared inside the message.
+	Messages []StructuredMessage `json:"messages,omitempty"`
+	Enums    []StructuredEnum    `json:"enums,omitempty"`
+}
+
+// StructuredField describes a field of a message type.
+type StructuredField struct {
+	Name     string `json:"name"`
+	Number   int32  `json:"number"`
+	JSONName string `json:"jsonName"`
+	// Type is the field's type as named in proto source, such as "int32",
+	// "string", "message", or "enum".
+	Type string `json:"type"`
+	// TypeName is the fully-qualified name of the message or enum type, for
+	// fields whose Type is "message", "group", or "enum".
+	TypeName string `json:"typeName,omitempty"`
+	Repeated bool   `json:"repeated,omitempty"`
+	// Oneof is the name of the oneof that contains the field, if any.
+	Oneof string `json:"oneof,omitempty"`
+	// Default is the field's explicit default value, as written in proto
+	// source. It is empty if the field has no explicit default, which is
+	// always the case in proto3.
+	Default string `json:"default,omitempty"`
+}
+
+// StructuredEnum describes an enum type.
+type StructuredEnum struct {
+	Name     string                `json:"name"`
+	FullName string                `json:"fullName"`
+	Values   []StructuredEnumValue `json:"values"`
+}
+
+// StructuredEnumValue describes a value of an enum type.
+type StructuredEnumValue struct {
+	Name   string `json:"name"`
+	Number int32  `json:"number"`
+}
+
+// DescribeStructured returns a serializable description of the given
+// descriptor, as an alternative to the proto source returned by
+// GetDescriptorText. The descriptor must be a message or an enum, for which
+// a *StructuredMessage or *StructuredEnum, respectively, is returned.
+func DescribeStructured(dsc desc.Descriptor) (interface{}, error) {
+	switch d := dsc.(type) {
+	case *desc.MessageDescriptor:
+		msg := structuredMessage(d)
+		return &msg, nil
+	case *desc.EnumDescriptor:
+		enum := structuredEnum(d)
+		return &enum, nil
+	default:
+		return nil, fmt.Errorf("cannot describe %s as a structure: only messages and enums are supported", dsc.GetFullyQualifiedName())
+	}
+}
+
+func structuredMessage(md *desc.MessageDescriptor) StructuredMessage {
+	msg := StructuredMessage{
+		Name:     md.GetName(),
+		FullName: md.GetFullyQualifiedName(),
+		Fields:   []StructuredField{},
+	}
+	for _, fld := range md.GetFields() {
+		f := StructuredField{
+			Name:     fld.GetName(),
+			Number:   fld.GetNumber(),
+			JSONName: fld.GetJSONName(),
+			Type:     strings.ToLower(strings.TrimPrefix(fld.GetType().String(), "TYPE_")),
+			Repeated: fld.IsRepeated(),
+			Default:  fld.AsFieldDescriptorProto().GetDefaultValue(),
+		}
+		if fmd := fld.GetMessageType(); fmd != nil {
+			f.TypeName = fmd.GetFullyQualifiedName()
+		} else if ed := fld.GetEnumType(); ed != nil {
+			f.TypeName = ed.GetFullyQualifiedName()
+		}
+		if ood := fld.GetOneOf(); ood != nil {
+			f.Oneof = ood.GetName()
+		}
+		msg.Fields = append(msg.Fields, f)
+	}
+	for _, ood := range md.GetOneOfs() {
+		msg.Oneofs = append(msg.Oneofs, ood.GetName())
+	}
+	for _, nested := range md.GetNestedMessageTypes() {
+		msg.Messages = append(msg.Messages, structuredMessage(nested))
+	}
+	for _, ed := range md.GetNestedEnumTypes() {
+		msg.Enums = append(msg.Enums, structuredEnum(ed))
+	}
+	return msg
+}
+
+func structuredEnum(ed *desc.EnumDescriptor) StructuredEnum {
+	enum := StructuredEnum{
+		Name:     ed.GetName(),
+		FullName: ed.GetFullyQualifiedName(),
+		Values:   []StructuredEnumValue{},
+	}
+	for _, vd := range ed.GetValues() {
+		enum.Values = append(enum.Values, StructuredEnumValue{
+			Name:   vd.GetName(),
+			Number: vd.GetNumber(),
+		})
+	}
+	return enum
+}
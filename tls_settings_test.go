@@ -1,9 +1,16 @@
 package grpcurl_test
 
 import (
+	"bytes"
 	"context"
+	"crypto/sha256"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/pem"
 	"fmt"
 	"net"
+	"os"
+	"path/filepath"
 	"strings"
 	"testing"
 	"time"
@@ -44,6 +51,40 @@ func TestBasicTLS(t *testing.T) {
 	simpleTest(t, e.cc)
 }
 
+func TestMultipleCAsTLS(t *testing.T) {
+	serverCreds, err := ServerTransportCredentials("", "internal/testing/tls/server.crt", "internal/testing/tls/server.key", false)
+	if err != nil {
+		t.Fatalf("failed to create server creds: %v", err)
+	}
+	// the server's certificate is issued by the second CA
+	clientCreds, err := ClientTransportCredentialsWithCAs(false, []string{"internal/testing/tls/wrong-ca.crt", "internal/testing/tls/ca.crt"}, "", "")
+	if err != nil {
+		t.Fatalf("failed to create client creds: %v", err)
+	}
+
+	e, err := createTestServerAndClient(serverCreds, clientCreds)
+	if err != nil {
+		t.Fatalf("failed to setup server and client: %v", err)
+	}
+	defer e.Close()
+
+	simpleTest(t, e.cc)
+
+	// but not if only the first CA is trusted
+	clientCreds, err = ClientTransportCredentialsWithCAs(false, []string{"internal/testing/tls/wrong-ca.crt"}, "", "")
+	if err != nil {
+		t.Fatalf("failed to create client creds: %v", err)
+	}
+	e2, err := createTestServerAndClient(serverCreds, clientCreds)
+	if err == nil {
+		e2.Close()
+		t.Fatal("expecting TLS failure setting up server and client")
+	}
+	if !strings.Contains(err.Error(), "certificate") {
+		t.Fatalf("expecting TLS certificate error, got: %v", err)
+	}
+}
+
 func TestInsecureClientTLS(t *testing.T) {
 	serverCreds, err := ServerTransportCredentials("", "internal/testing/tls/server.crt", "internal/testing/tls/server.key", false)
 	if err != nil {
@@ -359,3 +400,130 @@ func (e *testEnv) Close() {
 		e.svr = nil
 	}
 }
+
+func TestPinnedCertTLS(t *testing.T) {
+	serverCreds, err := ServerTransportCredentials("", "internal/testing/tls/server.crt", "internal/testing/tls/server.key", false)
+	if err != nil {
+		t.Fatalf("failed to create server creds: %v", err)
+	}
+	pin, err := certPin("internal/testing/tls/server.crt")
+	if err != nil {
+		t.Fatalf("failed to compute certificate pin: %v", err)
+	}
+	verify, err := CertificatePinVerifier([]string{pin})
+	if err != nil {
+		t.Fatalf("failed to create pin verifier: %v", err)
+	}
+	tlsConf, err := ClientTLSConfig(true, "", "", "")
+	if err != nil {
+		t.Fatalf("failed to create client TLS config: %v", err)
+	}
+	tlsConf.VerifyPeerCertificate = verify
+
+	e, err := createTestServerAndClient(serverCreds, credentials.NewTLS(tlsConf))
+	if err != nil {
+		t.Fatalf("failed to setup server and client: %v", err)
+	}
+	defer e.Close()
+
+	simpleTest(t, e.cc)
+}
+
+func TestBrokenTLS_PinMismatch(t *testing.T) {
+	serverCreds, err := ServerTransportCredentials("", "internal/testing/tls/server.crt", "internal/testing/tls/server.key", false)
+	if err != nil {
+		t.Fatalf("failed to create server creds: %v", err)
+	}
+	pin, err := certPin("internal/testing/tls/other.crt")
+	if err != nil {
+		t.Fatalf("failed to compute certificate pin: %v", err)
+	}
+	verify, err := CertificatePinVerifier([]string{pin})
+	if err != nil {
+		t.Fatalf("failed to create pin verifier: %v", err)
+	}
+	tlsConf, err := ClientTLSConfig(false, "internal/testing/tls/ca.crt", "", "")
+	if err != nil {
+		t.Fatalf("failed to create client TLS config: %v", err)
+	}
+	tlsConf.VerifyPeerCertificate = verify
+
+	e, err := createTestServerAndClient(serverCreds, credentials.NewTLS(tlsConf))
+	if err == nil {
+		e.Close()
+		t.Fatal("expecting TLS failure setting up server and client")
+	}
+	if !strings.Contains(err.Error(), "does not match any pin") {
+		t.Fatalf("expecting pin mismatch error, got: %v", err)
+	}
+}
+
+func certPin(certFile string) (string, error) {
+	b, err := os.ReadFile(certFile)
+	if err != nil {
+		return "", err
+	}
+	block, _ := pem.Decode(b)
+	if block == nil {
+		return "", fmt.Errorf("no PEM data in %s", certFile)
+	}
+	cert, err := x509.ParseCertificate(block.Bytes)
+	if err != nil {
+		return "", err
+	}
+	h := sha256.Sum256(cert.RawSubjectPublicKeyInfo)
+	return base64.StdEncoding.EncodeToString(h[:]), nil
+}
+
+func TestClientCertMapTLS(t *testing.T) {
+	serverCreds, err := ServerTransportCredentials("internal/testing/tls/ca.crt", "internal/testing/tls/server.crt", "internal/testing/tls/server.key", true)
+	if err != nil {
+		t.Fatalf("failed to create server creds: %v", err)
+	}
+	mapFile := filepath.Join(t.TempDir(), "certs.map")
+	tlsDir, err := filepath.Abs("internal/testing/tls")
+	if err != nil {
+		t.Fatalf("failed to get absolute path: %v", err)
+	}
+	contents := fmt.Sprintf(`
+# the first matching pattern wins
+*.example.com  %[1]s/wrong-client.crt  %[1]s/wrong-client.key
+127.0.0.*      %[1]s/client.crt        %[1]s/client.key
+*              %[1]s/wrong-client.crt  %[1]s/wrong-client.key
+`, tlsDir)
+	if err := os.WriteFile(mapFile, []byte(contents), 0666); err != nil {
+		t.Fatalf("failed to write certificate map: %v", err)
+	}
+	certMap, err := LoadClientCertMap(mapFile)
+	if err != nil {
+		t.Fatalf("failed to load certificate map: %v", err)
+	}
+	if cert := certMap.CertificateFor("127.0.0.1"); cert == nil || bytes.Equal(cert.Certificate[0], certMap.CertificateFor("foo.EXAMPLE.com").Certificate[0]) {
+		t.Error("expecting different certificates for different server names")
+	}
+	if !bytes.Equal(certMap.CertificateFor("foo.example.com").Certificate[0], certMap.CertificateFor("other.host").Certificate[0]) {
+		t.Error("expecting the same certificate for the same key pair")
+	}
+	tlsConf, err := ClientTLSConfig(false, "internal/testing/tls/ca.crt", "", "")
+	if err != nil {
+		t.Fatalf("failed to create client TLS config: %v", err)
+	}
+
+	e, err := createTestServerAndClient(serverCreds, ClientCertMapCredentials(tlsConf, certMap))
+	if err != nil {
+		t.Fatalf("failed to setup server and client: %v", err)
+	}
+	defer e.Close()
+
+	simpleTest(t, e.cc)
+}
+
+func TestLoadClientCertMap_Invalid(t *testing.T) {
+	mapFile := filepath.Join(t.TempDir(), "certs.map")
+	if err := os.WriteFile(mapFile, []byte("# comment\n\nlocalhost client.crt\n"), 0666); err != nil {
+		t.Fatalf("failed to write certificate map: %v", err)
+	}
+	if _, err := LoadClientCertMap(mapFile); err == nil || !strings.Contains(err.Error(), "certs.map:3:") {
+		t.Errorf("expecting error for malformed line, got %v", err)
+	}
+}